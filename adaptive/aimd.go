@@ -0,0 +1,45 @@
+package adaptive
+
+import "time"
+
+// AIMD 加性增乘性减算法，请求成功时并发上限加1，请求被丢弃或者超时时并发上限乘以backoff
+type AIMD struct {
+	limit float64
+	// min 并发上限的最小值
+	min int
+	// max 并发上限的最大值
+	max int
+	// backoff 减小并发上限的比例，取值范围是(0, 1)
+	backoff float64
+	// timeout 请求的耗时超过timeout时当作被丢弃
+	timeout time.Duration
+}
+
+// NewAIMD 初始化AIMD算法，initial是初始的并发上限，min和max是并发上限的范围，
+// backoff是减小并发上限的比例，timeout是请求的超时时间，小于等于0时不按照耗时减小
+func NewAIMD(initial, min, max int, backoff float64, timeout time.Duration) *AIMD {
+	return &AIMD{
+		limit:   clamp(float64(initial), min, max),
+		min:     min,
+		max:     max,
+		backoff: backoff,
+		timeout: timeout,
+	}
+}
+
+// Limit 当前的并发上限
+func (a *AIMD) Limit() int {
+	return int(a.limit)
+}
+
+// OnSample 请求被丢弃或者超时时乘性减小并发上限，正在处理的请求数量超过上限的一半时加性增加
+func (a *AIMD) OnSample(rtt time.Duration, inFlight int, dropped bool) int {
+	switch {
+	case dropped || (a.timeout > 0 && rtt > a.timeout):
+		a.limit = clamp(a.limit*a.backoff, a.min, a.max)
+	case inFlight*2 >= int(a.limit):
+		// 请求量太少时上限没有被用到，不能说明可以承受更多的请求
+		a.limit = clamp(a.limit+1, a.min, a.max)
+	}
+	return int(a.limit)
+}
@@ -0,0 +1,77 @@
+package adaptive
+
+import (
+	"github.com/go-playground/assert/v2"
+	"testing"
+	"time"
+)
+
+func TestAIMD_OnSample(t *testing.T) {
+	testCases := []struct {
+		name      string
+		initial   int
+		rtt       time.Duration
+		inFlight  int
+		dropped   bool
+		wantLimit int
+	}{
+		// 请求成功，加性增加
+		{
+			name:      "increase",
+			initial:   10,
+			rtt:       10 * time.Millisecond,
+			inFlight:  5,
+			wantLimit: 11,
+		},
+		// 请求量太少，上限没有被用到
+		{
+			name:      "app limited",
+			initial:   10,
+			rtt:       10 * time.Millisecond,
+			inFlight:  4,
+			wantLimit: 10,
+		},
+		// 请求被丢弃，乘性减小
+		{
+			name:      "dropped",
+			initial:   10,
+			rtt:       10 * time.Millisecond,
+			inFlight:  10,
+			dropped:   true,
+			wantLimit: 5,
+		},
+		// 请求超时当作被丢弃
+		{
+			name:      "timeout",
+			initial:   10,
+			rtt:       200 * time.Millisecond,
+			inFlight:  10,
+			wantLimit: 5,
+		},
+		// 不超过最大值
+		{
+			name:      "max",
+			initial:   20,
+			rtt:       10 * time.Millisecond,
+			inFlight:  20,
+			wantLimit: 20,
+		},
+		// 不低于最小值
+		{
+			name:      "min",
+			initial:   1,
+			rtt:       10 * time.Millisecond,
+			inFlight:  1,
+			dropped:   true,
+			wantLimit: 1,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			a := NewAIMD(tc.initial, 1, 20, 0.5, 100*time.Millisecond)
+			assert.Equal(t, tc.wantLimit, a.OnSample(tc.rtt, tc.inFlight, tc.dropped))
+			assert.Equal(t, tc.wantLimit, a.Limit())
+		})
+	}
+}
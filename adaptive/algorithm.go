@@ -0,0 +1,24 @@
+package adaptive
+
+import "time"
+
+// Algorithm 根据请求的延迟和是否被丢弃计算并发上限的算法，
+// 由Limiter加锁以后调用，实现不需要保证并发安全
+type Algorithm interface {
+	// Limit 当前的并发上限
+	Limit() int
+	// OnSample 记录一次请求的结果，rtt是请求的耗时，inFlight是请求开始时正在处理的请求数量，
+	// dropped表示请求被下游丢弃或者超时，返回新的并发上限
+	OnSample(rtt time.Duration, inFlight int, dropped bool) int
+}
+
+// clamp 把limit限制在[min, max]之间
+func clamp(limit float64, min, max int) float64 {
+	if limit < float64(min) {
+		return float64(min)
+	}
+	if limit > float64(max) {
+		return float64(max)
+	}
+	return limit
+}
@@ -0,0 +1,216 @@
+package adaptive
+
+import (
+	"context"
+	"github.com/liquanhui-99/restrictor"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// cpuSampleInterval 采样CPU使用率的间隔
+	cpuSampleInterval = 500 * time.Millisecond
+	// cpuDecay 计算CPU使用率指数移动平均时旧值的权重
+	cpuDecay = 0.95
+	// dropCoolDown 上一次丢弃请求以后的冷却时间，CPU使用率降下来以后冷却时间内仍然按照并发数量判断
+	dropCoolDown = time.Second
+)
+
+// BBR 参考Kratos BBR实现的过载保护限流器，不需要配置固定的数量，CPU使用率超过阈值，
+// 并且正在处理的请求数量超过maxPass*minRT估算出的系统容量时拒绝请求。
+// 请求结束的时间必须由调用方告知，不根据ctx推断：Acquire直接返回结束的回调，
+// 通过single.Limiter接口调用Allow时，回调交给ctx中通过WithDone设置的hook
+type BBR struct {
+	mu sync.Mutex
+	// window 统计完成的请求数量和耗时的滚动窗口
+	window *rollingWindow
+	// inFlight 正在处理的请求数量
+	inFlight int64
+	// threshold CPU使用率的阈值，单位是千分比
+	threshold int64
+	// prevDrop 上一次因为CPU使用率超过阈值丢弃请求的时间，单位是纳秒，0表示不在冷却时间内
+	prevDrop int64
+	// usage 采样得到的CPU使用率的指数移动平均，单位是千分比
+	usage int64
+	// close 关闭采样CPU的goroutine
+	close chan struct{}
+	once  sync.Once
+	clock restrictor.Clock
+}
+
+// NewBBR 初始化BBR限流器，cpu是获取CPU使用率的接口，可以使用NewCPU创建；window是统计请求的窗口大小，
+// buckets是窗口中桶的数量；threshold是CPU使用率的阈值，单位是千分比，例如800表示80%
+func NewBBR(cpu CPU, window time.Duration, buckets int, threshold int64, opts ...Option) *BBR {
+	o := newOptions(opts)
+	closeCh := make(chan struct{})
+	b := &BBR{
+		window:    newRollingWindow(window, buckets, o.clock.Now().UnixNano()),
+		threshold: threshold,
+		close:     closeCh,
+		clock:     o.clock,
+	}
+	ticker := o.clock.NewTicker(cpuSampleInterval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-closeCh:
+				return
+			case <-ticker.C():
+				usage, err := cpu.Usage()
+				if err != nil {
+					// 读取失败时保持上一次的使用率
+					continue
+				}
+				old := atomic.LoadInt64(&b.usage)
+				atomic.StoreInt64(&b.usage, int64(float64(old)*cpuDecay+float64(usage)*(1-cpuDecay)))
+			}
+		}
+	}()
+	return b
+}
+
+// doneHookKey ctx中保存WithDone设置的hook的key
+type doneHookKey struct{}
+
+// WithDone 返回携带hook的ctx，BBR的Allow和AllowN放行以后把请求结束的回调交给hook，
+// 调用方在请求处理完以后必须调用这个回调，用于通过single.Limiter接口使用BBR的中间件
+func WithDone(ctx context.Context, hook func(done func())) context.Context {
+	return context.WithValue(ctx, doneHookKey{}, hook)
+}
+
+// Allow 是否允许继续请求，实现single.Limiter接口，请求结束的回调交给ctx中通过WithDone设置的hook
+func (b *BBR) Allow(ctx context.Context) (bool, error) {
+	return b.AllowN(ctx, 1)
+}
+
+// AllowN 是否允许n个请求继续，系统过载时返回restrictor.ErrLimitExceeded，放行以后请求结束的回调交给
+// ctx中通过WithDone设置的hook；ctx中没有hook时无法知道请求什么时候结束，只判断是否放行，
+// 不计入正在处理的请求，也不统计耗时
+func (b *BBR) AllowN(ctx context.Context, n int64) (bool, error) {
+	if err := restrictor.CheckCount(n); err != nil {
+		return false, err
+	}
+	hook, ok := ctx.Value(doneHookKey{}).(func(done func()))
+	if !ok {
+		if _, err := b.admit(ctx, n, false); err != nil {
+			return false, err
+		}
+		return true, nil
+	}
+	done, err := b.acquire(ctx, n)
+	if err != nil {
+		return false, err
+	}
+	hook(done)
+	return true, nil
+}
+
+// Acquire 是否允许继续请求，系统过载时返回restrictor.ErrLimitExceeded，
+// 通过时返回请求结束的回调，请求处理完以后必须调用，用来统计完成的请求数量和耗时，重复调用只生效一次
+func (b *BBR) Acquire(ctx context.Context) (func(), error) {
+	return b.acquire(ctx, 1)
+}
+
+// AcquireN 是否允许n个请求继续，n个请求当作同时开始，在调用返回的回调时同时结束，
+// n小于等于0时返回restrictor.ErrInvalidCount
+func (b *BBR) AcquireN(ctx context.Context, n int64) (func(), error) {
+	if err := restrictor.CheckCount(n); err != nil {
+		return nil, err
+	}
+	return b.acquire(ctx, n)
+}
+
+// acquire 判断是否需要丢弃n个请求，通过时增加正在处理的请求数量，返回请求结束的回调
+func (b *BBR) acquire(ctx context.Context, n int64) (func(), error) {
+	start, err := b.admit(ctx, n, true)
+	if err != nil {
+		return nil, err
+	}
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			now := b.clock.Now()
+			b.mu.Lock()
+			defer b.mu.Unlock()
+			b.inFlight -= n
+			b.window.add(now.UnixNano(), n, now.Sub(start)*time.Duration(n))
+		})
+	}, nil
+}
+
+// admit 判断是否需要丢弃n个请求，count为true时通过以后增加正在处理的请求数量，返回判断的时间
+func (b *BBR) admit(ctx context.Context, n int64, count bool) (time.Time, error) {
+	if err := ctx.Err(); err != nil {
+		return time.Time{}, err
+	}
+	select {
+	case <-b.close:
+		return time.Time{}, restrictor.ErrLimiterClosed
+	default:
+	}
+	now := b.clock.Now()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.shouldDrop(now.UnixNano(), n) {
+		return time.Time{}, restrictor.ErrLimitExceeded
+	}
+	if count {
+		b.inFlight += n
+	}
+	return now, nil
+}
+
+// shouldDrop CPU使用率超过阈值或者还在冷却时间内，并且正在处理的请求数量超过系统容量时丢弃请求
+func (b *BBR) shouldDrop(now int64, n int64) bool {
+	if atomic.LoadInt64(&b.usage) < b.threshold {
+		if b.prevDrop == 0 {
+			return false
+		}
+		if now-b.prevDrop > int64(dropCoolDown) {
+			b.prevDrop = 0
+			return false
+		}
+		return b.overloaded(now, n)
+	}
+	drop := b.overloaded(now, n)
+	if drop && b.prevDrop == 0 {
+		b.prevDrop = now
+	}
+	return drop
+}
+
+// overloaded 加上n个请求以后正在处理的请求数量是否超过了系统容量
+func (b *BBR) overloaded(now int64, n int64) bool {
+	inFlight := b.inFlight + n
+	return inFlight > 1 && inFlight > b.maxInFlight(now)
+}
+
+// maxInFlight 系统容量，单个桶内完成的最大请求数量除以桶的时间跨度是最大吞吐，乘以最小耗时就是系统能同时处理的请求数量
+func (b *BBR) maxInFlight(now int64) int64 {
+	maxPass := b.window.maxPass(now)
+	minRT := b.window.minRT(now)
+	return int64(math.Ceil(float64(maxPass) * float64(minRT) / float64(b.window.width)))
+}
+
+// CPU 当前的CPU使用率，单位是千分比
+func (b *BBR) CPU() int64 {
+	return atomic.LoadInt64(&b.usage)
+}
+
+// InFlight 正在处理的请求数量
+func (b *BBR) InFlight() int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.inFlight
+}
+
+// Close 停止采样CPU使用率，关闭以后返回restrictor.ErrLimiterClosed，可以重复调用
+func (b *BBR) Close() {
+	b.once.Do(func() {
+		close(b.close)
+	})
+}
@@ -0,0 +1,208 @@
+package adaptive
+
+import (
+	"context"
+	"github.com/go-playground/assert/v2"
+	"github.com/liquanhui-99/restrictor"
+	"github.com/liquanhui-99/restrictor/single"
+	"github.com/stretchr/testify/require"
+	"runtime"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var _ single.Limiter = (*BBR)(nil)
+
+func TestBBR_Acquire(t *testing.T) {
+	testCases := []struct {
+		name string
+		// 请求之前的CPU使用率
+		usage  int64
+		before func(*testing.T, *BBR, *restrictor.FakeClock)
+		// 提前占用的请求数量
+		hold    int
+		wantErr error
+	}{
+		// CPU使用率没有超过阈值
+		{
+			name:   "cpu low",
+			usage:  500,
+			before: recordCapacity,
+			hold:   5,
+		},
+		// CPU使用率超过阈值，但是没有超过系统容量
+		{
+			name:   "under capacity",
+			usage:  900,
+			before: recordCapacity,
+		},
+		// CPU使用率超过阈值，并且超过了系统容量
+		{
+			name:    "overloaded",
+			usage:   900,
+			before:  recordCapacity,
+			hold:    1,
+			wantErr: restrictor.ErrLimitExceeded,
+		},
+		// CPU使用率降下来以后，冷却时间内仍然按照系统容量丢弃
+		{
+			name:  "cool down",
+			usage: 500,
+			before: func(t *testing.T, b *BBR, clock *restrictor.FakeClock) {
+				recordCapacity(t, b, clock)
+				b.prevDrop = clock.Now().UnixNano()
+				clock.Advance(time.Second)
+			},
+			hold:    1,
+			wantErr: restrictor.ErrLimitExceeded,
+		},
+		// 冷却时间过了以后不再丢弃
+		{
+			name:  "cool down expired",
+			usage: 500,
+			before: func(t *testing.T, b *BBR, clock *restrictor.FakeClock) {
+				recordCapacity(t, b, clock)
+				b.prevDrop = clock.Now().UnixNano()
+				clock.Advance(time.Second + 1)
+			},
+			hold: 1,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			clock := restrictor.NewFakeClock(time.Unix(1000, 0))
+			b := NewBBR(&fakeCPU{}, 10*time.Second, 10, 800, WithClock(clock))
+			defer b.Close()
+			tc.before(t, b, clock)
+			atomic.StoreInt64(&b.usage, tc.usage)
+			for i := 0; i < tc.hold; i++ {
+				_, err := b.Acquire(context.Background())
+				require.NoError(t, err)
+			}
+			done, err := b.Acquire(context.Background())
+			require.ErrorIs(t, err, tc.wantErr)
+			if err == nil {
+				done()
+				done()
+				assert.Equal(t, int64(tc.hold), b.InFlight())
+			}
+		})
+	}
+}
+
+func TestBBR_AcquireN(t *testing.T) {
+	clock := restrictor.NewFakeClock(time.Unix(1000, 0))
+	b := NewBBR(&fakeCPU{}, 10*time.Second, 10, 800, WithClock(clock))
+
+	// 长期存在的ctx不会让请求一直处于处理中，也不会启动等待ctx的goroutine
+	goroutines := runtime.NumGoroutine()
+	for i := 0; i < 100; i++ {
+		done, err := b.AcquireN(context.Background(), 2)
+		require.NoError(t, err)
+		assert.Equal(t, int64(2), b.InFlight())
+		done()
+		done()
+		assert.Equal(t, int64(0), b.InFlight())
+	}
+	assert.Equal(t, goroutines, runtime.NumGoroutine())
+
+	for _, n := range []int64{0, -1} {
+		done, err := b.AcquireN(context.Background(), n)
+		require.ErrorIs(t, err, restrictor.ErrInvalidCount)
+		require.Nil(t, done)
+	}
+
+	b.Close()
+	b.Close()
+	done, err := b.Acquire(context.Background())
+	require.ErrorIs(t, err, restrictor.ErrLimiterClosed)
+	require.Nil(t, done)
+}
+
+func TestBBR_Allow(t *testing.T) {
+	clock := restrictor.NewFakeClock(time.Unix(1000, 0))
+	b := NewBBR(&fakeCPU{}, 10*time.Second, 10, 800, WithClock(clock))
+	var limiter single.Limiter = b
+	goroutines := runtime.NumGoroutine()
+
+	// 通过WithDone拿到请求结束的回调，调用以后请求才结束
+	var dones []func()
+	ctx := WithDone(context.Background(), func(done func()) {
+		dones = append(dones, done)
+	})
+	ok, err := limiter.Allow(ctx)
+	require.NoError(t, err)
+	require.True(t, ok)
+	ok, err = limiter.AllowN(ctx, 2)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Len(t, dones, 2)
+	assert.Equal(t, int64(3), b.InFlight())
+	for _, done := range dones {
+		done()
+		done()
+	}
+	assert.Equal(t, int64(0), b.InFlight())
+
+	// 没有hook时只判断是否放行，不计入正在处理的请求
+	ok, err = limiter.Allow(context.Background())
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.Equal(t, int64(0), b.InFlight())
+	assert.Equal(t, goroutines, runtime.NumGoroutine())
+
+	// 过载时拒绝，不调用hook
+	recordCapacity(t, b, clock)
+	atomic.StoreInt64(&b.usage, 900)
+	_, err = b.Acquire(context.Background())
+	require.NoError(t, err)
+	dones = nil
+	ok, err = limiter.Allow(ctx)
+	require.ErrorIs(t, err, restrictor.ErrLimitExceeded)
+	require.False(t, ok)
+	require.Empty(t, dones)
+
+	_, err = limiter.AllowN(ctx, 0)
+	require.ErrorIs(t, err, restrictor.ErrInvalidCount)
+	limiter.Close()
+	_, err = limiter.Allow(ctx)
+	require.ErrorIs(t, err, restrictor.ErrLimiterClosed)
+}
+
+func TestBBR_CPU(t *testing.T) {
+	clock := restrictor.NewFakeClock(time.Unix(1000, 0))
+	b := NewBBR(&fakeCPU{usage: 1000}, 10*time.Second, 10, 800, WithClock(clock))
+	defer b.Close()
+
+	// CPU使用率按照指数移动平均逐渐升高
+	require.Eventually(t, func() bool {
+		clock.Advance(cpuSampleInterval)
+		return b.CPU() >= 100
+	}, time.Second, time.Millisecond)
+	require.LessOrEqual(t, b.CPU(), int64(1000))
+}
+
+// recordCapacity 在一个桶内完成2个耗时0.5秒的请求，桶的跨度是1秒，系统容量是1
+func recordCapacity(t *testing.T, b *BBR, clock *restrictor.FakeClock) {
+	first, err := b.Acquire(context.Background())
+	require.NoError(t, err)
+	second, err := b.Acquire(context.Background())
+	require.NoError(t, err)
+	clock.Advance(500 * time.Millisecond)
+	first()
+	second()
+	// 当前桶的统计不完整，不参与计算
+	clock.Advance(time.Second)
+	assert.Equal(t, int64(1), b.maxInFlight(clock.Now().UnixNano()))
+}
+
+// fakeCPU 返回固定的CPU使用率
+type fakeCPU struct {
+	usage int64
+}
+
+func (f *fakeCPU) Usage() (int64, error) {
+	return f.usage, nil
+}
@@ -0,0 +1,216 @@
+package adaptive
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/liquanhui-99/restrictor"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CPU 获取CPU使用率的接口
+type CPU interface {
+	// Usage 距离上一次调用这段时间内的CPU使用率，单位是千分比，范围是[0, 1000]
+	Usage() (int64, error)
+}
+
+const (
+	// cgroupDir cgroup v2挂载的目录
+	cgroupDir = "/sys/fs/cgroup"
+	// procStat 整个系统的CPU时间
+	procStat = "/proc/stat"
+)
+
+// NewCPU 初始化读取CPU使用率的CPU，运行在cgroup v2中时读取cpu.stat，按照cpu.max的配额计算使用率，
+// 否则读取/proc/stat计算整个系统的使用率
+func NewCPU() (CPU, error) {
+	if _, err := os.Stat(filepath.Join(cgroupDir, "cpu.stat")); err == nil {
+		return newCgroupCPU(cgroupDir, restrictor.RealClock)
+	}
+	return newProcCPU(procStat)
+}
+
+// cgroupCPU 通过cgroup v2的cpu.stat计算容器的CPU使用率
+type cgroupCPU struct {
+	mu sync.Mutex
+	// dir cgroup的目录
+	dir string
+	// cores 可以使用的CPU核数，按照cpu.max的配额计算，没有配额时是机器的核数
+	cores float64
+	// usage 上一次读取的usage_usec
+	usage uint64
+	// last 上一次读取的时间
+	last  time.Time
+	clock restrictor.Clock
+}
+
+func newCgroupCPU(dir string, clock restrictor.Clock) (*cgroupCPU, error) {
+	cores, err := readCPUMax(filepath.Join(dir, "cpu.max"))
+	if err != nil {
+		return nil, err
+	}
+	usage, err := readCgroupUsage(filepath.Join(dir, "cpu.stat"))
+	if err != nil {
+		return nil, err
+	}
+	return &cgroupCPU{
+		dir:   dir,
+		cores: cores,
+		usage: usage,
+		last:  clock.Now(),
+		clock: clock,
+	}, nil
+}
+
+// Usage 这段时间内容器使用的CPU时间占配额的千分比
+func (c *cgroupCPU) Usage() (int64, error) {
+	usage, err := readCgroupUsage(filepath.Join(c.dir, "cpu.stat"))
+	if err != nil {
+		return 0, err
+	}
+	now := c.clock.Now()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elapsed := now.Sub(c.last).Microseconds()
+	used := usage - c.usage
+	valid := elapsed > 0 && usage >= c.usage
+	c.usage, c.last = usage, now
+	if !valid {
+		return 0, nil
+	}
+	return clampUsage(float64(used) / (float64(elapsed) * c.cores) * 1000), nil
+}
+
+// readCgroupUsage 读取cpu.stat中的usage_usec
+func readCgroupUsage(path string) (uint64, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && fields[0] == "usage_usec" {
+			return strconv.ParseUint(fields[1], 10, 64)
+		}
+	}
+	return 0, fmt.Errorf("%s中没有usage_usec", path)
+}
+
+// readCPUMax 根据cpu.max计算可以使用的CPU核数，文件不存在或者没有配额时返回机器的核数
+func readCPUMax(path string) (float64, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return float64(runtime.NumCPU()), nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	// 格式是"$MAX $PERIOD"，没有配额时$MAX是max
+	fields := strings.Fields(string(data))
+	if len(fields) != 2 {
+		return 0, fmt.Errorf("%s的格式不正确: %s", path, data)
+	}
+	if fields[0] == "max" {
+		return float64(runtime.NumCPU()), nil
+	}
+	quota, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return 0, err
+	}
+	period, err := strconv.ParseFloat(fields[1], 64)
+	if err != nil {
+		return 0, err
+	}
+	if quota <= 0 || period <= 0 {
+		return 0, fmt.Errorf("%s的格式不正确: %s", path, data)
+	}
+	return quota / period, nil
+}
+
+// procCPU 通过/proc/stat计算整个系统的CPU使用率
+type procCPU struct {
+	mu sync.Mutex
+	// path stat文件的路径
+	path string
+	// total 上一次读取的CPU总时间
+	total uint64
+	// idle 上一次读取的空闲时间，包括iowait
+	idle uint64
+}
+
+func newProcCPU(path string) (*procCPU, error) {
+	total, idle, err := readProcStat(path)
+	if err != nil {
+		return nil, err
+	}
+	return &procCPU{path: path, total: total, idle: idle}, nil
+}
+
+// Usage 这段时间内非空闲时间占总时间的千分比
+func (p *procCPU) Usage() (int64, error) {
+	total, idle, err := readProcStat(p.path)
+	if err != nil {
+		return 0, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	dTotal, dIdle := total-p.total, idle-p.idle
+	valid := total > p.total && idle >= p.idle
+	p.total, p.idle = total, idle
+	if !valid {
+		return 0, nil
+	}
+	return clampUsage(float64(dTotal-dIdle) / float64(dTotal) * 1000), nil
+}
+
+// readProcStat 读取/proc/stat第一行的cpu汇总，返回总时间和空闲时间
+func readProcStat(path string) (uint64, uint64, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	line, _, _ := strings.Cut(string(data), "\n")
+	// cpu user nice system idle iowait irq softirq steal guest guest_nice
+	fields := strings.Fields(line)
+	if len(fields) < 5 || fields[0] != "cpu" {
+		return 0, 0, fmt.Errorf("%s的格式不正确: %s", path, line)
+	}
+	var total, idle uint64
+	// guest和guest_nice已经算在user和nice中了
+	for i, field := range fields[1:] {
+		if i >= 8 {
+			break
+		}
+		val, err := strconv.ParseUint(field, 10, 64)
+		if err != nil {
+			return 0, 0, err
+		}
+		total += val
+		// idle和iowait
+		if i == 3 || i == 4 {
+			idle += val
+		}
+	}
+	return total, idle, nil
+}
+
+// clampUsage 把使用率限制在[0, 1000]之间
+func clampUsage(usage float64) int64 {
+	if usage < 0 {
+		return 0
+	}
+	if usage > 1000 {
+		return 1000
+	}
+	return int64(usage)
+}
@@ -0,0 +1,113 @@
+package adaptive
+
+import (
+	"github.com/go-playground/assert/v2"
+	"github.com/liquanhui-99/restrictor"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestCgroupCPU_Usage(t *testing.T) {
+	testCases := []struct {
+		name    string
+		cpuMax  string
+		before  string
+		after   string
+		advance time.Duration
+		want    int64
+	}{
+		// 2核的配额，1秒内用了1秒的CPU时间
+		{
+			name:    "quota",
+			cpuMax:  "200000 100000",
+			before:  "usage_usec 1000000\nuser_usec 800000\n",
+			after:   "usage_usec 2000000\nuser_usec 1600000\n",
+			advance: time.Second,
+			want:    500,
+		},
+		// 超过配额按照1000计算
+		{
+			name:    "over quota",
+			cpuMax:  "100000 100000",
+			before:  "usage_usec 0\n",
+			after:   "usage_usec 3000000\n",
+			advance: time.Second,
+			want:    1000,
+		},
+		// 时间没有变化
+		{
+			name:   "no elapsed",
+			cpuMax: "100000 100000",
+			before: "usage_usec 0\n",
+			after:  "usage_usec 1000\n",
+			want:   0,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			require.NoError(t, os.WriteFile(filepath.Join(dir, "cpu.max"), []byte(tc.cpuMax), 0644))
+			require.NoError(t, os.WriteFile(filepath.Join(dir, "cpu.stat"), []byte(tc.before), 0644))
+			clock := restrictor.NewFakeClock(time.Now())
+			c, err := newCgroupCPU(dir, clock)
+			require.NoError(t, err)
+
+			require.NoError(t, os.WriteFile(filepath.Join(dir, "cpu.stat"), []byte(tc.after), 0644))
+			clock.Advance(tc.advance)
+			usage, err := c.Usage()
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, usage)
+		})
+	}
+}
+
+func TestReadCPUMax(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "cpu.max")
+
+	// 文件不存在时按照机器的核数
+	cores, err := readCPUMax(path)
+	require.NoError(t, err)
+	assert.Equal(t, float64(runtime.NumCPU()), cores)
+
+	// 没有配额
+	require.NoError(t, os.WriteFile(path, []byte("max 100000\n"), 0644))
+	cores, err = readCPUMax(path)
+	require.NoError(t, err)
+	assert.Equal(t, float64(runtime.NumCPU()), cores)
+
+	// 格式不正确
+	require.NoError(t, os.WriteFile(path, []byte("100000"), 0644))
+	_, err = readCPUMax(path)
+	require.Error(t, err)
+}
+
+func TestProcCPU_Usage(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "stat")
+	require.NoError(t, os.WriteFile(path,
+		[]byte("cpu  100 0 100 700 100 0 0 0 0 0\ncpu0 100 0 100 700 100 0 0 0 0 0\n"), 0644))
+	c, err := newProcCPU(path)
+	require.NoError(t, err)
+
+	// 总时间增加了1000，空闲和iowait增加了250
+	require.NoError(t, os.WriteFile(path,
+		[]byte("cpu  500 0 450 900 150 0 0 0 0 0\ncpu0 500 0 450 900 150 0 0 0 0 0\n"), 0644))
+	usage, err := c.Usage()
+	require.NoError(t, err)
+	assert.Equal(t, int64(750), usage)
+
+	// 没有变化
+	usage, err = c.Usage()
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), usage)
+
+	// 格式不正确
+	require.NoError(t, os.WriteFile(path, []byte("intr 1 2 3\n"), 0644))
+	_, err = c.Usage()
+	require.Error(t, err)
+}
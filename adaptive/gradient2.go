@@ -0,0 +1,74 @@
+package adaptive
+
+import (
+	"math"
+	"time"
+)
+
+// Gradient2 参考Netflix concurrency-limits中Gradient2的算法，比较长期平均延迟和当前延迟的梯度调整并发上限，
+// 当前延迟高于长期延迟时减小并发上限，否则在当前上限的基础上增加sqrt(limit)的排队余量
+type Gradient2 struct {
+	limit float64
+	// min 并发上限的最小值
+	min int
+	// max 并发上限的最大值
+	max int
+	// longRtt 长期延迟的指数移动平均，单位是纳秒
+	longRtt float64
+	// samples 已经记录的样本数量，前window个样本计算算术平均
+	samples int
+}
+
+const (
+	// gradient2Window 计算长期延迟的样本窗口
+	gradient2Window = 600
+	// gradient2Tolerance 允许当前延迟比长期延迟高多少
+	gradient2Tolerance = 1.5
+	// gradient2Smoothing 新的并发上限所占的比例
+	gradient2Smoothing = 0.2
+)
+
+// NewGradient2 初始化Gradient2算法，initial是初始的并发上限，min和max是并发上限的范围
+func NewGradient2(initial, min, max int) *Gradient2 {
+	return &Gradient2{
+		limit: clamp(float64(initial), min, max),
+		min:   min,
+		max:   max,
+	}
+}
+
+// Limit 当前的并发上限
+func (g *Gradient2) Limit() int {
+	return int(g.limit)
+}
+
+// OnSample 根据梯度longRtt/rtt调整并发上限，梯度限制在[0.5, 1]之间，请求被丢弃时按照0.5计算
+func (g *Gradient2) OnSample(rtt time.Duration, inFlight int, dropped bool) int {
+	if rtt <= 0 {
+		return int(g.limit)
+	}
+	shortRtt := float64(rtt)
+	g.samples++
+	if g.samples <= gradient2Window {
+		g.longRtt += (shortRtt - g.longRtt) / float64(g.samples)
+	} else {
+		g.longRtt += (shortRtt - g.longRtt) * 2 / (gradient2Window + 1)
+	}
+	// 长期延迟明显高于当前延迟时说明负载已经降下来了，让长期延迟尽快回落
+	if g.longRtt/shortRtt > 2 {
+		g.longRtt *= 0.95
+	}
+
+	gradient := 0.5
+	if !dropped {
+		if inFlight*2 < int(g.limit) {
+			// 请求量太少时上限没有被用到
+			return int(g.limit)
+		}
+		gradient = math.Max(0.5, math.Min(1, gradient2Tolerance*g.longRtt/shortRtt))
+	}
+	limit := g.limit*gradient + math.Sqrt(g.limit)
+	limit = g.limit*(1-gradient2Smoothing) + limit*gradient2Smoothing
+	g.limit = clamp(limit, g.min, g.max)
+	return int(g.limit)
+}
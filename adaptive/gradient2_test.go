@@ -0,0 +1,37 @@
+package adaptive
+
+import (
+	"github.com/go-playground/assert/v2"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestGradient2_OnSample(t *testing.T) {
+	g := NewGradient2(10, 1, 100)
+
+	// 请求量太少，上限没有被用到
+	assert.Equal(t, 10, g.OnSample(10*time.Millisecond, 1, false))
+
+	// 延迟稳定时逐渐增加
+	for i := 0; i < 20; i++ {
+		g.OnSample(10*time.Millisecond, g.Limit(), false)
+	}
+	require.Greater(t, g.Limit(), 20)
+
+	// 延迟突然升高时减小
+	limit := g.Limit()
+	g.OnSample(100*time.Millisecond, limit, false)
+	require.Less(t, g.Limit(), limit)
+
+	// 请求被丢弃时减小
+	limit = g.Limit()
+	g.OnSample(10*time.Millisecond, limit, true)
+	require.Less(t, g.Limit(), limit)
+
+	// 不超过最大值
+	for i := 0; i < 1000; i++ {
+		g.OnSample(10*time.Millisecond, g.Limit(), false)
+	}
+	assert.Equal(t, 100, g.Limit())
+}
@@ -0,0 +1,106 @@
+package adaptive
+
+import (
+	"context"
+	"github.com/liquanhui-99/restrictor"
+	"sync"
+	"time"
+)
+
+// Limiter 自适应并发限流器，并发上限不是固定的，而是由Algorithm根据请求的延迟和是否被丢弃动态调整，
+// 每个通过的请求都要通过Listener上报结果
+type Limiter struct {
+	mu sync.Mutex
+	// algorithm 计算并发上限的算法
+	algorithm Algorithm
+	// limit 当前的并发上限
+	limit int
+	// inFlight 正在处理的请求数量
+	inFlight int
+	// clock 计算请求耗时的时钟
+	clock restrictor.Clock
+}
+
+// NewLimiter 初始化自适应并发限流器，algorithm可以是AIMD、Vegas或者Gradient2
+func NewLimiter(algorithm Algorithm, opts ...Option) *Limiter {
+	o := newOptions(opts)
+	return &Limiter{
+		algorithm: algorithm,
+		limit:     algorithm.Limit(),
+		clock:     o.clock,
+	}
+}
+
+// Acquire 获取一个处理请求的位置，正在处理的请求数量达到并发上限时返回restrictor.ErrLimitExceeded，
+// 成功时返回Listener，请求结束以后必须调用OnSuccess、OnDropped或者OnIgnore其中的一个
+func (l *Limiter) Acquire(ctx context.Context) (*Listener, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.inFlight >= l.limit {
+		return nil, restrictor.ErrLimitExceeded
+	}
+	l.inFlight++
+	return &Listener{
+		limiter:  l,
+		start:    l.clock.Now(),
+		inFlight: l.inFlight,
+	}, nil
+}
+
+// Limit 当前的并发上限
+func (l *Limiter) Limit() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.limit
+}
+
+// InFlight 正在处理的请求数量
+func (l *Limiter) InFlight() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.inFlight
+}
+
+// release 释放一个位置，sample为true时把请求的结果交给算法调整并发上限
+func (l *Limiter) release(rtt time.Duration, inFlight int, dropped bool, sample bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.inFlight--
+	if sample {
+		l.limit = l.algorithm.OnSample(rtt, inFlight, dropped)
+	}
+}
+
+// Listener 一个通过限流器的请求，用来上报请求的结果，多次上报只有第一次生效
+type Listener struct {
+	limiter *Limiter
+	// start 请求开始的时间
+	start time.Time
+	// inFlight 请求开始时正在处理的请求数量，包括自己
+	inFlight int
+	once     sync.Once
+}
+
+// OnSuccess 请求处理成功，请求的耗时会用来调整并发上限
+func (l *Listener) OnSuccess() {
+	l.once.Do(func() {
+		l.limiter.release(l.limiter.clock.Now().Sub(l.start), l.inFlight, false, true)
+	})
+}
+
+// OnDropped 请求被下游丢弃或者超时，说明已经过载，会减小并发上限
+func (l *Listener) OnDropped() {
+	l.once.Do(func() {
+		l.limiter.release(l.limiter.clock.Now().Sub(l.start), l.inFlight, true, true)
+	})
+}
+
+// OnIgnore 请求的结果不能反映负载，例如参数校验失败，只释放位置不调整并发上限
+func (l *Listener) OnIgnore() {
+	l.once.Do(func() {
+		l.limiter.release(0, l.inFlight, false, false)
+	})
+}
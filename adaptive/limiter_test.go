@@ -0,0 +1,95 @@
+package adaptive
+
+import (
+	"context"
+	"github.com/go-playground/assert/v2"
+	"github.com/liquanhui-99/restrictor"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestLimiter_Acquire(t *testing.T) {
+	testCases := []struct {
+		name string
+		// 提前占用的位置数量
+		hold      int
+		report    func(clock *restrictor.FakeClock, l *Listener)
+		wantErr   error
+		wantLimit int
+		// 上报以后正在处理的请求数量
+		wantInFlight int
+	}{
+		// 请求成功，并发上限增加
+		{
+			name: "success",
+			hold: 1,
+			report: func(clock *restrictor.FakeClock, l *Listener) {
+				clock.Advance(10 * time.Millisecond)
+				l.OnSuccess()
+				l.OnSuccess()
+			},
+			wantLimit:    3,
+			wantInFlight: 1,
+		},
+		// 请求被丢弃，并发上限减小
+		{
+			name: "dropped",
+			hold: 1,
+			report: func(clock *restrictor.FakeClock, l *Listener) {
+				l.OnDropped()
+				l.OnSuccess()
+			},
+			wantLimit:    1,
+			wantInFlight: 1,
+		},
+		// 请求超时当作被丢弃
+		{
+			name: "timeout",
+			hold: 1,
+			report: func(clock *restrictor.FakeClock, l *Listener) {
+				clock.Advance(time.Second)
+				l.OnSuccess()
+			},
+			wantLimit:    1,
+			wantInFlight: 1,
+		},
+		// 忽略请求的结果，只释放位置
+		{
+			name: "ignore",
+			hold: 1,
+			report: func(clock *restrictor.FakeClock, l *Listener) {
+				l.OnIgnore()
+				l.OnDropped()
+			},
+			wantLimit:    2,
+			wantInFlight: 1,
+		},
+		// 达到并发上限
+		{
+			name:         "limit exceeded",
+			hold:         2,
+			wantErr:      restrictor.ErrLimitExceeded,
+			wantLimit:    2,
+			wantInFlight: 2,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			clock := restrictor.NewFakeClock(time.Now())
+			limiter := NewLimiter(NewAIMD(2, 1, 10, 0.5, 100*time.Millisecond), WithClock(clock))
+			for i := 0; i < tc.hold; i++ {
+				_, err := limiter.Acquire(context.Background())
+				require.NoError(t, err)
+			}
+			l, err := limiter.Acquire(context.Background())
+			require.ErrorIs(t, err, tc.wantErr)
+			if err == nil {
+				tc.report(clock, l)
+			}
+			assert.Equal(t, tc.wantLimit, limiter.Limit())
+			assert.Equal(t, tc.wantInFlight, limiter.InFlight())
+		})
+	}
+}
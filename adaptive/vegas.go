@@ -0,0 +1,63 @@
+package adaptive
+
+import (
+	"math"
+	"time"
+)
+
+// Vegas 参考TCP Vegas的算法，把观察到的最小延迟当作没有排队时的延迟，
+// 根据当前延迟估算排队的请求数量，排队少时增加并发上限，排队多时减小并发上限
+type Vegas struct {
+	limit float64
+	// max 并发上限的最大值
+	max int
+	// rttNoLoad 观察到的最小延迟，当作没有排队时的延迟
+	rttNoLoad time.Duration
+}
+
+// NewVegas 初始化Vegas算法，initial是初始的并发上限，max是并发上限的最大值
+func NewVegas(initial, max int) *Vegas {
+	return &Vegas{
+		limit: clamp(float64(initial), 1, max),
+		max:   max,
+	}
+}
+
+// Limit 当前的并发上限
+func (v *Vegas) Limit() int {
+	return int(v.limit)
+}
+
+// OnSample 估算排队的请求数量queue = limit * (1 - rttNoLoad/rtt)，
+// queue小于log10(limit)时大幅增加，小于3*log10(limit)时小幅增加，大于6*log10(limit)时减小
+func (v *Vegas) OnSample(rtt time.Duration, inFlight int, dropped bool) int {
+	if rtt <= 0 {
+		return int(v.limit)
+	}
+	if v.rttNoLoad == 0 || rtt < v.rttNoLoad {
+		v.rttNoLoad = rtt
+	}
+	// log10(1)为0，至少按照1计算
+	log := math.Max(1, math.Log10(v.limit))
+	switch {
+	case dropped:
+		v.limit -= log
+	case inFlight*2 < int(v.limit):
+		// 请求量太少时上限没有被用到
+		return int(v.limit)
+	default:
+		queue := math.Ceil(v.limit * (1 - float64(v.rttNoLoad)/float64(rtt)))
+		switch {
+		case queue <= log:
+			v.limit += 6 * log
+		case queue < 3*log:
+			v.limit += log
+		case queue > 6*log:
+			v.limit -= log
+		default:
+			return int(v.limit)
+		}
+	}
+	v.limit = clamp(v.limit, 1, v.max)
+	return int(v.limit)
+}
@@ -0,0 +1,72 @@
+package adaptive
+
+import (
+	"github.com/go-playground/assert/v2"
+	"testing"
+	"time"
+)
+
+func TestVegas_OnSample(t *testing.T) {
+	testCases := []struct {
+		name     string
+		rtt      time.Duration
+		inFlight int
+		dropped  bool
+		// wantLimit 在没有排队的延迟是10毫秒、并发上限是10的基础上记录样本以后的并发上限
+		wantLimit int
+	}{
+		// 几乎没有排队，大幅增加
+		{
+			name:      "no queue",
+			rtt:       11 * time.Millisecond,
+			inFlight:  10,
+			wantLimit: 16,
+		},
+		// 排队很少，小幅增加
+		{
+			name:      "small queue",
+			rtt:       12 * time.Millisecond,
+			inFlight:  10,
+			wantLimit: 11,
+		},
+		// 排队数量适中，保持不变
+		{
+			name:      "stable",
+			rtt:       20 * time.Millisecond,
+			inFlight:  10,
+			wantLimit: 10,
+		},
+		// 排队太多，减小
+		{
+			name:      "long queue",
+			rtt:       100 * time.Millisecond,
+			inFlight:  10,
+			wantLimit: 9,
+		},
+		// 请求被丢弃，减小
+		{
+			name:      "dropped",
+			rtt:       10 * time.Millisecond,
+			inFlight:  10,
+			dropped:   true,
+			wantLimit: 9,
+		},
+		// 请求量太少，上限没有被用到
+		{
+			name:      "app limited",
+			rtt:       11 * time.Millisecond,
+			inFlight:  4,
+			wantLimit: 10,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			v := NewVegas(10, 100)
+			// 请求量很少时记录没有排队的延迟
+			assert.Equal(t, 10, v.OnSample(10*time.Millisecond, 1, false))
+			assert.Equal(t, tc.wantLimit, v.OnSample(tc.rtt, tc.inFlight, tc.dropped))
+			assert.Equal(t, tc.wantLimit, v.Limit())
+		})
+	}
+}
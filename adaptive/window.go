@@ -0,0 +1,94 @@
+package adaptive
+
+import "time"
+
+// rollingWindow 按照时间滚动的桶，记录每个桶内完成的请求数量和耗时，由调用方加锁
+type rollingWindow struct {
+	// buckets 环形数组
+	buckets []windowBucket
+	// width 每个桶的时间跨度，单位是纳秒
+	width int64
+	// offset 当前桶的下标
+	offset int
+	// start 当前桶的起始时间，单位是纳秒
+	start int64
+}
+
+// windowBucket 一个桶内的统计
+type windowBucket struct {
+	// count 完成的请求数量
+	count int64
+	// rt 完成的请求的总耗时，单位是纳秒
+	rt int64
+}
+
+// newRollingWindow 初始化滚动窗口，window是窗口的时间跨度，size是桶的数量
+func newRollingWindow(window time.Duration, size int, now int64) *rollingWindow {
+	width := int64(window) / int64(size)
+	return &rollingWindow{
+		buckets: make([]windowBucket, size),
+		width:   width,
+		start:   now - now%width,
+	}
+}
+
+// add 在now所在的桶中记录count个请求，总耗时是rt
+func (w *rollingWindow) add(now int64, count int64, rt time.Duration) {
+	w.advance(now)
+	b := &w.buckets[w.offset]
+	b.count += count
+	b.rt += int64(rt)
+}
+
+// advance 滚动到now所在的桶，清空滚动过程中经过的桶
+func (w *rollingWindow) advance(now int64) {
+	steps := (now - w.start) / w.width
+	if steps <= 0 {
+		return
+	}
+	if steps > int64(len(w.buckets)) {
+		steps = int64(len(w.buckets))
+	}
+	for i := int64(0); i < steps; i++ {
+		w.offset = (w.offset + 1) % len(w.buckets)
+		w.buckets[w.offset] = windowBucket{}
+	}
+	w.start = now - now%w.width
+}
+
+// maxPass 除了当前的桶以外，单个桶内完成的最大请求数量，没有数据时返回1
+func (w *rollingWindow) maxPass(now int64) int64 {
+	w.advance(now)
+	var res int64 = 1
+	w.each(func(b windowBucket) {
+		if b.count > res {
+			res = b.count
+		}
+	})
+	return res
+}
+
+// minRT 除了当前的桶以外，单个桶内请求的最小平均耗时，没有数据时返回1毫秒
+func (w *rollingWindow) minRT(now int64) time.Duration {
+	w.advance(now)
+	var res int64
+	w.each(func(b windowBucket) {
+		if b.count == 0 {
+			return
+		}
+		if avg := b.rt / b.count; res == 0 || avg < res {
+			res = avg
+		}
+	})
+	if res <= 0 {
+		return time.Millisecond
+	}
+	return time.Duration(res)
+}
+
+// each 遍历除了当前桶以外的桶，当前桶的统计还不完整
+func (w *rollingWindow) each(fn func(b windowBucket)) {
+	for i := 1; i < len(w.buckets); i++ {
+		fn(w.buckets[(w.offset+i)%len(w.buckets)])
+	}
+}
@@ -0,0 +1,37 @@
+package adaptive
+
+import (
+	"github.com/go-playground/assert/v2"
+	"testing"
+	"time"
+)
+
+func TestRollingWindow(t *testing.T) {
+	start := time.Unix(1000, 0).UnixNano()
+	w := newRollingWindow(time.Second, 10, start)
+
+	// 没有数据
+	assert.Equal(t, int64(1), w.maxPass(start))
+	assert.Equal(t, time.Millisecond, w.minRT(start))
+
+	w.add(start, 4, 40*time.Millisecond)
+	w.add(start+int64(100*time.Millisecond), 2, 40*time.Millisecond)
+	// 当前桶的统计不参与计算
+	assert.Equal(t, int64(4), w.maxPass(start+int64(100*time.Millisecond)))
+	assert.Equal(t, 10*time.Millisecond, w.minRT(start+int64(100*time.Millisecond)))
+
+	// 两个桶都已经完成
+	now := start + int64(200*time.Millisecond)
+	assert.Equal(t, int64(4), w.maxPass(now))
+	assert.Equal(t, 10*time.Millisecond, w.minRT(now))
+
+	// 第一个桶滚出窗口
+	now = start + int64(time.Second)
+	assert.Equal(t, int64(2), w.maxPass(now))
+	assert.Equal(t, 20*time.Millisecond, w.minRT(now))
+
+	// 很久没有请求，所有桶都清空
+	now = start + int64(time.Hour)
+	assert.Equal(t, int64(1), w.maxPass(now))
+	assert.Equal(t, time.Millisecond, w.minRT(now))
+}
@@ -0,0 +1,88 @@
+package restrictor
+
+import "time"
+
+// Clock 限流器获取时间和创建定时器的接口，默认使用RealClock，测试时可以替换成FakeClock
+type Clock interface {
+	// Now 当前时间
+	Now() time.Time
+	// NewTicker 创建周期为d的Ticker
+	NewTicker(d time.Duration) Ticker
+	// NewTimer 创建d以后触发的Timer
+	NewTimer(d time.Duration) Timer
+	// Sleep 阻塞d的时长
+	Sleep(d time.Duration)
+}
+
+// Ticker 对time.Ticker的抽象
+type Ticker interface {
+	// C 接收触发时间的channel
+	C() <-chan time.Time
+	// Stop 停止Ticker
+	Stop()
+	// Reset 修改Ticker的周期
+	Reset(d time.Duration)
+}
+
+// Timer 对time.Timer的抽象
+type Timer interface {
+	// C 接收触发时间的channel
+	C() <-chan time.Time
+	// Stop 停止Timer，Timer已经触发或者已经停止时返回false
+	Stop() bool
+	// Reset 让Timer在d以后触发
+	Reset(d time.Duration) bool
+}
+
+// RealClock 基于time包实现的时钟
+var RealClock Clock = realClock{}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) NewTicker(d time.Duration) Ticker {
+	return realTicker{t: time.NewTicker(d)}
+}
+
+func (realClock) NewTimer(d time.Duration) Timer {
+	return realTimer{t: time.NewTimer(d)}
+}
+
+func (realClock) Sleep(d time.Duration) {
+	time.Sleep(d)
+}
+
+type realTicker struct {
+	t *time.Ticker
+}
+
+func (r realTicker) C() <-chan time.Time {
+	return r.t.C
+}
+
+func (r realTicker) Stop() {
+	r.t.Stop()
+}
+
+func (r realTicker) Reset(d time.Duration) {
+	r.t.Reset(d)
+}
+
+type realTimer struct {
+	t *time.Timer
+}
+
+func (r realTimer) C() <-chan time.Time {
+	return r.t.C
+}
+
+func (r realTimer) Stop() bool {
+	return r.t.Stop()
+}
+
+func (r realTimer) Reset(d time.Duration) bool {
+	return r.t.Reset(d)
+}
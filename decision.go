@@ -0,0 +1,41 @@
+package restrictor
+
+import "time"
+
+// 内置限流器的名称，记录在Decision.Limiter中
+const (
+	TokenBucket             = "token_bucket"
+	LazyTokenBucket         = "lazy_token_bucket"
+	WarmUpTokenBucket       = "warm_up_token_bucket"
+	LeakeyBucket            = "leakey_bucket"
+	FixedWindow             = "fixed_window"
+	SlideWindow             = "slide_window"
+	SlideWindowCounter      = "slide_window_counter"
+	RedisFixedWindow        = "redis_fixed_window"
+	RedisSlideWindow        = "redis_slide_window"
+	RedisSlideWindowCounter = "redis_slide_window_counter"
+	RedisTokenBucket        = "redis_token_bucket"
+	RedisWarmUpTokenBucket  = "redis_warm_up_token_bucket"
+	GCRA                    = "gcra"
+	RedisGCRA               = "redis_gcra"
+	RedisConcurrency        = "redis_concurrency"
+	RedisComposite          = "redis_composite"
+	Ip                      = "ip"
+)
+
+// Decision 限流器对一次请求的判定结果，可以用来设置X-RateLimit-*和Retry-After等响应头
+type Decision struct {
+	// Allowed 是否允许请求通过
+	Allowed bool
+	// Limit 限流器允许的最大数量，例如窗口内的最大请求数量或者令牌桶的容量
+	Limit int64
+	// Remaining 判定以后还剩余的数量
+	Remaining int64
+	// ResetAt 剩余数量恢复到Limit的时间
+	ResetAt time.Time
+	// RetryAfter 请求被拒绝时需要等待多久再重试，请求通过时为0；
+	// 请求被拒绝且RetryAfter为0说明请求的数量超过了Limit，重试也不会通过
+	RetryAfter time.Duration
+	// Limiter 做出判定的限流器名称
+	Limiter string
+}
@@ -0,0 +1,81 @@
+package Redis
+
+import (
+	"context"
+	"errors"
+	"github.com/liquanhui-99/restrictor"
+	"github.com/redis/go-redis/v9"
+)
+
+// Request AllowMany中的一个请求
+type Request struct {
+	// Key 存储在Redis中的键，和Allow的key一致
+	Key string
+	// N 消耗的单位数量，必须大于0
+	N int64
+}
+
+// argsFunc 返回消耗n个单位时lua脚本的ARGV
+type argsFunc func(n int64) []interface{}
+
+// decideFunc 把消耗n个单位时lua脚本的返回值转换成判定结果
+type decideFunc func(res interface{}, n int64) (restrictor.Decision, error)
+
+// decideMany 在一个pipeline中对每个请求执行script，一次Redis往返得到所有请求的判定结果，
+// Redis中没有缓存脚本的请求在加载脚本以后重新执行一次。每个请求单独判定，被拒绝的请求不影响其他的请求；
+// 任何一个请求的N小于等于0时不访问Redis，直接返回restrictor.ErrInvalidCount；
+// 任何一个请求执行失败时返回第一个错误，其他的请求可能已经消耗了额度
+func decideMany(ctx context.Context, client redis.Cmdable, script *redis.Script, layout keyLayout,
+	reqs []Request, args argsFunc, decide decideFunc) ([]restrictor.Decision, error) {
+	if len(reqs) == 0 {
+		return nil, nil
+	}
+	for _, req := range reqs {
+		if err := restrictor.CheckCount(req.N); err != nil {
+			return nil, err
+		}
+	}
+	cmds := make([]*redis.Cmd, len(reqs))
+	idx := make([]int, len(reqs))
+	for i := range reqs {
+		idx[i] = i
+	}
+	for retried := false; ; retried = true {
+		pipe := client.Pipeline()
+		for _, i := range idx {
+			cmds[i] = script.EvalSha(ctx, pipe, []string{layout.key(reqs[i].Key)}, args(reqs[i].N)...)
+		}
+		// Redis返回的错误单独检查每个命令，连接失败等错误所有的命令都没有结果
+		var redisErr redis.Error
+		if _, err := pipe.Exec(ctx); err != nil && !errors.As(err, &redisErr) {
+			return nil, backendError(err)
+		}
+
+		idx = idx[:0]
+		for i, cmd := range cmds {
+			if redis.HasErrorPrefix(cmd.Err(), "NOSCRIPT") {
+				idx = append(idx, i)
+			}
+		}
+		if len(idx) == 0 || retried {
+			break
+		}
+		if err := script.Load(ctx, client).Err(); err != nil {
+			return nil, backendError(err)
+		}
+	}
+
+	ds := make([]restrictor.Decision, 0, len(reqs))
+	for i, cmd := range cmds {
+		res, err := cmd.Result()
+		if err != nil {
+			return nil, backendError(err)
+		}
+		d, err := decide(res, reqs[i].N)
+		if err != nil {
+			return nil, err
+		}
+		ds = append(ds, d)
+	}
+	return ds, nil
+}
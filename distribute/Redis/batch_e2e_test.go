@@ -0,0 +1,93 @@
+package Redis
+
+import (
+	"context"
+	"github.com/liquanhui-99/restrictor"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestTokenBucketLimiter_AllowMany(t *testing.T) {
+	client := redis.NewClient(&redis.Options{
+		Addr:     "127.0.0.1:6379",
+		Password: "123456",
+	})
+	limiter := NewTokenBucketLimiter(client, 1, 2)
+	keys := []string{"allow_many:ip", "allow_many:user", "allow_many:tenant", "allow_many:route", "allow_many:global"}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	defer client.Del(ctx, keys...)
+
+	// 先用完user的令牌
+	res, err := limiter.AllowN(ctx, keys[1], 2)
+	require.NoError(t, err)
+	require.True(t, res)
+
+	// Redis中没有缓存脚本时加载以后重新执行
+	require.NoError(t, client.ScriptFlush(ctx).Err())
+	reqs := make([]Request, 0, len(keys))
+	for _, key := range keys {
+		reqs = append(reqs, Request{Key: key, N: 1})
+	}
+	ds, err := limiter.AllowMany(ctx, reqs)
+	require.NoError(t, err)
+	require.Len(t, ds, len(keys))
+	for i, d := range ds {
+		require.Equal(t, restrictor.RedisTokenBucket, d.Limiter)
+		require.Equal(t, int64(2), d.Limit)
+		if i == 1 {
+			// 只有user被拒绝，不影响其他的key
+			require.False(t, d.Allowed)
+			require.Greater(t, d.RetryAfter, time.Duration(0))
+			continue
+		}
+		require.True(t, d.Allowed)
+		require.Equal(t, int64(1), d.Remaining)
+	}
+}
+
+func TestFixedWindowLimiter_AllowMany(t *testing.T) {
+	client := redis.NewClient(&redis.Options{
+		Addr:     "127.0.0.1:6379",
+		Password: "123456",
+	})
+	limiter := NewFixedWindowLimiter(client, 3, time.Minute, WithKeyPrefix("allow_many:"))
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	defer client.Del(ctx, "allow_many:a", "allow_many:b")
+
+	// 同一批请求中相同的key按照顺序判定
+	ds, err := limiter.AllowMany(ctx, []Request{{Key: "a", N: 2}, {Key: "b", N: 1}, {Key: "a", N: 2}})
+	require.NoError(t, err)
+	require.Len(t, ds, 3)
+	require.True(t, ds[0].Allowed)
+	require.Equal(t, int64(1), ds[0].Remaining)
+	require.True(t, ds[1].Allowed)
+	require.Equal(t, int64(2), ds[1].Remaining)
+	require.False(t, ds[2].Allowed)
+	require.Equal(t, int64(1), ds[2].Remaining)
+}
+
+func TestSlideWindowLimiter_AllowMany(t *testing.T) {
+	client := redis.NewClient(&redis.Options{
+		Addr:     "127.0.0.1:6379",
+		Password: "123456",
+	})
+	limiter := NewSlideWindowLimiter(client, 2, time.Minute)
+	key := "slide_window_allow_many"
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	defer client.Del(ctx, key)
+
+	// 同一批请求中相同的key的成员不会互相覆盖
+	ds, err := limiter.AllowMany(ctx, []Request{{Key: key, N: 1}, {Key: key, N: 1}, {Key: key, N: 1}})
+	require.NoError(t, err)
+	require.True(t, ds[0].Allowed)
+	require.True(t, ds[1].Allowed)
+	require.False(t, ds[2].Allowed)
+	cnt, err := client.ZCard(ctx, key).Result()
+	require.NoError(t, err)
+	require.Equal(t, int64(2), cnt)
+}
@@ -0,0 +1,78 @@
+package Redis
+
+import (
+	"context"
+	"github.com/liquanhui-99/restrictor"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestAllowMany_BackendUnavailable(t *testing.T) {
+	// 没有监听的端口，连接直接被拒绝
+	client := redis.NewClient(&redis.Options{
+		Addr:       "127.0.0.1:1",
+		MaxRetries: -1,
+	})
+	defer client.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	limiter := NewTokenBucketLimiter(client, 1, 2)
+
+	// 没有请求时不访问Redis
+	ds, err := limiter.AllowMany(ctx, nil)
+	require.NoError(t, err)
+	require.Empty(t, ds)
+
+	ds, err = limiter.AllowMany(ctx, []Request{{Key: "ip", N: 1}, {Key: "user", N: 1}})
+	require.ErrorIs(t, err, restrictor.ErrBackendUnavailable)
+	require.Nil(t, ds)
+}
+
+func TestLimiters_InvalidCount(t *testing.T) {
+	// 没有监听的端口，n不合法时在访问Redis之前就返回
+	client := redis.NewClient(&redis.Options{
+		Addr:       "127.0.0.1:1",
+		MaxRetries: -1,
+	})
+	defer client.Close()
+	testCases := []struct {
+		name    string
+		limiter interface {
+			Decide(ctx context.Context, key string, n int64) (restrictor.Decision, error)
+			AllowN(ctx context.Context, key string, n int64) (bool, error)
+			AllowMany(ctx context.Context, reqs []Request) ([]restrictor.Decision, error)
+		}
+	}{
+		{name: "固定窗口", limiter: NewFixedWindowLimiter(client, 10, time.Minute)},
+		{name: "滑动窗口", limiter: NewSlideWindowLimiter(client, 10, time.Minute)},
+		{name: "滑动窗口计数器", limiter: NewSlideWindowCounterLimiter(client, 10, time.Minute)},
+		{name: "令牌桶", limiter: NewTokenBucketLimiter(client, 1, 10)},
+		{name: "GCRA", limiter: NewGCRALimiter(client, time.Minute, 10, 10)},
+		{name: "预热令牌桶", limiter: NewWarmUpTokenBucketLimiter(client, 1, time.Second)},
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			for _, n := range []int64{0, -1, -100} {
+				res, err := tc.limiter.AllowN(ctx, "key", n)
+				require.ErrorIs(t, err, restrictor.ErrInvalidCount)
+				require.False(t, res)
+				_, err = tc.limiter.Decide(ctx, "key", n)
+				require.ErrorIs(t, err, restrictor.ErrInvalidCount)
+				ds, err := tc.limiter.AllowMany(ctx, []Request{{Key: "a", N: 1}, {Key: "b", N: n}})
+				require.ErrorIs(t, err, restrictor.ErrInvalidCount)
+				require.Nil(t, ds)
+			}
+		})
+	}
+
+	composite := NewCompositeLimiter(client, []Tier{{Rate: 1, Burst: 10}})
+	for _, n := range []int64{0, -100} {
+		res, err := composite.AllowN(ctx, []string{"key"}, n)
+		require.ErrorIs(t, err, restrictor.ErrInvalidCount)
+		require.False(t, res)
+	}
+}
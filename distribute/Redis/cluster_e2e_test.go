@@ -0,0 +1,89 @@
+package Redis
+
+import (
+	"context"
+	"github.com/liquanhui-99/restrictor"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newClusterClient 连接本地三主三从的Redis集群，节点的端口是7000到7005，
+// 可以通过redis-cli --cluster create 127.0.0.1:7000 ... 127.0.0.1:7005 --cluster-replicas 1创建
+func newClusterClient() *redis.ClusterClient {
+	return redis.NewClusterClient(&redis.ClusterOptions{
+		Addrs: []string{
+			"127.0.0.1:7000", "127.0.0.1:7001", "127.0.0.1:7002",
+			"127.0.0.1:7003", "127.0.0.1:7004", "127.0.0.1:7005",
+		},
+		Password: "123456",
+	})
+}
+
+func TestCluster_TokenBucketLimiter(t *testing.T) {
+	client := newClusterClient()
+	defer client.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	limiter := NewTokenBucketLimiter(client, 1, 2, WithKeyPrefix("app:"))
+	keys := []string{"cluster_token_bucket:1", "cluster_token_bucket:2", "cluster_token_bucket:3"}
+
+	// 不同的key分布在不同的主节点上，每个key单独限流
+	masters := make(map[string]struct{}, len(keys))
+	for _, key := range keys {
+		defer client.Del(ctx, "app:"+key)
+		master, err := client.MasterForKey(ctx, "app:"+key)
+		require.NoError(t, err)
+		masters[master.Options().Addr] = struct{}{}
+
+		for i := 0; i < 2; i++ {
+			res, err := limiter.Allow(ctx, key)
+			require.NoError(t, err)
+			require.True(t, res)
+		}
+		res, err := limiter.Allow(ctx, key)
+		require.ErrorIs(t, err, restrictor.ErrLimitExceeded)
+		require.False(t, res)
+		// 带上前缀以后的key
+		n, err := client.Exists(ctx, "app:"+key).Result()
+		require.NoError(t, err)
+		require.Equal(t, int64(1), n)
+	}
+	require.Greater(t, len(masters), 1)
+}
+
+func TestCluster_CompositeLimiter(t *testing.T) {
+	client := newClusterClient()
+	defer client.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	tiers := []Tier{{Rate: 1, Burst: 1}, {Rate: 10, Burst: 10}}
+	keys := []string{"cluster_user:1", "cluster_global"}
+	require.NotEqual(t, Slot(keys[0]), Slot(keys[1]))
+
+	// 不在同一个slot，发送之前就返回错误
+	res, err := NewCompositeLimiter(client, tiers).Allow(ctx, keys)
+	require.ErrorIs(t, err, restrictor.ErrCrossSlot)
+	require.False(t, res)
+
+	// 跳过客户端的检查，Redis集群同样拒绝
+	res, err = NewCompositeLimiter(client, tiers, WithCluster(false)).Allow(ctx, keys)
+	require.ErrorIs(t, err, restrictor.ErrBackendUnavailable)
+	require.True(t, strings.Contains(err.Error(), "CROSSSLOT"))
+	require.False(t, res)
+
+	// 通过hash tag放在同一个slot
+	limiter := NewCompositeLimiter(client, tiers, WithKeyPrefix("app:"), WithHashTag("composite"))
+	defer client.Del(ctx, "app:{composite}:cluster_user:1", "app:{composite}:cluster_global")
+	res, err = limiter.Allow(ctx, keys)
+	require.NoError(t, err)
+	require.True(t, res)
+	res, err = limiter.Allow(ctx, keys)
+	require.ErrorIs(t, err, restrictor.ErrLimitExceeded)
+	require.False(t, res)
+	d, ok := restrictor.DecisionOf(err)
+	require.True(t, ok)
+	require.Equal(t, int64(1), d.Limit)
+}
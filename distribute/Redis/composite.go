@@ -0,0 +1,131 @@
+package Redis
+
+import (
+	"context"
+	_ "embed"
+	"fmt"
+	"github.com/liquanhui-99/restrictor"
+	"github.com/redis/go-redis/v9"
+	"time"
+)
+
+//go:embed lua/composite.lua
+var compositeLua string
+
+// composite 组合限流的lua脚本，优先使用EVALSHA执行，Redis中没有缓存时退回EVAL
+var composite = redis.NewScript(compositeLua)
+
+// Tier 组合限流器中一个层级的令牌桶参数
+type Tier struct {
+	// Rate 每秒补充的令牌数量，可以是小数
+	Rate float64
+	// Burst 令牌桶的容量
+	Burst int64
+}
+
+// CompositeLimiter 基于Redis实现的多层级令牌桶限流器，请求需要同时通过所有层级，例如用户、租户和全局的限制，
+// 由一个lua脚本检查所有层级的令牌桶，任何一个层级拒绝时所有层级都不扣减。
+// 每个层级的key和TokenBucketLimiter的格式一致，Redis集群中所有层级的key需要在同一个slot，
+// 可以通过WithHashTag把所有的key放在同一个slot，或者在key中带上相同的{hash tag}
+type CompositeLimiter struct {
+	// Redis客户端
+	client redis.Cmdable
+	// tiers 每个层级的令牌桶参数，按照检查的顺序排列
+	tiers []Tier
+	// clock 获取当前请求时间戳的时钟
+	clock restrictor.Clock
+	// layout 限流器在Redis中的key格式
+	layout keyLayout
+	// cluster 是否需要检查所有key在同一个slot
+	cluster bool
+}
+
+// NewCompositeLimiter 初始化多层级令牌桶限流器，client是redis的客户端，tiers是每个层级的令牌桶参数
+func NewCompositeLimiter(client redis.Cmdable, tiers []Tier, opts ...Option) *CompositeLimiter {
+	o := newOptions(opts)
+	return &CompositeLimiter{
+		client:  client,
+		tiers:   tiers,
+		clock:   o.clock,
+		layout:  o.layout,
+		cluster: isCluster(client, o.cluster),
+	}
+}
+
+// Allow 是否允许请求通过所有层级，keys[i]是请求在第i个层级的key
+func (c *CompositeLimiter) Allow(ctx context.Context, keys []string) (bool, error) {
+	return c.AllowN(ctx, keys, 1)
+}
+
+// AllowN 是否允许请求在所有层级消耗n个令牌，n个令牌要么在所有层级全部扣减，要么一个都不扣减
+func (c *CompositeLimiter) AllowN(ctx context.Context, keys []string, n int64) (bool, error) {
+	d, err := c.Decide(ctx, keys, n)
+	if err != nil {
+		return false, err
+	}
+	if !d.Allowed {
+		return false, restrictor.NewLimitError(d)
+	}
+	return true, nil
+}
+
+// Decide 判定是否允许请求在所有层级消耗n个令牌，Limit和Remaining是拒绝的层级或者剩余令牌最少的层级的，
+// 被拒绝时RetryAfter是所有层级都补充出足够令牌的时间；keys的数量和层级的数量不一致时返回restrictor.ErrTierMismatch，
+// client是Redis集群的客户端并且keys不在同一个slot时返回restrictor.ErrCrossSlot
+func (c *CompositeLimiter) Decide(ctx context.Context, keys []string, n int64) (restrictor.Decision, error) {
+	if err := restrictor.CheckCount(n); err != nil {
+		return restrictor.Decision{}, err
+	}
+	if len(keys) != len(c.tiers) {
+		return restrictor.Decision{}, restrictor.ErrTierMismatch
+	}
+	now := c.clock.Now()
+	if len(c.tiers) == 0 {
+		// 没有层级，直接放行
+		return restrictor.Decision{Allowed: true, ResetAt: now, Limiter: restrictor.RedisComposite}, nil
+	}
+	keys = c.layout.keys(keys)
+	if c.cluster {
+		if err := checkSlot(keys); err != nil {
+			return restrictor.Decision{}, err
+		}
+	}
+	args := make([]interface{}, 0, 2+2*len(c.tiers))
+	args = append(args, now.UnixMilli(), n)
+	for _, tier := range c.tiers {
+		args = append(args, tier.Rate, tier.Burst)
+	}
+	res, err := composite.Run(ctx, c.client, keys, args...).Result()
+	if err != nil {
+		return restrictor.Decision{}, backendError(err)
+	}
+	nums, err := parseResult(res, 4)
+	if err != nil {
+		return restrictor.Decision{}, err
+	}
+	if nums[1] < 1 || nums[1] > int64(len(c.tiers)) {
+		return restrictor.Decision{}, fmt.Errorf("lua脚本返回了非预期的结果: %v", res)
+	}
+
+	tier := c.tiers[nums[1]-1]
+	d := restrictor.Decision{
+		Allowed:    nums[0] == 1,
+		Limit:      tier.Burst,
+		Remaining:  nums[2],
+		RetryAfter: time.Duration(nums[3]) * time.Millisecond,
+		Limiter:    restrictor.RedisComposite,
+	}
+	d.ResetAt = now.Add(d.RetryAfter)
+	if tier.Rate > 0 {
+		d.ResetAt = now.Add(time.Duration(float64(tier.Burst-d.Remaining) / tier.Rate * float64(time.Second)))
+	}
+	return d, nil
+}
+
+// Preload 把组合限流的lua脚本加载到Redis中，启动时调用，第一个请求不需要再发送脚本
+func (c *CompositeLimiter) Preload(ctx context.Context) error {
+	if err := composite.Load(ctx, c.client).Err(); err != nil {
+		return backendError(err)
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package Redis
+
+import (
+	"context"
+	"github.com/liquanhui-99/restrictor"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestCompositeLimiter_AllowN(t *testing.T) {
+	client := redis.NewClient(&redis.Options{
+		Addr:     "127.0.0.1:6379",
+		Password: "123456",
+	})
+
+	clock := restrictor.NewFakeClock(time.Now())
+	// 用户每秒1个，最多2个；租户每秒10个，最多3个
+	limit := NewCompositeLimiter(client, []Tier{{Rate: 1, Burst: 2}, {Rate: 10, Burst: 3}}, WithClock(clock))
+	u1, u2, tenant := "composite_u1", "composite_u2", "composite_tenant"
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	defer client.Del(ctx, u1, u2, tenant)
+
+	res, err := limit.AllowN(ctx, []string{u1, tenant}, 2)
+	require.NoError(t, err)
+	require.True(t, res)
+
+	// 用户的令牌不够
+	d, err := limit.Decide(ctx, []string{u1, tenant}, 1)
+	require.NoError(t, err)
+	require.False(t, d.Allowed)
+	require.Equal(t, int64(2), d.Limit)
+	require.Equal(t, int64(0), d.Remaining)
+	require.Equal(t, time.Second, d.RetryAfter)
+
+	// 租户的令牌不够，u2的令牌不扣减
+	d, err = limit.Decide(ctx, []string{u2, tenant}, 2)
+	require.NoError(t, err)
+	require.False(t, d.Allowed)
+	require.Equal(t, int64(3), d.Limit)
+	require.Equal(t, int64(1), d.Remaining)
+	require.Equal(t, 100*time.Millisecond, d.RetryAfter)
+	tokens, err := client.HGet(ctx, u2, "tokens").Result()
+	require.ErrorIs(t, err, redis.Nil)
+	require.Equal(t, "", tokens)
+
+	// 通过时返回剩余令牌最少的层级
+	d, err = limit.Decide(ctx, []string{u2, tenant}, 1)
+	require.NoError(t, err)
+	require.True(t, d.Allowed)
+	require.Equal(t, int64(3), d.Limit)
+	require.Equal(t, int64(0), d.Remaining)
+
+	// 超过容量永远不会通过
+	d, err = limit.Decide(ctx, []string{u2, tenant}, 3)
+	require.NoError(t, err)
+	require.False(t, d.Allowed)
+	require.Equal(t, time.Duration(0), d.RetryAfter)
+
+	_, err = limit.Allow(ctx, []string{u1})
+	require.ErrorIs(t, err, restrictor.ErrTierMismatch)
+}
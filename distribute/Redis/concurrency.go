@@ -0,0 +1,112 @@
+package Redis
+
+import (
+	"context"
+	"crypto/rand"
+	_ "embed"
+	"encoding/hex"
+	"github.com/liquanhui-99/restrictor"
+	"github.com/redis/go-redis/v9"
+	"sync"
+	"time"
+)
+
+//go:embed lua/concurrency.lua
+var concurrencyLua string
+
+// concurrency 并发限流的lua脚本，优先使用EVALSHA执行，Redis中没有缓存时退回EVAL
+var concurrency = redis.NewScript(concurrencyLua)
+
+// ConcurrencyLimiter 基于Redis实现的分布式并发限流器，限制所有实例同时处理的请求数量，
+// 每个请求持有一个有过期时间的租约，持有租约的进程崩溃以后位置会在租约过期时自动释放
+type ConcurrencyLimiter struct {
+	// Redis客户端
+	client redis.Cmdable
+	// mu 保护maxInFlight
+	mu sync.RWMutex
+	// 同时处理的最大请求数量
+	maxInFlight int64
+	// 租约的有效期，应该大于请求处理的最长时间
+	lease time.Duration
+	// clock 换算ResetAt使用的时钟，租约的过期时间按照Redis服务器的时间计算
+	clock restrictor.Clock
+	// layout 限流器在Redis中的key格式
+	layout keyLayout
+}
+
+// NewConcurrencyLimiter 初始化分布式并发限流器，client是redis的客户端，maxInFlight是同时处理的最大请求数量，
+// lease是租约的有效期，超过有效期没有释放的租约会被清理
+func NewConcurrencyLimiter(client redis.Cmdable, maxInFlight int64, lease time.Duration, opts ...Option) *ConcurrencyLimiter {
+	o := newOptions(opts)
+	return &ConcurrencyLimiter{
+		client:      client,
+		maxInFlight: maxInFlight,
+		lease:       lease,
+		clock:       o.clock,
+		layout:      o.layout,
+	}
+}
+
+// Acquire 获取key的一个处理请求的位置，成功时返回释放位置的函数，请求处理完以后调用，
+// 释放失败时租约也会在过期以后自动释放；没有位置时返回restrictor.LimitError，RetryAfter是最早的租约过期的时间
+func (c *ConcurrencyLimiter) Acquire(ctx context.Context, key string) (func(ctx context.Context) error, error) {
+	id, err := randomID()
+	if err != nil {
+		return nil, err
+	}
+	key = c.layout.key(key)
+	// 租约按照Redis服务器的时间计算，now只用来换算ResetAt
+	now := c.clock.Now()
+	c.mu.RLock()
+	maxInFlight := c.maxInFlight
+	c.mu.RUnlock()
+	res, err := concurrency.Run(ctx, c.client, []string{key}, maxInFlight, c.lease.Milliseconds(), id).Result()
+	if err != nil {
+		return nil, backendError(err)
+	}
+	nums, err := parseResult(res, 3)
+	if err != nil {
+		return nil, err
+	}
+	if nums[0] != 1 {
+		retry := time.Duration(nums[2]) * time.Millisecond
+		return nil, restrictor.NewLimitError(restrictor.Decision{
+			Limit:      maxInFlight,
+			Remaining:  0,
+			ResetAt:    now.Add(retry),
+			RetryAfter: retry,
+			Limiter:    restrictor.RedisConcurrency,
+		})
+	}
+	return func(ctx context.Context) error {
+		if err := c.client.ZRem(ctx, key, id).Err(); err != nil {
+			return backendError(err)
+		}
+		return nil
+	}, nil
+}
+
+// SetLimit 修改同时处理的最大请求数量，可以和Acquire并发调用，Redis中已经持有的租约不受影响，
+// 调小以后直到持有的租约数量低于新的上限才会有新的请求拿到位置
+func (c *ConcurrencyLimiter) SetLimit(maxInFlight int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.maxInFlight = maxInFlight
+}
+
+// randomID 生成随机的id，用作并发限流的租约id和滑动窗口中成员的后缀
+func randomID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// Preload 把并发限流的lua脚本加载到Redis中，启动时调用，第一个请求不需要再发送脚本
+func (c *ConcurrencyLimiter) Preload(ctx context.Context) error {
+	if err := concurrency.Load(ctx, c.client).Err(); err != nil {
+		return backendError(err)
+	}
+	return nil
+}
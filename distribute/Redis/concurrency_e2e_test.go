@@ -0,0 +1,118 @@
+package Redis
+
+import (
+	"context"
+	"github.com/liquanhui-99/restrictor"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestConcurrencyLimiter_Acquire(t *testing.T) {
+	client := redis.NewClient(&redis.Options{
+		Addr:     "127.0.0.1:6379",
+		Password: "123456",
+	})
+
+	clock := restrictor.NewFakeClock(time.Now())
+	limit := NewConcurrencyLimiter(client, 2, time.Minute, WithClock(clock))
+	key := "concurrency_acquire"
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	defer client.Del(ctx, key)
+
+	release, err := limit.Acquire(ctx, key)
+	require.NoError(t, err)
+	_, err = limit.Acquire(ctx, key)
+	require.NoError(t, err)
+
+	// 没有位置了，需要等到最早的租约过期
+	_, err = limit.Acquire(ctx, key)
+	require.ErrorIs(t, err, restrictor.ErrLimitExceeded)
+	d, ok := restrictor.DecisionOf(err)
+	require.True(t, ok)
+	require.Equal(t, int64(2), d.Limit)
+	require.Equal(t, restrictor.RedisConcurrency, d.Limiter)
+	// 按照Redis服务器的时间计算，两次请求之间会有几毫秒的间隔
+	require.InDelta(t, time.Minute, d.RetryAfter, float64(time.Second))
+
+	// 释放以后空出一个位置
+	require.NoError(t, release(ctx))
+	_, err = limit.Acquire(ctx, key)
+	require.NoError(t, err)
+}
+
+func TestConcurrencyLimiter_LeaseExpired(t *testing.T) {
+	client := redis.NewClient(&redis.Options{
+		Addr:     "127.0.0.1:6379",
+		Password: "123456",
+	})
+
+	limit := NewConcurrencyLimiter(client, 1, 200*time.Millisecond)
+	key := "concurrency_lease_expired"
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	defer client.Del(ctx, key)
+
+	// 持有租约的进程崩溃，没有释放
+	_, err := limit.Acquire(ctx, key)
+	require.NoError(t, err)
+	_, err = limit.Acquire(ctx, key)
+	require.ErrorIs(t, err, restrictor.ErrLimitExceeded)
+
+	// 租约按照Redis服务器的时间过期以后位置自动释放
+	time.Sleep(300 * time.Millisecond)
+	_, err = limit.Acquire(ctx, key)
+	require.NoError(t, err)
+}
+
+func TestConcurrencyLimiter_ClockSkew(t *testing.T) {
+	client := redis.NewClient(&redis.Options{
+		Addr:     "127.0.0.1:6379",
+		Password: "123456",
+	})
+
+	key := "concurrency_clock_skew"
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	defer client.Del(ctx, key)
+
+	_, err := NewConcurrencyLimiter(client, 1, time.Minute).Acquire(ctx, key)
+	require.NoError(t, err)
+	// 另一个实例的时钟快了一个小时，也不会清理掉还没有过期的租约
+	ahead := restrictor.NewFakeClock(time.Now().Add(time.Hour))
+	_, err = NewConcurrencyLimiter(client, 1, time.Minute, WithClock(ahead)).Acquire(ctx, key)
+	require.ErrorIs(t, err, restrictor.ErrLimitExceeded)
+}
+
+func TestConcurrencyLimiter_SetLimit(t *testing.T) {
+	client := redis.NewClient(&redis.Options{
+		Addr:     "127.0.0.1:6379",
+		Password: "123456",
+	})
+
+	limit := NewConcurrencyLimiter(client, 1, time.Minute)
+	key := "concurrency_set_limit"
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	defer client.Del(ctx, key)
+
+	release, err := limit.Acquire(ctx, key)
+	require.NoError(t, err)
+	_, err = limit.Acquire(ctx, key)
+	require.ErrorIs(t, err, restrictor.ErrLimitExceeded)
+
+	// 调大以后已经持有的租约保留
+	limit.SetLimit(2)
+	_, err = limit.Acquire(ctx, key)
+	require.NoError(t, err)
+	_, err = limit.Acquire(ctx, key)
+	require.ErrorIs(t, err, restrictor.ErrLimitExceeded)
+
+	// 调小以后释放一个也拿不到位置
+	limit.SetLimit(1)
+	require.NoError(t, release(ctx))
+	_, err = limit.Acquire(ctx, key)
+	require.ErrorIs(t, err, restrictor.ErrLimitExceeded)
+}
@@ -3,45 +3,137 @@ package Redis
 import (
 	"context"
 	_ "embed"
-	"errors"
+	"github.com/liquanhui-99/restrictor"
 	"github.com/redis/go-redis/v9"
+	"sync"
 	"time"
 )
 
 //go:embed lua/fixed_window.lua
-var fixedWindow string
+var fixedWindowLua string
+
+// fixedWindow 固定窗口的lua脚本，优先使用EVALSHA执行，Redis中没有缓存时退回EVAL
+var fixedWindow = redis.NewScript(fixedWindowLua)
 
 // FixedWindowLimiter 基于Redis的分布式限流器
 type FixedWindowLimiter struct {
 	// Redis客户端
 	client redis.Cmdable
+	// mu 保护maxCount和expiration
+	mu sync.RWMutex
 	// 窗口内最大的请求数量
 	maxCount int64
 	// 固定窗口的key过期时间
 	expiration time.Duration
+	// clock 获取时间的时钟
+	clock restrictor.Clock
+	// layout 限流器在Redis中的key格式
+	layout keyLayout
 }
 
 // NewFixedWindowLimiter 初始化固定窗口限流器，client redis的客户端，maxCount固定窗口内允许的最大请求数量
 // expiration 窗口的大小
-func NewFixedWindowLimiter(client redis.Cmdable, maxCount int64, expiration time.Duration) *FixedWindowLimiter {
+func NewFixedWindowLimiter(client redis.Cmdable, maxCount int64, expiration time.Duration, opts ...Option) *FixedWindowLimiter {
+	o := newOptions(opts)
 	return &FixedWindowLimiter{
 		client:     client,
 		maxCount:   maxCount,
 		expiration: expiration,
+		clock:      o.clock,
+		layout:     o.layout,
 	}
 }
 
 // Allow 是否允许通过限流器继续请求，key存储再Redis中的键，可以是单个接口，也可以是服务
-func (f FixedWindowLimiter) Allow(ctx context.Context, key string) (bool, error) {
-	res, err := f.client.Eval(ctx, fixedWindow, []string{key}, f.maxCount,
-		f.expiration.Milliseconds()).Result()
+func (f *FixedWindowLimiter) Allow(ctx context.Context, key string) (bool, error) {
+	return f.AllowN(ctx, key, 1)
+}
+
+// AllowN 是否允许消耗n个单位继续请求，由lua脚本保证n个单位要么全部消耗，要么一个都不消耗
+func (f *FixedWindowLimiter) AllowN(ctx context.Context, key string, n int64) (bool, error) {
+	d, err := f.Decide(ctx, key, n)
 	if err != nil {
 		return false, err
 	}
+	if !d.Allowed {
+		return false, restrictor.NewLimitError(d)
+	}
+	return true, nil
+}
 
-	if res.(string) == "true" {
-		return false, errors.New("到达性能瓶颈")
+// Decide 判定是否允许消耗n个单位继续请求，返回窗口内剩余的数量和窗口结束的时间
+func (f *FixedWindowLimiter) Decide(ctx context.Context, key string, n int64) (restrictor.Decision, error) {
+	if err := restrictor.CheckCount(n); err != nil {
+		return restrictor.Decision{}, err
 	}
+	args, decide := f.prepare()
+	res, err := fixedWindow.Run(ctx, f.client, []string{f.layout.key(key)}, args(n)...).Result()
+	if err != nil {
+		return restrictor.Decision{}, backendError(err)
+	}
+	return decide(res, n)
+}
 
-	return true, nil
+// AllowMany 在一次Redis往返中判定多个key，返回每个请求的判定结果，被拒绝的请求不影响其他的请求
+func (f *FixedWindowLimiter) AllowMany(ctx context.Context, reqs []Request) ([]restrictor.Decision, error) {
+	args, decide := f.prepare()
+	return decideMany(ctx, f.client, fixedWindow, f.layout, reqs, args, decide)
+}
+
+// prepare 复制当前的参数，返回lua脚本的参数和转换判定结果的函数，同一批请求使用相同的参数
+func (f *FixedWindowLimiter) prepare() (argsFunc, decideFunc) {
+	f.mu.RLock()
+	maxCount, expiration := f.maxCount, f.expiration
+	f.mu.RUnlock()
+	now := f.clock.Now()
+	args := func(n int64) []interface{} {
+		return []interface{}{maxCount, expiration.Milliseconds(), n}
+	}
+	decide := func(res interface{}, n int64) (restrictor.Decision, error) {
+		nums, err := parseResult(res, 3)
+		if err != nil {
+			return restrictor.Decision{}, err
+		}
+
+		ttl := time.Duration(nums[2]) * time.Millisecond
+		d := restrictor.Decision{
+			Allowed:   nums[0] == 1,
+			Limit:     maxCount,
+			Remaining: maxCount - nums[1],
+			ResetAt:   now.Add(ttl),
+			Limiter:   restrictor.RedisFixedWindow,
+		}
+		if d.Remaining < 0 {
+			// 调小maxCount以后窗口内已经通过的请求可能超过新的限制
+			d.Remaining = 0
+		}
+		if !d.Allowed && n <= maxCount {
+			// 等到窗口的key过期
+			d.RetryAfter = ttl
+		}
+		return d, nil
+	}
+	return args, decide
+}
+
+// SetLimit 修改窗口内允许的最大请求数量，Redis中当前窗口已经通过的请求数量保留，可以和Allow并发调用
+func (f *FixedWindowLimiter) SetLimit(maxCount int64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.maxCount = maxCount
+}
+
+// SetInterval 修改窗口的大小，Redis中当前的窗口按照原来的过期时间结束，之后的窗口使用新的大小
+func (f *FixedWindowLimiter) SetInterval(expiration time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.expiration = expiration
+}
+
+// Preload 把固定窗口的lua脚本加载到Redis中，启动时调用，第一个请求不需要再发送脚本
+func (f *FixedWindowLimiter) Preload(ctx context.Context) error {
+	if err := fixedWindow.Load(ctx, f.client).Err(); err != nil {
+		return backendError(err)
+	}
+	return nil
 }
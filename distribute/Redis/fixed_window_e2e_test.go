@@ -2,6 +2,7 @@ package Redis
 
 import (
 	"context"
+	"github.com/liquanhui-99/restrictor"
 	"github.com/redis/go-redis/v9"
 	"github.com/stretchr/testify/require"
 	"testing"
@@ -24,3 +25,91 @@ func TestFixedWindowLimiter_Allow(t *testing.T) {
 		require.True(t, res)
 	}
 }
+
+func TestFixedWindowLimiter_AllowN(t *testing.T) {
+	client := redis.NewClient(&redis.Options{
+		Addr:     "127.0.0.1:6379",
+		Password: "123456",
+	})
+
+	limit := NewFixedWindowLimiter(client, 100, time.Minute)
+	key := "fixed_window_allow_n"
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	defer client.Del(ctx, key)
+
+	res, err := limit.AllowN(ctx, key, 60)
+	require.NoError(t, err)
+	require.True(t, res)
+
+	// 剩余的数量不够，一个都不消耗
+	res, err = limit.AllowN(ctx, key, 50)
+	require.ErrorIs(t, err, restrictor.ErrLimitExceeded)
+	require.False(t, res)
+
+	res, err = limit.AllowN(ctx, key, 40)
+	require.NoError(t, err)
+	require.True(t, res)
+}
+
+func TestFixedWindowLimiter_Decide(t *testing.T) {
+	client := redis.NewClient(&redis.Options{
+		Addr:     "127.0.0.1:6379",
+		Password: "123456",
+	})
+
+	limit := NewFixedWindowLimiter(client, 100, time.Minute)
+	key := "fixed_window_decide"
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	defer client.Del(ctx, key)
+
+	d, err := limit.Decide(ctx, key, 60)
+	require.NoError(t, err)
+	require.True(t, d.Allowed)
+	require.Equal(t, int64(100), d.Limit)
+	require.Equal(t, int64(40), d.Remaining)
+	require.Equal(t, time.Duration(0), d.RetryAfter)
+
+	// 剩余的数量不够，需要等到窗口结束
+	d, err = limit.Decide(ctx, key, 50)
+	require.NoError(t, err)
+	require.False(t, d.Allowed)
+	require.Equal(t, int64(40), d.Remaining)
+	require.Greater(t, d.RetryAfter, 50*time.Second)
+	require.LessOrEqual(t, d.RetryAfter, time.Minute)
+}
+
+func TestFixedWindowLimiter_SetLimit(t *testing.T) {
+	client := redis.NewClient(&redis.Options{
+		Addr:     "127.0.0.1:6379",
+		Password: "123456",
+	})
+
+	limit := NewFixedWindowLimiter(client, 2, time.Minute)
+	key := "fixed_window_set_limit"
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	defer client.Del(ctx, key)
+
+	res, err := limit.AllowN(ctx, key, 2)
+	require.NoError(t, err)
+	require.True(t, res)
+
+	// 调大以后当前窗口已经通过的请求数量保留
+	limit.SetLimit(3)
+	res, err = limit.Allow(ctx, key)
+	require.NoError(t, err)
+	require.True(t, res)
+	res, err = limit.Allow(ctx, key)
+	require.ErrorIs(t, err, restrictor.ErrLimitExceeded)
+	require.False(t, res)
+
+	// 调小以后剩余的数量不会是负数
+	limit.SetLimit(1)
+	d, err := limit.Decide(ctx, key, 1)
+	require.NoError(t, err)
+	require.False(t, d.Allowed)
+	require.Equal(t, int64(1), d.Limit)
+	require.Equal(t, int64(0), d.Remaining)
+}
@@ -0,0 +1,143 @@
+package Redis
+
+import (
+	"context"
+	_ "embed"
+	"github.com/liquanhui-99/restrictor"
+	"github.com/redis/go-redis/v9"
+	"sync"
+	"time"
+)
+
+//go:embed lua/gcra.lua
+var gcraLua string
+
+// gcra GCRA的lua脚本，优先使用EVALSHA执行，Redis中没有缓存时退回EVAL
+var gcra = redis.NewScript(gcraLua)
+
+// GCRALimiter 基于Redis实现的GCRA限流器，每个key只保存一个理论到达时间，
+// 和滑动窗口相比不需要在ZSET中保存每一个请求，被拒绝时可以精确计算需要等待的时间
+type GCRALimiter struct {
+	// Redis客户端
+	client redis.Cmdable
+	// mu 保护period、limit和burst
+	mu sync.RWMutex
+	// 统计的周期
+	period time.Duration
+	// period内平均允许的请求数量
+	limit int64
+	// 允许的最大突发请求数量
+	burst int64
+	// clock 获取当前请求时间戳的时钟
+	clock restrictor.Clock
+	// layout 限流器在Redis中的key格式
+	layout keyLayout
+}
+
+// NewGCRALimiter 初始化GCRA限流器，client是redis的客户端，period内平均允许limit个请求，
+// burst是允许的最大突发请求数量，limit必须大于0
+func NewGCRALimiter(client redis.Cmdable, period time.Duration, limit int64, burst int64, opts ...Option) *GCRALimiter {
+	o := newOptions(opts)
+	return &GCRALimiter{
+		client: client,
+		period: period,
+		limit:  limit,
+		burst:  burst,
+		clock:  o.clock,
+		layout: o.layout,
+	}
+}
+
+// Allow 是否允许请求通过限流器，key是存在redis中的键，可以标识单个接口，也可以标识一个服务
+func (g *GCRALimiter) Allow(ctx context.Context, key string) (bool, error) {
+	return g.AllowN(ctx, key, 1)
+}
+
+// AllowN 是否允许n个请求继续，n个请求要么全部通过，要么全部拒绝
+func (g *GCRALimiter) AllowN(ctx context.Context, key string, n int64) (bool, error) {
+	d, err := g.Decide(ctx, key, n)
+	if err != nil {
+		return false, err
+	}
+	if !d.Allowed {
+		return false, restrictor.NewLimitError(d)
+	}
+	return true, nil
+}
+
+// Decide 判定是否允许n个请求继续，被拒绝时RetryAfter是理论上允许这n个请求的时间
+func (g *GCRALimiter) Decide(ctx context.Context, key string, n int64) (restrictor.Decision, error) {
+	if err := restrictor.CheckCount(n); err != nil {
+		return restrictor.Decision{}, err
+	}
+	args, decide := g.prepare()
+	res, err := gcra.Run(ctx, g.client, []string{g.layout.key(key)}, args(n)...).Result()
+	if err != nil {
+		return restrictor.Decision{}, backendError(err)
+	}
+	return decide(res, n)
+}
+
+// AllowMany 在一次Redis往返中判定多个key，返回每个请求的判定结果，被拒绝的请求不影响其他的请求
+func (g *GCRALimiter) AllowMany(ctx context.Context, reqs []Request) ([]restrictor.Decision, error) {
+	args, decide := g.prepare()
+	return decideMany(ctx, g.client, gcra, g.layout, reqs, args, decide)
+}
+
+// prepare 复制当前的参数，返回lua脚本的参数和转换判定结果的函数，同一批请求使用相同的参数
+func (g *GCRALimiter) prepare() (argsFunc, decideFunc) {
+	now := g.clock.Now()
+	g.mu.RLock()
+	// 两个请求之间的理论间隔
+	emission := float64(g.period/time.Duration(g.limit)) / float64(time.Millisecond)
+	burst := g.burst
+	g.mu.RUnlock()
+	args := func(n int64) []interface{} {
+		return []interface{}{emission, burst, now.UnixMilli(), n}
+	}
+	decide := func(res interface{}, n int64) (restrictor.Decision, error) {
+		nums, err := parseResult(res, 4)
+		if err != nil {
+			return restrictor.Decision{}, err
+		}
+
+		return restrictor.Decision{
+			Allowed:    nums[0] == 1,
+			Limit:      burst,
+			Remaining:  nums[1],
+			ResetAt:    now.Add(time.Duration(nums[3]) * time.Millisecond),
+			RetryAfter: time.Duration(nums[2]) * time.Millisecond,
+			Limiter:    restrictor.RedisGCRA,
+		}, nil
+	}
+	return args, decide
+}
+
+// SetLimit 修改period内平均允许的请求数量，limit必须大于0，Redis中的理论到达时间保留，可以和Allow并发调用
+func (g *GCRALimiter) SetLimit(limit int64) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.limit = limit
+}
+
+// SetInterval 修改统计的周期，可以和Allow并发调用
+func (g *GCRALimiter) SetInterval(period time.Duration) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.period = period
+}
+
+// SetBurst 修改允许的最大突发请求数量，可以和Allow并发调用
+func (g *GCRALimiter) SetBurst(burst int64) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.burst = burst
+}
+
+// Preload 把GCRA的lua脚本加载到Redis中，启动时调用，第一个请求不需要再发送脚本
+func (g *GCRALimiter) Preload(ctx context.Context) error {
+	if err := gcra.Load(ctx, g.client).Err(); err != nil {
+		return backendError(err)
+	}
+	return nil
+}
@@ -0,0 +1,144 @@
+package Redis
+
+import (
+	"context"
+	"github.com/liquanhui-99/restrictor"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestGCRALimiter_Allow(t *testing.T) {
+	client := redis.NewClient(&redis.Options{
+		Addr:     "127.0.0.1:6379",
+		Password: "123456",
+	})
+
+	clock := restrictor.NewFakeClock(time.Now())
+	limit := NewGCRALimiter(client, time.Second, 10, 5, WithClock(clock))
+	key := "gcra_allow"
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	defer client.Del(ctx, key)
+
+	// 一开始允许突发的请求
+	for i := 0; i < 5; i++ {
+		res, err := limit.Allow(ctx, key)
+		require.NoError(t, err)
+		require.True(t, res)
+	}
+	res, err := limit.Allow(ctx, key)
+	require.ErrorIs(t, err, restrictor.ErrLimitExceeded)
+	require.False(t, res)
+
+	// 10个每秒，100毫秒以后允许下一个请求
+	clock.Advance(100 * time.Millisecond)
+	res, err = limit.Allow(ctx, key)
+	require.NoError(t, err)
+	require.True(t, res)
+}
+
+func TestGCRALimiter_AllowN(t *testing.T) {
+	client := redis.NewClient(&redis.Options{
+		Addr:     "127.0.0.1:6379",
+		Password: "123456",
+	})
+
+	clock := restrictor.NewFakeClock(time.Now())
+	limit := NewGCRALimiter(client, time.Second, 10, 10, WithClock(clock))
+	key := "gcra_allow_n"
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	defer client.Del(ctx, key)
+
+	res, err := limit.AllowN(ctx, key, 6)
+	require.NoError(t, err)
+	require.True(t, res)
+
+	// 剩余的数量不够，一个都不消耗
+	res, err = limit.AllowN(ctx, key, 5)
+	require.ErrorIs(t, err, restrictor.ErrLimitExceeded)
+	require.False(t, res)
+
+	res, err = limit.AllowN(ctx, key, 4)
+	require.NoError(t, err)
+	require.True(t, res)
+}
+
+func TestGCRALimiter_Decide(t *testing.T) {
+	client := redis.NewClient(&redis.Options{
+		Addr:     "127.0.0.1:6379",
+		Password: "123456",
+	})
+
+	clock := restrictor.NewFakeClock(time.Now())
+	limit := NewGCRALimiter(client, time.Second, 10, 5, WithClock(clock))
+	key := "gcra_decide"
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	defer client.Del(ctx, key)
+
+	d, err := limit.Decide(ctx, key, 2)
+	require.NoError(t, err)
+	require.True(t, d.Allowed)
+	require.Equal(t, int64(5), d.Limit)
+	require.Equal(t, int64(3), d.Remaining)
+	require.Equal(t, restrictor.RedisGCRA, d.Limiter)
+	require.Equal(t, clock.Now().Add(200*time.Millisecond), d.ResetAt)
+
+	// 剩下的3个都用完以后，过了30毫秒再请求2个，需要等到第二个的理论到达时间
+	_, err = limit.Decide(ctx, key, 3)
+	require.NoError(t, err)
+	clock.Advance(30 * time.Millisecond)
+	d, err = limit.Decide(ctx, key, 2)
+	require.NoError(t, err)
+	require.False(t, d.Allowed)
+	require.Equal(t, int64(0), d.Remaining)
+	require.Equal(t, 170*time.Millisecond, d.RetryAfter)
+
+	// 超过突发的数量，重试也不会通过
+	d, err = limit.Decide(ctx, key, 6)
+	require.NoError(t, err)
+	require.False(t, d.Allowed)
+	require.Equal(t, time.Duration(0), d.RetryAfter)
+}
+
+func TestGCRALimiter_SetLimit(t *testing.T) {
+	client := redis.NewClient(&redis.Options{
+		Addr:     "127.0.0.1:6379",
+		Password: "123456",
+	})
+
+	clock := restrictor.NewFakeClock(time.Now())
+	// 每秒10个，允许突发2个
+	limit := NewGCRALimiter(client, time.Second, 10, 2, WithClock(clock))
+	key := "gcra_set_limit"
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	defer client.Del(ctx, key)
+
+	res, err := limit.AllowN(ctx, key, 2)
+	require.NoError(t, err)
+	require.True(t, res)
+
+	// 调大突发以后理论到达时间保留，可以再通过一个
+	limit.SetBurst(3)
+	res, err = limit.Allow(ctx, key)
+	require.NoError(t, err)
+	require.True(t, res)
+
+	// 调大数量以后间隔变成50毫秒，允许突发的范围变小
+	limit.SetLimit(20)
+	d, err := limit.Decide(ctx, key, 1)
+	require.NoError(t, err)
+	require.False(t, d.Allowed)
+	require.Equal(t, int64(3), d.Limit)
+	require.Equal(t, 200*time.Millisecond, d.RetryAfter)
+
+	// 调大周期以后间隔变成200毫秒，允许突发的范围变大
+	limit.SetInterval(4 * time.Second)
+	res, err = limit.Allow(ctx, key)
+	require.NoError(t, err)
+	require.True(t, res)
+}
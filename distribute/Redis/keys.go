@@ -0,0 +1,95 @@
+package Redis
+
+import (
+	"context"
+	"fmt"
+	"github.com/liquanhui-99/restrictor"
+	"github.com/redis/go-redis/v9"
+	"strings"
+)
+
+// slots Redis集群slot的数量
+const slots = 16384
+
+// keyLayout 限流器在Redis中的key格式，prefix+{hashTag}:key，没有hashTag时是prefix+key。
+// Redis集群只按照第一对{}中的内容计算slot，hashTag相同的key一定在同一个slot
+type keyLayout struct {
+	// prefix 所有key的前缀
+	prefix string
+	// hashTag 不为空时所有key都放在这个hash tag对应的slot
+	hashTag string
+}
+
+// key 调用方传入的key在Redis中的完整key
+func (l keyLayout) key(key string) string {
+	if l.hashTag == "" {
+		return l.prefix + key
+	}
+	return l.prefix + "{" + l.hashTag + "}:" + key
+}
+
+// keys 调用方传入的多个key在Redis中的完整key
+func (l keyLayout) keys(keys []string) []string {
+	res := make([]string, 0, len(keys))
+	for _, key := range keys {
+		res = append(res, l.key(key))
+	}
+	return res
+}
+
+// Slot 计算key在Redis集群中的slot，和CLUSTER KEYSLOT的结果一致，
+// key中有非空的{...}时只按照第一对{}中的内容计算
+func Slot(key string) int {
+	if start := strings.IndexByte(key, '{'); start >= 0 {
+		if end := strings.IndexByte(key[start+1:], '}'); end > 0 {
+			key = key[start+1 : start+1+end]
+		}
+	}
+	return int(crc16(key)) % slots
+}
+
+// crc16 Redis集群使用的CRC16算法(XMODEM)
+func crc16(s string) uint16 {
+	var crc uint16
+	for i := 0; i < len(s); i++ {
+		crc ^= uint16(s[i]) << 8
+		for j := 0; j < 8; j++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
+
+// clusterClient Redis集群客户端按照slot路由命令，*redis.ClusterClient、NewUniversalClient返回的集群客户端
+// 和内嵌了它们的类型都实现了这个接口
+type clusterClient interface {
+	MasterForKey(ctx context.Context, key string) (*redis.Client, error)
+}
+
+// isCluster client是不是Redis集群的客户端，cluster不为nil时以cluster为准，否则根据client是否实现了clusterClient判断
+func isCluster(client redis.Cmdable, cluster *bool) bool {
+	if cluster != nil {
+		return *cluster
+	}
+	_, ok := client.(clusterClient)
+	return ok
+}
+
+// checkSlot 检查多个key是否在同一个slot，不在时返回restrictor.ErrCrossSlot，
+// 避免lua脚本发送到Redis集群以后才返回CROSSSLOT错误
+func checkSlot(keys []string) error {
+	if len(keys) < 2 {
+		return nil
+	}
+	slot := Slot(keys[0])
+	for _, key := range keys[1:] {
+		if Slot(key) != slot {
+			return fmt.Errorf("%w: %s和%s", restrictor.ErrCrossSlot, keys[0], key)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,133 @@
+package Redis
+
+import (
+	"context"
+	"github.com/liquanhui-99/restrictor"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestSlot(t *testing.T) {
+	testCases := []struct {
+		name string
+		key  string
+		want int
+	}{
+		{name: "普通的key", key: "foo", want: 12182},
+		{name: "数字", key: "123456789", want: 12739},
+		{name: "hash tag", key: "{foo}.bar", want: 12182},
+		// 第一对{}中没有内容时按照整个key计算
+		{name: "空的hash tag", key: "foo{}{bar}", want: int(crc16("foo{}{bar}")) % slots},
+		{name: "只有第一对{}生效", key: "x{foo}{bar}", want: 12182},
+		{name: "没有闭合", key: "{foo", want: int(crc16("{foo")) % slots},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.want, Slot(tc.key))
+		})
+	}
+	require.NotEqual(t, Slot("foo"), Slot("foo{}{bar}"))
+}
+
+func TestKeyLayout_Key(t *testing.T) {
+	testCases := []struct {
+		name   string
+		layout keyLayout
+		key    string
+		want   string
+	}{
+		{name: "默认", key: "user:1", want: "user:1"},
+		{name: "前缀", layout: keyLayout{prefix: "app:"}, key: "user:1", want: "app:user:1"},
+		{name: "hash tag", layout: keyLayout{hashTag: "limit"}, key: "user:1", want: "{limit}:user:1"},
+		{name: "前缀和hash tag", layout: keyLayout{prefix: "app:", hashTag: "limit"}, key: "user:1", want: "app:{limit}:user:1"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.want, tc.layout.key(tc.key))
+		})
+	}
+}
+
+func TestCheckSlot(t *testing.T) {
+	testCases := []struct {
+		name    string
+		keys    []string
+		wantErr error
+	}{
+		{name: "单个key", keys: []string{"user:1"}},
+		{name: "同一个slot", keys: []string{"{t}:user:1", "{t}:tenant:1", "{t}:global"}},
+		{name: "不同的slot", keys: []string{"user:1", "global"}, wantErr: restrictor.ErrCrossSlot},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			require.ErrorIs(t, checkSlot(tc.keys), tc.wantErr)
+		})
+	}
+}
+
+// wrappedClient 内嵌了集群客户端的包装类型
+type wrappedClient struct {
+	*redis.ClusterClient
+}
+
+// hiddenClient 只暴露redis.Cmdable的包装类型，无法识别是不是集群
+type hiddenClient struct {
+	redis.Cmdable
+}
+
+func TestIsCluster(t *testing.T) {
+	cluster := redis.NewClusterClient(&redis.ClusterOptions{Addrs: []string{"127.0.0.1:1"}})
+	defer cluster.Close()
+	universal := redis.NewUniversalClient(&redis.UniversalOptions{Addrs: []string{"127.0.0.1:1", "127.0.0.1:2"}})
+	defer universal.Close()
+	single := redis.NewClient(&redis.Options{Addr: "127.0.0.1:1"})
+	defer single.Close()
+	yes, no := true, false
+	testCases := []struct {
+		name    string
+		client  redis.Cmdable
+		cluster *bool
+		want    bool
+	}{
+		{name: "集群", client: cluster, want: true},
+		{name: "UniversalClient", client: universal, want: true},
+		{name: "内嵌集群客户端", client: wrappedClient{cluster}, want: true},
+		{name: "包装以后无法识别", client: hiddenClient{cluster}, want: false},
+		{name: "通过选项指定是集群", client: hiddenClient{cluster}, cluster: &yes, want: true},
+		{name: "通过选项指定不是集群", client: cluster, cluster: &no, want: false},
+		// 单节点的Redis不限制多个key的slot
+		{name: "不是集群", client: single, want: false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.want, isCluster(tc.client, tc.cluster))
+		})
+	}
+}
+
+func TestCompositeLimiter_CrossSlot(t *testing.T) {
+	// 在发送到Redis之前检查slot，不需要连接集群
+	cluster := redis.NewClusterClient(&redis.ClusterOptions{Addrs: []string{"127.0.0.1:1"}})
+	defer cluster.Close()
+	tiers := []Tier{{Rate: 1, Burst: 1}, {Rate: 10, Burst: 10}}
+	testCases := []struct {
+		name   string
+		client redis.Cmdable
+		opts   []Option
+	}{
+		{name: "集群", client: cluster},
+		{name: "内嵌集群客户端", client: wrappedClient{cluster}},
+		{name: "通过选项指定", client: hiddenClient{cluster}, opts: []Option{WithCluster(true)}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			res, err := NewCompositeLimiter(tc.client, tiers, tc.opts...).Allow(ctx, []string{"user:1", "global"})
+			require.ErrorIs(t, err, restrictor.ErrCrossSlot)
+			require.False(t, res)
+		})
+	}
+}
@@ -0,0 +1,72 @@
+---
+--- 多层级令牌桶限流，每个KEYS是一个层级的令牌桶，hash的格式和令牌桶限流一致，
+--- 所有层级的令牌都足够时才一起扣减，任何一个层级不够时都不扣减，保证整个层级要么全部通过，要么全部拒绝
+--- 返回值是{是否通过(1通过，0限流), 层级(从1开始，限流时是第一个拒绝的层级，通过时是剩余令牌最少的层级),
+--- 这个层级剩余的令牌数量, 需要等待的毫秒数}
+---
+--- 当前请求的时间戳，单位是毫秒
+local now = tonumber(ARGV[1])
+--- 本次请求消耗的令牌数量
+local n = tonumber(ARGV[2])
+--- 之后每两个参数是一个层级每秒补充的令牌数量和令牌桶的容量
+
+local tokens = {}
+local stamps = {}
+local rejected = 0
+local retry = 0
+local never = false
+for i, key in ipairs(KEYS) do
+    local rate = tonumber(ARGV[2 * i + 1])
+    local burst = tonumber(ARGV[2 * i + 2])
+    local bucket = redis.call("HMGET", key, "tokens", "ts")
+    local t = tonumber(bucket[1])
+    local ts = tonumber(bucket[2])
+    if t == nil or ts == nil then
+        --- 第一次请求，令牌桶是满的
+        t = burst
+        ts = now
+    end
+    if now > ts then
+        t = t + (now - ts) * rate / 1000
+        ts = now
+    end
+    t = math.min(burst, t)
+    tokens[i] = t
+    stamps[i] = ts
+
+    if t < n then
+        if rejected == 0 then
+            rejected = i
+        end
+        if n > burst or rate <= 0 then
+            --- 这个层级永远不会有足够的令牌
+            never = true
+        else
+            --- 需要等到所有层级都补充出足够的令牌
+            retry = math.max(retry, math.ceil((n - t) * 1000 / rate))
+        end
+    end
+end
+
+if rejected > 0 then
+    if never then
+        retry = 0
+    end
+    return { 0, rejected, math.floor(tokens[rejected]), retry }
+end
+
+local tier = 1
+for i, key in ipairs(KEYS) do
+    local rate = tonumber(ARGV[2 * i + 1])
+    local burst = tonumber(ARGV[2 * i + 2])
+    tokens[i] = tokens[i] - n
+    if tokens[i] < tokens[tier] then
+        tier = i
+    end
+    redis.call("HSET", key, "tokens", tokens[i], "ts", stamps[i])
+    if rate > 0 then
+        --- 令牌桶装满以后和不存在是一样的，可以过期
+        redis.call("PEXPIRE", key, math.ceil((burst - tokens[i]) * 1000 / rate) + 1000)
+    end
+end
+return { 1, tier, math.floor(tokens[tier]), 0 }
@@ -0,0 +1,39 @@
+---
+--- 并发限流，ZSET中保存正在处理的请求，member是租约的id，score是租约过期的时间，
+--- 持有租约的进程崩溃以后租约会自动过期，不会一直占用位置
+--- 返回值是{是否通过(1通过，0限流), 正在处理的请求数量, 最早的租约过期的毫秒数}
+---
+--- 限流的key
+local key = KEYS[1]
+--- 同时处理的最大请求数量
+local limit = tonumber(ARGV[1])
+--- 租约的有效期，单位是毫秒
+local ttl = tonumber(ARGV[2])
+--- 租约的id
+local id = ARGV[3]
+
+--- 使用Redis服务器的时间，某个实例的时钟走快了也不会清理掉其他实例还没有过期的租约。
+--- TIME的结果每次都不一样，需要按照效果复制写命令，Redis 5以后默认就是效果复制
+if redis.replicate_commands then
+    redis.replicate_commands()
+end
+local time = redis.call("TIME")
+--- 当前请求的时间戳，单位是毫秒
+local now = tonumber(time[1]) * 1000 + math.floor(tonumber(time[2]) / 1000)
+
+--- 清理已经过期的租约
+redis.call("ZREMRANGEBYSCORE", key, "-inf", now)
+local cnt = redis.call("ZCARD", key)
+if cnt < limit then
+    redis.call("ZADD", key, now + ttl, id)
+    --- 新的租约是最晚过期的，key跟着它过期
+    redis.call("PEXPIRE", key, ttl)
+    return { 1, cnt + 1, 0 }
+end
+
+local first = redis.call("ZRANGE", key, 0, 0, "WITHSCORES")
+local retry = 0
+if #first == 2 then
+    retry = tonumber(first[2]) - now
+end
+return { 0, cnt, retry }
\ No newline at end of file
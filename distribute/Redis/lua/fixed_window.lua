@@ -3,27 +3,37 @@
 --- Created by liquanhui.
 --- DateTime: 2023/9/5 12:31
 ---
+--- 返回值是{是否通过(1通过，0限流), 窗口内的请求数量, 窗口剩余的毫秒数}
 --- 缓存中是否有这个key的限流：key可以是服务，也可以是接口
 local val = redis.call("GET", KEYS[1])
 --- 最大的限流数
 local limit = tonumber(ARGV[1])
---- key的超时时间
+--- key的超时时间，单位是毫秒
 local expiration = tonumber(ARGV[2])
+--- 本次请求消耗的数量
+local n = tonumber(ARGV[3])
 
 if val == false then
-    if limit < 1 then
+    if n > limit then
         -- 执行限流
-        return "true"
+        return { 0, 0, 0 }
     else
         -- 通过限流器
-        redis.call("SET", KEYS[1], 1, "EX", expiration)
-        return "false"
+        redis.call("SET", KEYS[1], n, "PX", expiration)
+        return { 1, n, expiration }
     end
-elseif tonumber(val) < limit then
-    -- 存在限流对象，但是还未到阈值，可以通过限流器
-    redis.call("INCR", KEYS[1])
-    return "false"
+end
+
+local cnt = tonumber(val)
+local ttl = redis.call("PTTL", KEYS[1])
+if ttl < 0 then
+    ttl = 0
+end
+if cnt + n <= limit then
+    -- 存在限流对象，但是加上本次请求也未到阈值，可以通过限流器
+    cnt = redis.call("INCRBY", KEYS[1], n)
+    return { 1, cnt, ttl }
 else
     -- 执行限流
-    return "true"
+    return { 0, cnt, ttl }
 end
\ No newline at end of file
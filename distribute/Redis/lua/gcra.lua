@@ -0,0 +1,36 @@
+---
+--- GCRA限流，key中只保存理论到达时间(TAT)，单位是毫秒
+--- 返回值是{是否通过(1通过，0限流), 剩余的突发请求数量, 需要等待的毫秒数, 恢复到突发数量的毫秒数}
+---
+--- 限流的key
+local key = KEYS[1]
+--- 两个请求之间的理论间隔，单位是毫秒，可以是小数
+local emission = tonumber(ARGV[1])
+--- 允许的最大突发请求数量
+local burst = tonumber(ARGV[2])
+--- 当前请求的时间戳，单位是毫秒
+local now = tonumber(ARGV[3])
+--- 本次请求的数量
+local n = tonumber(ARGV[4])
+
+local tat = tonumber(redis.call("GET", key))
+if tat == nil or tat < now then
+    tat = now
+end
+
+--- 允许突发的时间范围
+local tolerance = burst * emission
+local new_tat = tat + n * emission
+local allow_at = new_tat - tolerance
+
+if n <= burst and allow_at <= now then
+    --- 通过限流器，理论到达时间以后key就没有意义了
+    redis.call("SET", key, new_tat, "PX", math.ceil(new_tat - now))
+    return { 1, math.floor((now - allow_at) / emission), 0, math.ceil(new_tat - now) }
+end
+
+local retry = 0
+if n <= burst then
+    retry = math.ceil(allow_at - now)
+end
+return { 0, math.floor((now - tat + tolerance) / emission), retry, math.ceil(tat - now) }
\ No newline at end of file
@@ -3,14 +3,26 @@
 --- Created by liquanhui.
 --- DateTime: 2023/9/5 13:06
 ---
+--- 返回值是{是否通过(1通过，0限流), 窗口内的请求数量, 需要等待的毫秒数, 窗口内请求全部滑出的毫秒数}
 --- 缓存中的key
 local key = KEYS[1]
 --- 窗口的大小
 local window = tonumber(ARGV[1])
 --- 阈值
 local threshold = tonumber(ARGV[2])
---- 当前请求的时间戳
-local now = tonumber(ARGV[3])
+--- 本次请求消耗的数量
+local n = tonumber(ARGV[3])
+--- 本次请求的唯一标识，同一毫秒内的多个请求的成员互不相同
+local id = ARGV[4]
+
+--- 使用Redis服务器的时间，不受各个实例时钟偏差的影响。
+--- TIME的结果每次都不一样，需要按照效果复制写命令，Redis 5以后默认就是效果复制
+if redis.replicate_commands then
+    redis.replicate_commands()
+end
+local time = redis.call("TIME")
+--- 当前请求的时间戳，单位是毫秒
+local now = tonumber(time[1]) * 1000 + math.floor(tonumber(time[2]) / 1000)
 --- 窗口的最小时间戳
 local min = now - window
 
@@ -19,11 +31,26 @@ redis.call("ZREMRANGEBYSCORE", key, "-inf", min)
 --- 获取集合中的请求数量
 local cnt = redis.call("ZCOUNT", key, "-inf", "+inf")
 
-if cnt >= threshold then
-    --- 达到了滑动窗口内的最大请求数量，执行限流
-    return "true"
+if cnt + n > threshold then
+    --- 加上本次请求会超过滑动窗口内的最大请求数量，执行限流
+    local retry = 0
+    if n <= threshold then
+        --- 需要等到第cnt+n-threshold个请求滑出窗口才放得下本次请求
+        local idx = cnt + n - threshold - 1
+        local oldest = redis.call("ZRANGE", key, idx, idx, "WITHSCORES")
+        retry = tonumber(oldest[2]) + window - now
+    end
+    local reset = 0
+    local newest = redis.call("ZRANGE", key, -1, -1, "WITHSCORES")
+    if newest[2] then
+        reset = tonumber(newest[2]) + window - now
+    end
+    return { 0, cnt, retry, reset }
 else
-    redis.call("ZADD", key, now, now)
+    --- 每个单位记录一个成员，成员需要互不相同，同一毫秒内的请求也不能覆盖
+    for i = 1, n do
+        redis.call("ZADD", key, now, id .. ":" .. i)
+    end
     redis.call("PEXPIRE", key, window)
-    return "false"
+    return { 1, cnt + n, 0, window }
 end
\ No newline at end of file
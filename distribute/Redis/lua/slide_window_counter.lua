@@ -0,0 +1,70 @@
+---
+--- 滑动窗口计数器限流，hash中只保存当前窗口的起始时间start、上一个窗口的请求数量prev和当前窗口的请求数量curr，
+--- 按照上一个窗口和滑动窗口重叠的比例估算滑动窗口内的请求数量
+--- 返回值是{是否通过(1通过，0限流), 剩余的数量, 需要等待的毫秒数, 请求全部滑出窗口的毫秒数}
+---
+--- 限流的key
+local key = KEYS[1]
+--- 窗口的大小，单位是毫秒
+local interval = tonumber(ARGV[1])
+--- 滑动窗口内允许的最大请求数量
+local limit = tonumber(ARGV[2])
+--- 当前请求的时间戳，单位是毫秒
+local now = tonumber(ARGV[3])
+--- 本次请求消耗的数量
+local n = tonumber(ARGV[4])
+
+local window = redis.call("HMGET", key, "start", "prev", "curr")
+local start = tonumber(window[1]) or 0
+local prev = tonumber(window[2]) or 0
+local curr = tonumber(window[3]) or 0
+
+--- 切换到now所在的窗口
+local current = now - now % interval
+if start % interval ~= 0 then
+    --- 修改了窗口的大小，按照新的大小重新对齐，已经很久没有请求时之前的请求都不在滑动窗口内了
+    if now - start >= 2 * interval then
+        prev = 0
+        curr = 0
+    end
+    start = current
+elseif current == start + interval then
+    prev = curr
+    curr = 0
+    start = current
+elseif current > start then
+    --- 中间间隔了完整的窗口，之前的请求都不在滑动窗口内了
+    prev = 0
+    curr = 0
+    start = current
+end
+
+local elapsed = now - start
+local estimate = prev * (interval - elapsed) / interval + curr
+local allowed = 0
+local retry = 0
+if estimate + n <= limit then
+    allowed = 1
+    curr = curr + n
+    estimate = estimate + n
+elseif n <= limit then
+    local free = limit - curr - n
+    if free >= 0 then
+        --- 当前窗口内上一个窗口的请求滑出去就够了
+        retry = math.ceil(interval - free * interval / prev - elapsed)
+    else
+        --- 需要等到下一个窗口，当前窗口的请求滑出去一部分
+        retry = interval - elapsed + math.ceil(interval * (1 - (limit - n) / curr))
+    end
+end
+
+redis.call("HSET", key, "start", start, "prev", prev, "curr", curr)
+redis.call("PEXPIRE", key, 2 * interval)
+
+local reset = 0
+if curr > 0 then
+    reset = start + 2 * interval - now
+elseif prev > 0 then
+    reset = start + interval - now
+end
+return { allowed, math.max(math.floor(limit - estimate), 0), retry, reset }
\ No newline at end of file
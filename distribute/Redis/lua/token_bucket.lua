@@ -0,0 +1,54 @@
+---
+--- 令牌桶限流，hash中保存令牌数量tokens和最近一次补充令牌的时间ts
+--- 返回值是{是否通过(1通过，0限流), 剩余的令牌数量, 需要等待的毫秒数, 令牌桶装满的毫秒数}
+---
+--- 令牌桶的key
+local key = KEYS[1]
+--- 每秒补充的令牌数量，可以是小数
+local rate = tonumber(ARGV[1])
+--- 令牌桶的容量
+local burst = tonumber(ARGV[2])
+--- 当前请求的时间戳，单位是毫秒
+local now = tonumber(ARGV[3])
+--- 本次请求消耗的令牌数量
+local n = tonumber(ARGV[4])
+
+local bucket = redis.call("HMGET", key, "tokens", "ts")
+local tokens = tonumber(bucket[1])
+local ts = tonumber(bucket[2])
+if tokens == nil or ts == nil then
+    --- 第一次请求，令牌桶是满的
+    tokens = burst
+    ts = now
+end
+
+--- 根据经过的时间补充令牌，时间不能倒退
+if now > ts then
+    tokens = tokens + (now - ts) * rate / 1000
+    ts = now
+end
+--- 修改了容量以后超过容量的令牌丢弃
+tokens = math.min(burst, tokens)
+
+local allowed = 0
+local retry = 0
+if tokens >= n then
+    --- 令牌足够，通过限流器
+    tokens = tokens - n
+    allowed = 1
+elseif n <= burst and rate > 0 then
+    --- 执行限流，计算补充出足够令牌的时间
+    retry = math.ceil((n - tokens) * 1000 / rate)
+end
+
+local fill = 0
+if rate > 0 then
+    fill = math.ceil((burst - tokens) * 1000 / rate)
+end
+
+redis.call("HSET", key, "tokens", tokens, "ts", ts)
+if rate > 0 then
+    --- 令牌桶装满以后和不存在是一样的，可以过期
+    redis.call("PEXPIRE", key, fill + 1000)
+end
+return { allowed, math.floor(tokens), retry, fill }
\ No newline at end of file
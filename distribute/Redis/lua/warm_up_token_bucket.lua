@@ -0,0 +1,72 @@
+---
+--- 带预热的令牌桶限流，参考Guava的SmoothWarmingUp，hash中保存积攒的令牌数量stored和下一个请求可以通过的时间next，
+--- 积攒的令牌超过threshold时发放间隔线性增加，空闲以后重新积攒令牌回到冷启动的状态
+--- 返回值是{是否通过(1通过，0限流), 需要等待的毫秒数, 下一个请求可以通过的毫秒数}
+---
+--- 令牌桶的key
+local key = KEYS[1]
+--- 稳定时发放令牌的间隔，单位是毫秒，可以是小数
+local stable = tonumber(ARGV[1])
+--- 从冷启动加速到稳定速率的时间，单位是毫秒
+local warmup = tonumber(ARGV[2])
+--- 当前请求的时间戳，单位是毫秒
+local now = tonumber(ARGV[3])
+--- 本次请求消耗的令牌数量
+local n = tonumber(ARGV[4])
+
+--- 冷启动时发放令牌的间隔是稳定间隔的3倍
+local cold = stable * 3
+local threshold = 0.5 * warmup / stable
+local max_permits = threshold + 2 * warmup / (stable + cold)
+local slope = 0
+if max_permits > threshold then
+    slope = (cold - stable) / (max_permits - threshold)
+end
+local cool_down = 0
+if max_permits > 0 then
+    cool_down = warmup / max_permits
+end
+
+local bucket = redis.call("HMGET", key, "stored", "next")
+local stored = tonumber(bucket[1])
+local next_free = tonumber(bucket[2])
+if stored == nil or next_free == nil then
+    --- 第一次请求，处于冷启动的状态
+    stored = max_permits
+    next_free = now
+end
+
+--- 根据空闲的时间积攒令牌
+if now > next_free then
+    if cool_down > 0 then
+        stored = stored + (now - next_free) / cool_down
+    end
+    next_free = now
+end
+--- 修改了速率以后超过上限的令牌丢弃
+stored = math.min(max_permits, stored)
+
+if next_free > now then
+    --- 上一个请求的令牌还没有发放完
+    return { 0, math.ceil(next_free - now), math.ceil(next_free - now) }
+end
+
+--- 优先使用积攒的令牌，超过threshold的部分按照梯形的面积计算发放时间
+local spend = math.min(n, stored)
+local fresh = n - spend
+local wait = 0
+local above = stored - threshold
+local take = spend
+if above > 0 then
+    local in_above = math.min(above, take)
+    wait = in_above * (2 * stable + (2 * above - in_above) * slope) / 2
+    take = take - in_above
+end
+wait = wait + stable * take + fresh * stable
+stored = stored - spend
+next_free = next_free + wait
+
+redis.call("HSET", key, "stored", stored, "next", next_free)
+--- 积攒满令牌以后和不存在是一样的，可以过期
+redis.call("PEXPIRE", key, math.ceil(next_free - now + (max_permits - stored) * cool_down) + 1000)
+return { 1, 0, math.ceil(next_free - now) }
\ No newline at end of file
@@ -0,0 +1,58 @@
+package Redis
+
+import "github.com/liquanhui-99/restrictor"
+
+// Option 基于Redis的分布式限流器的配置项，所有构造函数都可以传入
+type Option func(*options)
+
+type options struct {
+	// clock 获取时间和创建定时器的时钟
+	clock restrictor.Clock
+	// layout 限流器在Redis中的key格式
+	layout keyLayout
+	// cluster 客户端是不是Redis集群的客户端，nil时根据客户端的类型判断
+	cluster *bool
+}
+
+// WithClock 替换限流器使用的时钟，默认是restrictor.RealClock，测试时可以传入restrictor.FakeClock
+func WithClock(clock restrictor.Clock) Option {
+	return func(o *options) {
+		o.clock = clock
+	}
+}
+
+// WithKeyPrefix 给限流器在Redis中的所有key加上前缀，多个服务共用一个Redis时避免冲突
+func WithKeyPrefix(prefix string) Option {
+	return func(o *options) {
+		o.layout.prefix = prefix
+	}
+}
+
+// WithHashTag 把限流器在Redis中的所有key放在hashTag对应的slot，key的格式是prefix+{hashTag}:key。
+// Redis集群中CompositeLimiter等一个lua脚本访问多个key的限流器需要设置，否则返回restrictor.ErrCrossSlot；
+// 所有key都会落在同一个节点，单key的限流器不建议设置
+func WithHashTag(hashTag string) Option {
+	return func(o *options) {
+		o.layout.hashTag = hashTag
+	}
+}
+
+// WithCluster 指定客户端是不是Redis集群的客户端，是集群时CompositeLimiter在发送lua脚本之前检查所有key是否在同一个slot。
+// 默认根据客户端有没有MasterForKey方法判断，*redis.ClusterClient、NewUniversalClient返回的集群客户端和内嵌了它们的类型
+// 都可以识别，其他方式包装的集群客户端需要通过这个选项指定
+func WithCluster(cluster bool) Option {
+	return func(o *options) {
+		o.cluster = &cluster
+	}
+}
+
+// newOptions 在默认配置的基础上应用opts
+func newOptions(opts []Option) options {
+	o := options{
+		clock: restrictor.RealClock,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
@@ -0,0 +1,34 @@
+package Redis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/liquanhui-99/restrictor"
+)
+
+// parseResult 把lua脚本返回的整数数组转换成[]int64，size是期望的数组长度
+func parseResult(res interface{}, size int) ([]int64, error) {
+	vals, ok := res.([]interface{})
+	if !ok || len(vals) != size {
+		return nil, fmt.Errorf("lua脚本返回了非预期的结果: %v", res)
+	}
+	nums := make([]int64, 0, size)
+	for _, val := range vals {
+		num, ok := val.(int64)
+		if !ok {
+			return nil, fmt.Errorf("lua脚本返回了非预期的结果: %v", res)
+		}
+		nums = append(nums, num)
+	}
+	return nums, nil
+}
+
+// backendError 把Redis返回的错误包装成restrictor.BackendError，
+// ctx取消或者超时的错误原样返回，方便调用方区分
+func backendError(err error) error {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return err
+	}
+	return restrictor.NewBackendError(err)
+}
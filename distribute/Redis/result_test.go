@@ -0,0 +1,69 @@
+package Redis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/go-playground/assert/v2"
+	"github.com/liquanhui-99/restrictor"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestParseResult(t *testing.T) {
+	testCases := []struct {
+		name    string
+		res     interface{}
+		size    int
+		wantRes []int64
+		wantErr error
+	}{
+		{
+			name:    "success",
+			res:     []interface{}{int64(1), int64(10), int64(6000)},
+			size:    3,
+			wantRes: []int64{1, 10, 6000},
+		},
+		// 旧版本脚本返回的字符串
+		{
+			name:    "string",
+			res:     "false",
+			size:    3,
+			wantErr: fmt.Errorf("lua脚本返回了非预期的结果: %v", "false"),
+		},
+		// 长度不对
+		{
+			name:    "size",
+			res:     []interface{}{int64(1), int64(10)},
+			size:    3,
+			wantErr: fmt.Errorf("lua脚本返回了非预期的结果: %v", []interface{}{int64(1), int64(10)}),
+		},
+		// 元素不是整数
+		{
+			name:    "element",
+			res:     []interface{}{int64(1), "10", int64(6000)},
+			size:    3,
+			wantErr: fmt.Errorf("lua脚本返回了非预期的结果: %v", []interface{}{int64(1), "10", int64(6000)}),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			res, err := parseResult(tc.res, tc.size)
+			assert.Equal(t, tc.wantErr, err)
+			assert.Equal(t, tc.wantRes, res)
+		})
+	}
+}
+
+func TestBackendError(t *testing.T) {
+	// Redis不可用
+	cause := errors.New("dial tcp 127.0.0.1:6379: connect: connection refused")
+	err := backendError(cause)
+	require.ErrorIs(t, err, restrictor.ErrBackendUnavailable)
+	require.ErrorIs(t, err, cause)
+
+	// ctx的错误原样返回
+	assert.Equal(t, context.DeadlineExceeded, backendError(context.DeadlineExceeded))
+	assert.Equal(t, context.Canceled, backendError(context.Canceled))
+}
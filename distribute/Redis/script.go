@@ -0,0 +1,30 @@
+package Redis
+
+import (
+	"context"
+	"github.com/redis/go-redis/v9"
+)
+
+// scripts 包中所有限流器使用的lua脚本
+var scripts = []*redis.Script{
+	fixedWindow,
+	slideWindow,
+	slideWindowCounter,
+	tokenBucket,
+	warmUpTokenBucket,
+	gcra,
+	concurrency,
+	composite,
+}
+
+// Preload 把包中所有的lua脚本加载到Redis中，启动时调用，之后的请求只发送脚本的SHA1。
+// 不调用Preload也可以正常工作，Redis中没有缓存脚本时会自动退回EVAL并缓存，
+// Redis重启或者执行SCRIPT FLUSH以后同样会自动恢复
+func Preload(ctx context.Context, client redis.Cmdable) error {
+	for _, script := range scripts {
+		if err := script.Load(ctx, client).Err(); err != nil {
+			return backendError(err)
+		}
+	}
+	return nil
+}
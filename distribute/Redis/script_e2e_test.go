@@ -0,0 +1,54 @@
+package Redis
+
+import (
+	"context"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestPreload(t *testing.T) {
+	client := redis.NewClient(&redis.Options{
+		Addr:     "127.0.0.1:6379",
+		Password: "123456",
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	require.NoError(t, client.ScriptFlush(ctx).Err())
+	require.NoError(t, Preload(ctx, client))
+	for _, script := range scripts {
+		exists, err := script.Exists(ctx, client).Result()
+		require.NoError(t, err)
+		require.Equal(t, []bool{true}, exists)
+	}
+}
+
+func TestFixedWindowLimiter_NoScript(t *testing.T) {
+	client := redis.NewClient(&redis.Options{
+		Addr:     "127.0.0.1:6379",
+		Password: "123456",
+	})
+	limiter := NewFixedWindowLimiter(client, 10, time.Minute)
+	key := "fixed_window_no_script"
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	defer client.Del(ctx, key)
+
+	// Redis中没有缓存脚本时退回EVAL，之后脚本已经缓存
+	require.NoError(t, client.ScriptFlush(ctx).Err())
+	res, err := limiter.Allow(ctx, key)
+	require.NoError(t, err)
+	require.True(t, res)
+	exists, err := fixedWindow.Exists(ctx, client).Result()
+	require.NoError(t, err)
+	require.Equal(t, []bool{true}, exists)
+
+	// Preload以后直接使用EVALSHA
+	require.NoError(t, client.ScriptFlush(ctx).Err())
+	require.NoError(t, limiter.Preload(ctx))
+	res, err = limiter.Allow(ctx, key)
+	require.NoError(t, err)
+	require.True(t, res)
+}
@@ -0,0 +1,37 @@
+package Redis
+
+import (
+	"context"
+	"github.com/liquanhui-99/restrictor"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestScripts(t *testing.T) {
+	// 每个脚本的SHA1都不一样，Preload不会漏掉或者重复加载
+	hashes := make(map[string]struct{}, len(scripts))
+	for _, script := range scripts {
+		require.NotNil(t, script)
+		require.Len(t, script.Hash(), 40)
+		hashes[script.Hash()] = struct{}{}
+	}
+	require.Len(t, hashes, len(scripts))
+}
+
+func TestPreload_BackendUnavailable(t *testing.T) {
+	// 没有监听的端口，连接直接被拒绝
+	client := redis.NewClient(&redis.Options{
+		Addr:       "127.0.0.1:1",
+		MaxRetries: -1,
+	})
+	defer client.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	err := Preload(ctx, client)
+	require.ErrorIs(t, err, restrictor.ErrBackendUnavailable)
+	err = NewFixedWindowLimiter(client, 10, time.Minute).Preload(ctx)
+	require.ErrorIs(t, err, restrictor.ErrBackendUnavailable)
+}
@@ -3,45 +3,148 @@ package Redis
 import (
 	"context"
 	_ "embed"
-	"errors"
+	"github.com/liquanhui-99/restrictor"
 	"github.com/redis/go-redis/v9"
+	"strconv"
+	"sync"
 	"time"
 )
 
 //go:embed lua/slide_window.lua
-var slideWindow string
+var slideWindowLua string
+
+// slideWindow 滑动窗口的lua脚本，优先使用EVALSHA执行，Redis中没有缓存时退回EVAL
+var slideWindow = redis.NewScript(slideWindowLua)
 
 // SlideWindowLimiter 基于Redis实现的滑动窗口的限流器
 type SlideWindowLimiter struct {
 	// Redis客户端
 	client redis.Cmdable
+	// mu 保护maxCount和expiration
+	mu sync.RWMutex
 	// 窗口内最大的请求数量
 	maxCount int64
 	// 固定窗口的key过期时间
 	expiration time.Duration
+	// clock 换算ResetAt的时钟，窗口按照Redis服务器的时间计算，不受各个实例时钟偏差的影响
+	clock restrictor.Clock
+	// layout 限流器在Redis中的key格式
+	layout keyLayout
 }
 
 // NewSlideWindowLimiter 初始化滑动窗口限流器，client是redis的客户端，maxCount窗口内允许的最大请求数量,
 // expiration 滑动窗口的大小
-func NewSlideWindowLimiter(client redis.Cmdable, maxCount int64, expiration time.Duration) *SlideWindowLimiter {
+func NewSlideWindowLimiter(client redis.Cmdable, maxCount int64, expiration time.Duration, opts ...Option) *SlideWindowLimiter {
+	o := newOptions(opts)
 	return &SlideWindowLimiter{
 		client:     client,
 		maxCount:   maxCount,
 		expiration: expiration,
+		clock:      o.clock,
+		layout:     o.layout,
 	}
 }
 
 // Allow 是否允许请求通过限流器，key是存在redis中的键，可以标识单个接口，也可以标识一个服务
-func (s SlideWindowLimiter) Allow(ctx context.Context, key string) (bool, error) {
-	res, err := s.client.Eval(ctx, slideWindow, []string{key},
-		s.expiration.Milliseconds(), s.maxCount, time.Now().UnixMilli()).Result()
+func (s *SlideWindowLimiter) Allow(ctx context.Context, key string) (bool, error) {
+	return s.AllowN(ctx, key, 1)
+}
+
+// AllowN 是否允许消耗n个单位继续请求，由lua脚本保证n个单位要么全部消耗，要么一个都不消耗
+func (s *SlideWindowLimiter) AllowN(ctx context.Context, key string, n int64) (bool, error) {
+	d, err := s.Decide(ctx, key, n)
 	if err != nil {
 		return false, err
 	}
+	if !d.Allowed {
+		return false, restrictor.NewLimitError(d)
+	}
+	return true, nil
+}
 
-	if res.(string) == "true" {
-		return false, errors.New("达到性能瓶颈")
+// Decide 判定是否允许消耗n个单位继续请求，被拒绝时RetryAfter是让出足够位置的请求滑出窗口的时间
+func (s *SlideWindowLimiter) Decide(ctx context.Context, key string, n int64) (restrictor.Decision, error) {
+	if err := restrictor.CheckCount(n); err != nil {
+		return restrictor.Decision{}, err
+	}
+	args, decide, err := s.prepare()
+	if err != nil {
+		return restrictor.Decision{}, err
+	}
+	res, err := slideWindow.Run(ctx, s.client, []string{s.layout.key(key)}, args(n)...).Result()
+	if err != nil {
+		return restrictor.Decision{}, backendError(err)
 	}
+	return decide(res, n)
+}
 
-	return true, nil
+// AllowMany 在一次Redis往返中判定多个key，返回每个请求的判定结果，被拒绝的请求不影响其他的请求
+func (s *SlideWindowLimiter) AllowMany(ctx context.Context, reqs []Request) ([]restrictor.Decision, error) {
+	args, decide, err := s.prepare()
+	if err != nil {
+		return nil, err
+	}
+	return decideMany(ctx, s.client, slideWindow, s.layout, reqs, args, decide)
+}
+
+// prepare 复制当前的参数，返回lua脚本的参数和转换判定结果的函数，同一批请求使用相同的参数，
+// 每个请求的成员使用随机id加上序号，同一批请求中相同的key也不会互相覆盖
+func (s *SlideWindowLimiter) prepare() (argsFunc, decideFunc, error) {
+	id, err := randomID()
+	if err != nil {
+		return nil, nil, err
+	}
+	now := s.clock.Now()
+	s.mu.RLock()
+	maxCount, expiration := s.maxCount, s.expiration
+	s.mu.RUnlock()
+	seq := 0
+	// 窗口按照Redis服务器的时间计算，now只用来换算ResetAt
+	args := func(n int64) []interface{} {
+		seq++
+		return []interface{}{expiration.Milliseconds(), maxCount, n, id + ":" + strconv.Itoa(seq)}
+	}
+	decide := func(res interface{}, n int64) (restrictor.Decision, error) {
+		nums, err := parseResult(res, 4)
+		if err != nil {
+			return restrictor.Decision{}, err
+		}
+
+		d := restrictor.Decision{
+			Allowed:    nums[0] == 1,
+			Limit:      maxCount,
+			Remaining:  maxCount - nums[1],
+			ResetAt:    now.Add(time.Duration(nums[3]) * time.Millisecond),
+			RetryAfter: time.Duration(nums[2]) * time.Millisecond,
+			Limiter:    restrictor.RedisSlideWindow,
+		}
+		if d.Remaining < 0 {
+			// 调小maxCount以后窗口内的请求可能超过新的限制
+			d.Remaining = 0
+		}
+		return d, nil
+	}
+	return args, decide, nil
+}
+
+// SetLimit 修改窗口内允许的最大请求数量，Redis中窗口内已经记录的请求保留，可以和Allow并发调用
+func (s *SlideWindowLimiter) SetLimit(maxCount int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.maxCount = maxCount
+}
+
+// SetInterval 修改滑动窗口的大小，Redis中已经记录的请求按照新的大小判断是否滑出窗口，可以和Allow并发调用
+func (s *SlideWindowLimiter) SetInterval(expiration time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.expiration = expiration
+}
+
+// Preload 把滑动窗口的lua脚本加载到Redis中，启动时调用，第一个请求不需要再发送脚本
+func (s *SlideWindowLimiter) Preload(ctx context.Context) error {
+	if err := slideWindow.Load(ctx, s.client).Err(); err != nil {
+		return backendError(err)
+	}
+	return nil
 }
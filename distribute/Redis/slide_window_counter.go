@@ -0,0 +1,132 @@
+package Redis
+
+import (
+	"context"
+	_ "embed"
+	"github.com/liquanhui-99/restrictor"
+	"github.com/redis/go-redis/v9"
+	"sync"
+	"time"
+)
+
+//go:embed lua/slide_window_counter.lua
+var slideWindowCounterLua string
+
+// slideWindowCounter 滑动窗口计数器的lua脚本，优先使用EVALSHA执行，Redis中没有缓存时退回EVAL
+var slideWindowCounter = redis.NewScript(slideWindowCounterLua)
+
+// SlideWindowCounterLimiter 基于Redis实现的滑动窗口计数器限流器，每个key只保存两个窗口的请求数量，
+// 和滑动窗口相比不需要在ZSET中保存每一个请求，占用O(1)的内存
+type SlideWindowCounterLimiter struct {
+	// Redis客户端
+	client redis.Cmdable
+	// mu 保护interval和maxCount
+	mu sync.RWMutex
+	// 窗口的大小
+	interval time.Duration
+	// 滑动窗口内允许的最大请求数量
+	maxCount int64
+	// clock 获取当前请求时间戳的时钟
+	clock restrictor.Clock
+	// layout 限流器在Redis中的key格式
+	layout keyLayout
+}
+
+// NewSlideWindowCounterLimiter 初始化滑动窗口计数器限流器，client是redis的客户端，maxCount是滑动窗口内允许的最大请求数量，
+// interval是窗口的大小，参数的顺序和NewFixedWindowLimiter、NewSlideWindowLimiter一致
+func NewSlideWindowCounterLimiter(client redis.Cmdable, maxCount int64, interval time.Duration, opts ...Option) *SlideWindowCounterLimiter {
+	o := newOptions(opts)
+	return &SlideWindowCounterLimiter{
+		client:   client,
+		interval: interval,
+		maxCount: maxCount,
+		clock:    o.clock,
+		layout:   o.layout,
+	}
+}
+
+// Allow 是否允许请求通过限流器，key是存在redis中的键，可以标识单个接口，也可以标识一个服务
+func (s *SlideWindowCounterLimiter) Allow(ctx context.Context, key string) (bool, error) {
+	return s.AllowN(ctx, key, 1)
+}
+
+// AllowN 是否允许消耗n个单位继续请求，由lua脚本保证n个单位要么全部消耗，要么一个都不消耗
+func (s *SlideWindowCounterLimiter) AllowN(ctx context.Context, key string, n int64) (bool, error) {
+	d, err := s.Decide(ctx, key, n)
+	if err != nil {
+		return false, err
+	}
+	if !d.Allowed {
+		return false, restrictor.NewLimitError(d)
+	}
+	return true, nil
+}
+
+// Decide 判定滑动窗口内是否允许通过n个请求，被拒绝时RetryAfter是估算的请求数量降到允许n个请求的时间
+func (s *SlideWindowCounterLimiter) Decide(ctx context.Context, key string, n int64) (restrictor.Decision, error) {
+	if err := restrictor.CheckCount(n); err != nil {
+		return restrictor.Decision{}, err
+	}
+	args, decide := s.prepare()
+	res, err := slideWindowCounter.Run(ctx, s.client, []string{s.layout.key(key)}, args(n)...).Result()
+	if err != nil {
+		return restrictor.Decision{}, backendError(err)
+	}
+	return decide(res, n)
+}
+
+// AllowMany 在一次Redis往返中判定多个key，返回每个请求的判定结果，被拒绝的请求不影响其他的请求
+func (s *SlideWindowCounterLimiter) AllowMany(ctx context.Context, reqs []Request) ([]restrictor.Decision, error) {
+	args, decide := s.prepare()
+	return decideMany(ctx, s.client, slideWindowCounter, s.layout, reqs, args, decide)
+}
+
+// prepare 复制当前的参数，返回lua脚本的参数和转换判定结果的函数，同一批请求使用相同的参数
+func (s *SlideWindowCounterLimiter) prepare() (argsFunc, decideFunc) {
+	now := s.clock.Now()
+	s.mu.RLock()
+	interval, maxCount := s.interval, s.maxCount
+	s.mu.RUnlock()
+	args := func(n int64) []interface{} {
+		return []interface{}{interval.Milliseconds(), maxCount, now.UnixMilli(), n}
+	}
+	decide := func(res interface{}, n int64) (restrictor.Decision, error) {
+		nums, err := parseResult(res, 4)
+		if err != nil {
+			return restrictor.Decision{}, err
+		}
+
+		return restrictor.Decision{
+			Allowed:    nums[0] == 1,
+			Limit:      maxCount,
+			Remaining:  nums[1],
+			ResetAt:    now.Add(time.Duration(nums[3]) * time.Millisecond),
+			RetryAfter: time.Duration(nums[2]) * time.Millisecond,
+			Limiter:    restrictor.RedisSlideWindowCounter,
+		}, nil
+	}
+	return args, decide
+}
+
+// SetLimit 修改滑动窗口内允许的最大请求数量，Redis中两个窗口的请求数量保留，可以和Allow并发调用
+func (s *SlideWindowCounterLimiter) SetLimit(maxCount int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.maxCount = maxCount
+}
+
+// SetInterval 修改窗口的大小，可以和Allow并发调用，Redis中的窗口按照新的大小重新对齐，
+// 两个窗口的请求数量保留
+func (s *SlideWindowCounterLimiter) SetInterval(interval time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.interval = interval
+}
+
+// Preload 把滑动窗口计数器的lua脚本加载到Redis中，启动时调用，第一个请求不需要再发送脚本
+func (s *SlideWindowCounterLimiter) Preload(ctx context.Context) error {
+	if err := slideWindowCounter.Load(ctx, s.client).Err(); err != nil {
+		return backendError(err)
+	}
+	return nil
+}
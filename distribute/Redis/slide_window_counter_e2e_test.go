@@ -0,0 +1,113 @@
+package Redis
+
+import (
+	"context"
+	"github.com/liquanhui-99/restrictor"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestSlideWindowCounterLimiter_AllowN(t *testing.T) {
+	client := redis.NewClient(&redis.Options{
+		Addr:     "127.0.0.1:6379",
+		Password: "123456",
+	})
+
+	clock := restrictor.NewFakeClock(time.Unix(1000, 0))
+	limit := NewSlideWindowCounterLimiter(client, 10, time.Second, WithClock(clock))
+	key := "slide_window_counter_allow_n"
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	defer client.Del(ctx, key)
+
+	res, err := limit.AllowN(ctx, key, 10)
+	require.NoError(t, err)
+	require.True(t, res)
+
+	// 上一个窗口的10个请求还有一半在滑动窗口内
+	clock.Advance(1500 * time.Millisecond)
+	res, err = limit.AllowN(ctx, key, 6)
+	require.ErrorIs(t, err, restrictor.ErrLimitExceeded)
+	require.False(t, res)
+
+	res, err = limit.AllowN(ctx, key, 5)
+	require.NoError(t, err)
+	require.True(t, res)
+}
+
+func TestSlideWindowCounterLimiter_Decide(t *testing.T) {
+	client := redis.NewClient(&redis.Options{
+		Addr:     "127.0.0.1:6379",
+		Password: "123456",
+	})
+
+	clock := restrictor.NewFakeClock(time.Unix(1000, 0))
+	limit := NewSlideWindowCounterLimiter(client, 10, time.Second, WithClock(clock))
+	key := "slide_window_counter_decide"
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	defer client.Del(ctx, key)
+
+	d, err := limit.Decide(ctx, key, 8)
+	require.NoError(t, err)
+	require.True(t, d.Allowed)
+	require.Equal(t, int64(10), d.Limit)
+	require.Equal(t, int64(2), d.Remaining)
+	require.Equal(t, restrictor.RedisSlideWindowCounter, d.Limiter)
+	require.Equal(t, clock.Now().Add(2*time.Second), d.ResetAt)
+
+	// 上一个窗口的8个请求有一半在滑动窗口内
+	clock.Advance(1500 * time.Millisecond)
+	d, err = limit.Decide(ctx, key, 6)
+	require.NoError(t, err)
+	require.True(t, d.Allowed)
+	require.Equal(t, int64(0), d.Remaining)
+
+	// 上一个窗口的请求再滑出去2个就够了，需要等250毫秒
+	d, err = limit.Decide(ctx, key, 2)
+	require.NoError(t, err)
+	require.False(t, d.Allowed)
+	require.Equal(t, 250*time.Millisecond, d.RetryAfter)
+
+	// 超过窗口内的最大数量，重试也不会通过
+	d, err = limit.Decide(ctx, key, 11)
+	require.NoError(t, err)
+	require.False(t, d.Allowed)
+	require.Equal(t, time.Duration(0), d.RetryAfter)
+}
+
+func TestSlideWindowCounterLimiter_SetLimit(t *testing.T) {
+	client := redis.NewClient(&redis.Options{
+		Addr:     "127.0.0.1:6379",
+		Password: "123456",
+	})
+
+	clock := restrictor.NewFakeClock(time.UnixMilli(0))
+	limit := NewSlideWindowCounterLimiter(client, 2, time.Minute, WithClock(clock))
+	key := "slide_window_counter_set_limit"
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	defer client.Del(ctx, key)
+
+	clock.Advance(90 * time.Second)
+	res, err := limit.AllowN(ctx, key, 2)
+	require.NoError(t, err)
+	require.True(t, res)
+
+	// 调大以后当前窗口的请求数量保留
+	limit.SetLimit(3)
+	res, err = limit.Allow(ctx, key)
+	require.NoError(t, err)
+	require.True(t, res)
+	res, err = limit.Allow(ctx, key)
+	require.ErrorIs(t, err, restrictor.ErrLimitExceeded)
+	require.False(t, res)
+
+	// 修改窗口的大小以后重新对齐，请求数量保留
+	limit.SetInterval(time.Hour)
+	res, err = limit.Allow(ctx, key)
+	require.ErrorIs(t, err, restrictor.ErrLimitExceeded)
+	require.False(t, res)
+}
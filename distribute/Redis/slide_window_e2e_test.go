@@ -2,8 +2,11 @@ package Redis
 
 import (
 	"context"
+	"github.com/liquanhui-99/restrictor"
 	"github.com/redis/go-redis/v9"
 	"github.com/stretchr/testify/require"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -24,3 +27,129 @@ func TestSlideWindowLimiter_Allow(t *testing.T) {
 		require.True(t, res)
 	}
 }
+
+func TestSlideWindowLimiter_AllowN(t *testing.T) {
+	client := redis.NewClient(&redis.Options{
+		Addr:     "127.0.0.1:6379",
+		Password: "123456",
+	})
+
+	limit := NewSlideWindowLimiter(client, 100, time.Minute)
+	key := "slide_window_allow_n"
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	defer client.Del(ctx, key)
+
+	res, err := limit.AllowN(ctx, key, 60)
+	require.NoError(t, err)
+	require.True(t, res)
+
+	// 剩余的数量不够，一个都不消耗
+	res, err = limit.AllowN(ctx, key, 50)
+	require.ErrorIs(t, err, restrictor.ErrLimitExceeded)
+	require.False(t, res)
+
+	res, err = limit.AllowN(ctx, key, 40)
+	require.NoError(t, err)
+	require.True(t, res)
+}
+
+func TestSlideWindowLimiter_Decide(t *testing.T) {
+	client := redis.NewClient(&redis.Options{
+		Addr:     "127.0.0.1:6379",
+		Password: "123456",
+	})
+
+	limit := NewSlideWindowLimiter(client, 100, time.Minute)
+	key := "slide_window_decide"
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	defer client.Del(ctx, key)
+
+	d, err := limit.Decide(ctx, key, 60)
+	require.NoError(t, err)
+	require.True(t, d.Allowed)
+	require.Equal(t, int64(100), d.Limit)
+	require.Equal(t, int64(40), d.Remaining)
+	require.Equal(t, time.Duration(0), d.RetryAfter)
+
+	// 剩余的数量不够，需要等到窗口结束
+	d, err = limit.Decide(ctx, key, 50)
+	require.NoError(t, err)
+	require.False(t, d.Allowed)
+	require.Equal(t, int64(40), d.Remaining)
+	require.Greater(t, d.RetryAfter, 50*time.Second)
+	require.LessOrEqual(t, d.RetryAfter, time.Minute)
+}
+
+func TestSlideWindowLimiter_SameMillisecond(t *testing.T) {
+	client := redis.NewClient(&redis.Options{
+		Addr:     "127.0.0.1:6379",
+		Password: "123456",
+	})
+	// 所有的请求都在同一毫秒内，成员不能互相覆盖
+	clock := restrictor.NewFakeClock(time.Now())
+	limit := NewSlideWindowLimiter(client, 100, time.Minute, WithClock(clock))
+	key := "slide_window_same_millisecond"
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	defer client.Del(ctx, key)
+
+	var allowed atomic.Int64
+	var wg sync.WaitGroup
+	for i := 0; i < 200; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if res, _ := limit.Allow(ctx, key); res {
+				allowed.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	require.Equal(t, int64(100), allowed.Load())
+	cnt, err := client.ZCard(ctx, key).Result()
+	require.NoError(t, err)
+	require.Equal(t, int64(100), cnt)
+}
+
+func TestSlideWindowLimiter_ClockSkew(t *testing.T) {
+	client := redis.NewClient(&redis.Options{
+		Addr:     "127.0.0.1:6379",
+		Password: "123456",
+	})
+	key := "slide_window_clock_skew"
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	defer client.Del(ctx, key)
+
+	// 两个实例的时钟分别快了和慢了一个小时，按照Redis服务器的时间共享同一个窗口
+	fast := NewSlideWindowLimiter(client, 10, time.Minute,
+		WithClock(restrictor.NewFakeClock(time.Now().Add(time.Hour))))
+	slow := NewSlideWindowLimiter(client, 10, time.Minute,
+		WithClock(restrictor.NewFakeClock(time.Now().Add(-time.Hour))))
+	for i := 0; i < 5; i++ {
+		res, err := fast.Allow(ctx, key)
+		require.NoError(t, err)
+		require.True(t, res)
+		res, err = slow.Allow(ctx, key)
+		require.NoError(t, err)
+		require.True(t, res)
+	}
+	res, err := fast.Allow(ctx, key)
+	require.ErrorIs(t, err, restrictor.ErrLimitExceeded)
+	require.False(t, res)
+	res, err = slow.Allow(ctx, key)
+	require.ErrorIs(t, err, restrictor.ErrLimitExceeded)
+	require.False(t, res)
+
+	// 记录的时间是Redis服务器的时间
+	serverTime, err := client.Time(ctx).Result()
+	require.NoError(t, err)
+	members, err := client.ZRangeWithScores(ctx, key, 0, -1).Result()
+	require.NoError(t, err)
+	require.Len(t, members, 10)
+	for _, member := range members {
+		require.InDelta(t, float64(serverTime.UnixMilli()), member.Score, float64(time.Minute.Milliseconds()))
+	}
+}
@@ -0,0 +1,130 @@
+package Redis
+
+import (
+	"context"
+	_ "embed"
+	"github.com/liquanhui-99/restrictor"
+	"github.com/redis/go-redis/v9"
+	"sync"
+	"time"
+)
+
+//go:embed lua/token_bucket.lua
+var tokenBucketLua string
+
+// tokenBucket 令牌桶的lua脚本，优先使用EVALSHA执行，Redis中没有缓存时退回EVAL
+var tokenBucket = redis.NewScript(tokenBucketLua)
+
+// TokenBucketLimiter 基于Redis实现的令牌桶限流器，允许一定的突发流量
+type TokenBucketLimiter struct {
+	// Redis客户端
+	client redis.Cmdable
+	// mu 保护rate和burst
+	mu sync.RWMutex
+	// 每秒补充的令牌数量
+	rate float64
+	// 令牌桶的容量，也就是允许的最大突发请求数量
+	burst int64
+	// clock 获取当前请求时间戳的时钟
+	clock restrictor.Clock
+	// layout 限流器在Redis中的key格式
+	layout keyLayout
+}
+
+// NewTokenBucketLimiter 初始化令牌桶限流器，client是redis的客户端，rate是每秒补充的令牌数量，可以是小数，
+// burst是令牌桶的容量，第一次请求时令牌桶是满的
+func NewTokenBucketLimiter(client redis.Cmdable, rate float64, burst int64, opts ...Option) *TokenBucketLimiter {
+	o := newOptions(opts)
+	return &TokenBucketLimiter{
+		client: client,
+		rate:   rate,
+		burst:  burst,
+		clock:  o.clock,
+		layout: o.layout,
+	}
+}
+
+// Allow 是否允许请求通过限流器，key是存在redis中的键，可以标识单个接口，也可以标识一个服务
+func (t *TokenBucketLimiter) Allow(ctx context.Context, key string) (bool, error) {
+	return t.AllowN(ctx, key, 1)
+}
+
+// AllowN 是否允许消耗n个令牌继续请求，由lua脚本保证n个令牌要么全部消耗，要么一个都不消耗
+func (t *TokenBucketLimiter) AllowN(ctx context.Context, key string, n int64) (bool, error) {
+	d, err := t.Decide(ctx, key, n)
+	if err != nil {
+		return false, err
+	}
+	if !d.Allowed {
+		return false, restrictor.NewLimitError(d)
+	}
+	return true, nil
+}
+
+// Decide 判定是否允许消耗n个令牌继续请求，被拒绝时RetryAfter是补充出足够令牌的时间
+func (t *TokenBucketLimiter) Decide(ctx context.Context, key string, n int64) (restrictor.Decision, error) {
+	if err := restrictor.CheckCount(n); err != nil {
+		return restrictor.Decision{}, err
+	}
+	args, decide := t.prepare()
+	res, err := tokenBucket.Run(ctx, t.client, []string{t.layout.key(key)}, args(n)...).Result()
+	if err != nil {
+		return restrictor.Decision{}, backendError(err)
+	}
+	return decide(res, n)
+}
+
+// AllowMany 在一次Redis往返中判定多个key，返回每个请求的判定结果，被拒绝的请求不影响其他的请求
+func (t *TokenBucketLimiter) AllowMany(ctx context.Context, reqs []Request) ([]restrictor.Decision, error) {
+	args, decide := t.prepare()
+	return decideMany(ctx, t.client, tokenBucket, t.layout, reqs, args, decide)
+}
+
+// prepare 复制当前的参数，返回lua脚本的参数和转换判定结果的函数，同一批请求使用相同的参数
+func (t *TokenBucketLimiter) prepare() (argsFunc, decideFunc) {
+	now := t.clock.Now()
+	t.mu.RLock()
+	rate, burst := t.rate, t.burst
+	t.mu.RUnlock()
+	args := func(n int64) []interface{} {
+		return []interface{}{rate, burst, now.UnixMilli(), n}
+	}
+	decide := func(res interface{}, n int64) (restrictor.Decision, error) {
+		nums, err := parseResult(res, 4)
+		if err != nil {
+			return restrictor.Decision{}, err
+		}
+
+		return restrictor.Decision{
+			Allowed:    nums[0] == 1,
+			Limit:      burst,
+			Remaining:  nums[1],
+			ResetAt:    now.Add(time.Duration(nums[3]) * time.Millisecond),
+			RetryAfter: time.Duration(nums[2]) * time.Millisecond,
+			Limiter:    restrictor.RedisTokenBucket,
+		}, nil
+	}
+	return args, decide
+}
+
+// SetRate 修改每秒补充的令牌数量，Redis中桶里的令牌保留，之后按照新的速率补充，可以和Allow并发调用
+func (t *TokenBucketLimiter) SetRate(rate float64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.rate = rate
+}
+
+// SetBurst 修改令牌桶的容量，Redis中桶里的令牌保留，超过新容量的部分在下一次请求时丢弃，可以和Allow并发调用
+func (t *TokenBucketLimiter) SetBurst(burst int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.burst = burst
+}
+
+// Preload 把令牌桶的lua脚本加载到Redis中，启动时调用，第一个请求不需要再发送脚本
+func (t *TokenBucketLimiter) Preload(ctx context.Context) error {
+	if err := tokenBucket.Load(ctx, t.client).Err(); err != nil {
+		return backendError(err)
+	}
+	return nil
+}
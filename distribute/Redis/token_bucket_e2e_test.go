@@ -0,0 +1,137 @@
+package Redis
+
+import (
+	"context"
+	"github.com/liquanhui-99/restrictor"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestTokenBucketLimiter_Allow(t *testing.T) {
+	client := redis.NewClient(&redis.Options{
+		Addr:     "127.0.0.1:6379",
+		Password: "123456",
+	})
+
+	clock := restrictor.NewFakeClock(time.Now())
+	limit := NewTokenBucketLimiter(client, 10, 5, WithClock(clock))
+	key := "token_bucket_allow"
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	defer client.Del(ctx, key)
+
+	// 第一次请求时令牌桶是满的
+	for i := 0; i < 5; i++ {
+		res, err := limit.Allow(ctx, key)
+		require.NoError(t, err)
+		require.True(t, res)
+	}
+	res, err := limit.Allow(ctx, key)
+	require.ErrorIs(t, err, restrictor.ErrLimitExceeded)
+	require.False(t, res)
+
+	// 10个每秒，100毫秒补充一个令牌
+	clock.Advance(100 * time.Millisecond)
+	res, err = limit.Allow(ctx, key)
+	require.NoError(t, err)
+	require.True(t, res)
+}
+
+func TestTokenBucketLimiter_AllowN(t *testing.T) {
+	client := redis.NewClient(&redis.Options{
+		Addr:     "127.0.0.1:6379",
+		Password: "123456",
+	})
+
+	clock := restrictor.NewFakeClock(time.Now())
+	limit := NewTokenBucketLimiter(client, 10, 10, WithClock(clock))
+	key := "token_bucket_allow_n"
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	defer client.Del(ctx, key)
+
+	res, err := limit.AllowN(ctx, key, 6)
+	require.NoError(t, err)
+	require.True(t, res)
+
+	// 剩余的令牌不够，一个都不消耗
+	res, err = limit.AllowN(ctx, key, 5)
+	require.ErrorIs(t, err, restrictor.ErrLimitExceeded)
+	require.False(t, res)
+
+	res, err = limit.AllowN(ctx, key, 4)
+	require.NoError(t, err)
+	require.True(t, res)
+}
+
+func TestTokenBucketLimiter_Decide(t *testing.T) {
+	client := redis.NewClient(&redis.Options{
+		Addr:     "127.0.0.1:6379",
+		Password: "123456",
+	})
+
+	clock := restrictor.NewFakeClock(time.Now())
+	limit := NewTokenBucketLimiter(client, 10, 5, WithClock(clock))
+	key := "token_bucket_decide"
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	defer client.Del(ctx, key)
+
+	d, err := limit.Decide(ctx, key, 5)
+	require.NoError(t, err)
+	require.True(t, d.Allowed)
+	require.Equal(t, int64(5), d.Limit)
+	require.Equal(t, int64(0), d.Remaining)
+	require.Equal(t, restrictor.RedisTokenBucket, d.Limiter)
+	require.Equal(t, clock.Now().Add(500*time.Millisecond), d.ResetAt)
+
+	// 过了50毫秒补充了半个令牌，再补充1.5个令牌需要150毫秒
+	clock.Advance(50 * time.Millisecond)
+	d, err = limit.Decide(ctx, key, 2)
+	require.NoError(t, err)
+	require.False(t, d.Allowed)
+	require.Equal(t, 150*time.Millisecond, d.RetryAfter)
+
+	// 超过令牌桶的容量，重试也不会通过
+	d, err = limit.Decide(ctx, key, 6)
+	require.NoError(t, err)
+	require.False(t, d.Allowed)
+	require.Equal(t, time.Duration(0), d.RetryAfter)
+}
+
+func TestTokenBucketLimiter_SetBurst(t *testing.T) {
+	client := redis.NewClient(&redis.Options{
+		Addr:     "127.0.0.1:6379",
+		Password: "123456",
+	})
+
+	clock := restrictor.NewFakeClock(time.Now())
+	limit := NewTokenBucketLimiter(client, 10, 5, WithClock(clock))
+	key := "token_bucket_set_burst"
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	defer client.Del(ctx, key)
+
+	res, err := limit.AllowN(ctx, key, 2)
+	require.NoError(t, err)
+	require.True(t, res)
+
+	// 调小容量以后超过容量的令牌丢弃
+	limit.SetBurst(2)
+	d, err := limit.Decide(ctx, key, 0)
+	require.NoError(t, err)
+	require.Equal(t, int64(2), d.Limit)
+	require.Equal(t, int64(2), d.Remaining)
+
+	// 修改速率以后按照新的速率补充令牌
+	limit.SetRate(1)
+	res, err = limit.AllowN(ctx, key, 2)
+	require.NoError(t, err)
+	require.True(t, res)
+	d, err = limit.Decide(ctx, key, 1)
+	require.NoError(t, err)
+	require.False(t, d.Allowed)
+	require.Equal(t, time.Second, d.RetryAfter)
+}
@@ -0,0 +1,129 @@
+package Redis
+
+import (
+	"context"
+	_ "embed"
+	"github.com/liquanhui-99/restrictor"
+	"github.com/redis/go-redis/v9"
+	"sync"
+	"time"
+)
+
+//go:embed lua/warm_up_token_bucket.lua
+var warmUpTokenBucketLua string
+
+// warmUpTokenBucket 预热令牌桶的lua脚本，优先使用EVALSHA执行，Redis中没有缓存时退回EVAL
+var warmUpTokenBucket = redis.NewScript(warmUpTokenBucketLua)
+
+// WarmUpTokenBucketLimiter 基于Redis实现的带预热的令牌桶限流器，空闲一段时间以后发放令牌的速度变慢，
+// 在warmup时间内线性加速到稳定的速率
+type WarmUpTokenBucketLimiter struct {
+	// Redis客户端
+	client redis.Cmdable
+	// mu 保护rate
+	mu sync.RWMutex
+	// 稳定时每秒发放的令牌数量
+	rate float64
+	// 从冷启动加速到稳定速率的时间
+	warmup time.Duration
+	// clock 获取当前请求时间戳的时钟
+	clock restrictor.Clock
+	// layout 限流器在Redis中的key格式
+	layout keyLayout
+}
+
+// NewWarmUpTokenBucketLimiter 初始化带预热的令牌桶，client是redis的客户端，rate是稳定时每秒发放的令牌数量，
+// 必须大于0，warmup是从冷启动加速到稳定速率的时间，第一次请求时处于冷启动的状态
+func NewWarmUpTokenBucketLimiter(client redis.Cmdable, rate float64, warmup time.Duration, opts ...Option) *WarmUpTokenBucketLimiter {
+	o := newOptions(opts)
+	return &WarmUpTokenBucketLimiter{
+		client: client,
+		rate:   rate,
+		warmup: warmup,
+		clock:  o.clock,
+		layout: o.layout,
+	}
+}
+
+// Allow 是否允许请求通过限流器，key是存在redis中的键，可以标识单个接口，也可以标识一个服务
+func (w *WarmUpTokenBucketLimiter) Allow(ctx context.Context, key string) (bool, error) {
+	return w.AllowN(ctx, key, 1)
+}
+
+// AllowN 是否允许消耗n个令牌继续请求，n个令牌的发放时间由下一个请求等待
+func (w *WarmUpTokenBucketLimiter) AllowN(ctx context.Context, key string, n int64) (bool, error) {
+	d, err := w.Decide(ctx, key, n)
+	if err != nil {
+		return false, err
+	}
+	if !d.Allowed {
+		return false, restrictor.NewLimitError(d)
+	}
+	return true, nil
+}
+
+// Decide 判定是否允许消耗n个令牌继续请求，只要上一个请求的令牌已经发放完就允许通过，
+// 所以判定结果的Limit固定是1，被拒绝时RetryAfter是上一个请求的令牌发放完的时间
+func (w *WarmUpTokenBucketLimiter) Decide(ctx context.Context, key string, n int64) (restrictor.Decision, error) {
+	if err := restrictor.CheckCount(n); err != nil {
+		return restrictor.Decision{}, err
+	}
+	args, decide := w.prepare()
+	res, err := warmUpTokenBucket.Run(ctx, w.client, []string{w.layout.key(key)}, args(n)...).Result()
+	if err != nil {
+		return restrictor.Decision{}, backendError(err)
+	}
+	return decide(res, n)
+}
+
+// AllowMany 在一次Redis往返中判定多个key，返回每个请求的判定结果，被拒绝的请求不影响其他的请求
+func (w *WarmUpTokenBucketLimiter) AllowMany(ctx context.Context, reqs []Request) ([]restrictor.Decision, error) {
+	args, decide := w.prepare()
+	return decideMany(ctx, w.client, warmUpTokenBucket, w.layout, reqs, args, decide)
+}
+
+// prepare 复制当前的参数，返回lua脚本的参数和转换判定结果的函数，同一批请求使用相同的参数
+func (w *WarmUpTokenBucketLimiter) prepare() (argsFunc, decideFunc) {
+	now := w.clock.Now()
+	w.mu.RLock()
+	stable := 1000 / w.rate
+	w.mu.RUnlock()
+	args := func(n int64) []interface{} {
+		return []interface{}{stable, w.warmup.Milliseconds(), now.UnixMilli(), n}
+	}
+	decide := func(res interface{}, n int64) (restrictor.Decision, error) {
+		nums, err := parseResult(res, 3)
+		if err != nil {
+			return restrictor.Decision{}, err
+		}
+
+		d := restrictor.Decision{
+			Allowed:    nums[0] == 1,
+			Limit:      1,
+			ResetAt:    now.Add(time.Duration(nums[2]) * time.Millisecond),
+			RetryAfter: time.Duration(nums[1]) * time.Millisecond,
+			Limiter:    restrictor.RedisWarmUpTokenBucket,
+		}
+		if d.Allowed && nums[2] == 0 {
+			d.Remaining = 1
+		}
+		return d, nil
+	}
+	return args, decide
+}
+
+// SetRate 修改稳定时每秒发放的令牌数量，必须大于0，可以和Allow并发调用，
+// Redis中积攒的令牌保留，超过新的上限的部分在下一次请求时丢弃
+func (w *WarmUpTokenBucketLimiter) SetRate(rate float64) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.rate = rate
+}
+
+// Preload 把预热令牌桶的lua脚本加载到Redis中，启动时调用，第一个请求不需要再发送脚本
+func (w *WarmUpTokenBucketLimiter) Preload(ctx context.Context) error {
+	if err := warmUpTokenBucket.Load(ctx, w.client).Err(); err != nil {
+		return backendError(err)
+	}
+	return nil
+}
@@ -0,0 +1,47 @@
+package Redis
+
+import (
+	"context"
+	"github.com/liquanhui-99/restrictor"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestWarmUpTokenBucketLimiter_Decide(t *testing.T) {
+	client := redis.NewClient(&redis.Options{
+		Addr:     "127.0.0.1:6379",
+		Password: "123456",
+	})
+
+	// 每秒10个，稳定间隔100毫秒，冷启动间隔300毫秒
+	clock := restrictor.NewFakeClock(time.Now())
+	limit := NewWarmUpTokenBucketLimiter(client, 10, time.Second, WithClock(clock))
+	key := "warm_up_token_bucket_decide"
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	defer client.Del(ctx, key)
+
+	// 冷启动的第一个请求直接通过，下一个请求需要等待280毫秒
+	d, err := limit.Decide(ctx, key, 1)
+	require.NoError(t, err)
+	require.True(t, d.Allowed)
+	require.Equal(t, restrictor.RedisWarmUpTokenBucket, d.Limiter)
+	require.Equal(t, clock.Now().Add(280*time.Millisecond), d.ResetAt)
+
+	d, err = limit.Decide(ctx, key, 1)
+	require.NoError(t, err)
+	require.False(t, d.Allowed)
+	require.Equal(t, 280*time.Millisecond, d.RetryAfter)
+
+	// 发放间隔逐渐缩短，预热完成以后按照稳定间隔发放
+	clock.Advance(280 * time.Millisecond)
+	for _, wait := range []time.Duration{240, 200, 160, 120, 100, 100} {
+		d, err = limit.Decide(ctx, key, 1)
+		require.NoError(t, err)
+		require.True(t, d.Allowed)
+		require.Equal(t, clock.Now().Add(wait*time.Millisecond), d.ResetAt)
+		clock.Advance(wait * time.Millisecond)
+	}
+}
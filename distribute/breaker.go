@@ -0,0 +1,112 @@
+package distribute
+
+import (
+	"github.com/liquanhui-99/restrictor"
+	"sync"
+	"time"
+)
+
+// BreakerState 熔断器的状态
+type BreakerState int
+
+const (
+	// BreakerClosed 熔断器关闭，请求正常访问Redis
+	BreakerClosed BreakerState = iota
+	// BreakerOpen 熔断器打开，请求不访问Redis，直接使用兜底策略
+	BreakerOpen
+	// BreakerHalfOpen 熔断器半开，放一个请求去探测Redis是否恢复
+	BreakerHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	default:
+		return "half-open"
+	}
+}
+
+// breaker 按照连续失败次数打开的熔断器
+type breaker struct {
+	mu sync.Mutex
+	// state 熔断器的状态
+	state BreakerState
+	// failures 连续失败的次数
+	failures int
+	// openedAt 熔断器打开的时间
+	openedAt time.Time
+	// threshold 连续失败多少次以后打开
+	threshold int
+	// coolDown 打开多久以后进入半开状态
+	coolDown time.Duration
+	// clock 获取时间的时钟
+	clock restrictor.Clock
+}
+
+func newBreaker(threshold int, coolDown time.Duration, clock restrictor.Clock) *breaker {
+	if threshold < 1 {
+		threshold = 1
+	}
+	return &breaker{
+		threshold: threshold,
+		coolDown:  coolDown,
+		clock:     clock,
+	}
+}
+
+// allow 请求是否可以访问Redis，半开状态下只有一个探测的请求可以访问
+func (b *breaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case BreakerClosed:
+		return true
+	case BreakerOpen:
+		if b.clock.Now().Sub(b.openedAt) < b.coolDown {
+			return false
+		}
+		b.state = BreakerHalfOpen
+		return true
+	default:
+		// 已经有探测的请求了
+		return false
+	}
+}
+
+// success Redis正常返回，关闭熔断器
+func (b *breaker) success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.state = BreakerClosed
+	b.failures = 0
+}
+
+// failure Redis不可用，连续失败达到阈值或者探测失败时打开熔断器
+func (b *breaker) failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures++
+	if b.state == BreakerHalfOpen || b.failures >= b.threshold {
+		b.state = BreakerOpen
+		b.openedAt = b.clock.Now()
+	}
+}
+
+// release 探测的请求没有得到结果，例如ctx结束，回到打开状态等下一个请求探测
+func (b *breaker) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == BreakerHalfOpen {
+		b.state = BreakerOpen
+	}
+}
+
+// State 熔断器当前的状态
+func (b *breaker) State() BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
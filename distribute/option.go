@@ -0,0 +1,107 @@
+package distribute
+
+import (
+	"github.com/liquanhui-99/restrictor"
+	"github.com/liquanhui-99/restrictor/single"
+	"time"
+)
+
+const (
+	// defaultFailureThreshold 默认连续失败多少次以后打开熔断器
+	defaultFailureThreshold = 5
+	// defaultCoolDown 熔断器默认打开多久以后尝试恢复
+	defaultCoolDown = 10 * time.Second
+	// fallbackTTL 本地兜底限流器中key空闲多久以后淘汰
+	fallbackTTL = 10 * time.Minute
+	// fallbackMaxKeys 本地兜底限流器最多保存的key数量
+	fallbackMaxKeys = 10000
+)
+
+// Option ResilientLimiter的配置项
+type Option func(*options)
+
+type options struct {
+	// clock 获取时间的时钟
+	clock restrictor.Clock
+	// fallback Redis不可用时使用的限流器，为nil时按照failOpen处理
+	fallback DistributedLimiter
+	// local 创建本实例分到的单机限流器，不为nil时代替fallback
+	local func(limit int64) single.Limiter
+	// localLimit 本实例分到的限制
+	localLimit int64
+	// failOpen 没有兜底限流器时Redis不可用是否放行
+	failOpen bool
+	// threshold 连续失败多少次以后打开熔断器
+	threshold int
+	// coolDown 熔断器打开多久以后尝试恢复
+	coolDown time.Duration
+}
+
+// WithClock 替换熔断器使用的时钟，默认是restrictor.RealClock，测试时可以传入restrictor.FakeClock
+func WithClock(clock restrictor.Clock) Option {
+	return func(o *options) {
+		o.clock = clock
+	}
+}
+
+// WithFallback Redis不可用时使用fallback限流，例如single.KeyedLimiter
+func WithFallback(fallback DistributedLimiter) Option {
+	return func(o *options) {
+		o.fallback = fallback
+	}
+}
+
+// WithLocalFallback Redis不可用时按照key使用本地的单机限流器，limit是全局的限制，
+// instances是实例数量的估计值，每个实例分到LocalLimit(limit, instances)，factory根据分到的限制创建单机限流器
+func WithLocalFallback(limit int64, instances int, factory func(limit int64) single.Limiter) Option {
+	return func(o *options) {
+		o.local = factory
+		o.localLimit = LocalLimit(limit, instances)
+	}
+}
+
+// WithFailOpen 没有兜底限流器时Redis不可用直接放行，默认拒绝并且返回Redis的错误
+func WithFailOpen() Option {
+	return func(o *options) {
+		o.failOpen = true
+	}
+}
+
+// WithBreaker 设置熔断器，连续失败threshold次以后打开，打开coolDown以后放一个请求去探测Redis是否恢复
+func WithBreaker(threshold int, coolDown time.Duration) Option {
+	return func(o *options) {
+		o.threshold = threshold
+		o.coolDown = coolDown
+	}
+}
+
+// LocalLimit 全局的限制limit平均分到instances个实例以后每个实例的限制，向上取整并且至少是1
+func LocalLimit(limit int64, instances int) int64 {
+	if instances <= 1 {
+		return limit
+	}
+	local := (limit + int64(instances) - 1) / int64(instances)
+	if local < 1 {
+		local = 1
+	}
+	return local
+}
+
+// newOptions 在默认配置的基础上应用opts
+func newOptions(opts []Option) options {
+	o := options{
+		clock:     restrictor.RealClock,
+		threshold: defaultFailureThreshold,
+		coolDown:  defaultCoolDown,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.local != nil {
+		// 等所有配置项都生效以后再创建，使用最终的时钟
+		o.fallback = single.NewKeyedLimiter(func(string) single.Limiter {
+			return o.local(o.localLimit)
+		}, fallbackTTL, fallbackMaxKeys, single.WithClock(o.clock))
+	}
+	return o
+}
@@ -0,0 +1,88 @@
+package distribute
+
+import (
+	"context"
+	"errors"
+	"github.com/liquanhui-99/restrictor"
+)
+
+// ResilientLimiter 在Redis限流器外面包一层熔断器，Redis不可用时不再拒绝所有的请求，
+// 而是使用兜底的限流器，例如按照实例数量分到全局限制的1/N的单机限流器，没有兜底限流器时按照策略放行或者拒绝。
+// 连续失败达到阈值以后打开熔断器，打开期间不再访问Redis，冷却以后放一个请求探测Redis是否恢复
+type ResilientLimiter struct {
+	// limiter Redis限流器
+	limiter DistributedLimiter
+	// fallback Redis不可用时使用的限流器
+	fallback DistributedLimiter
+	// failOpen 没有兜底限流器时Redis不可用是否放行
+	failOpen bool
+	// breaker 熔断器
+	breaker *breaker
+}
+
+// NewResilientLimiter 初始化带兜底的限流器，limiter是Redis限流器，
+// 通过WithFallback或者WithLocalFallback设置兜底的限流器，通过WithFailOpen设置没有兜底限流器时放行
+func NewResilientLimiter(limiter DistributedLimiter, opts ...Option) *ResilientLimiter {
+	o := newOptions(opts)
+	return &ResilientLimiter{
+		limiter:  limiter,
+		fallback: o.fallback,
+		failOpen: o.failOpen,
+		breaker:  newBreaker(o.threshold, o.coolDown, o.clock),
+	}
+}
+
+// Allow 是否允许通过限流器继续请求
+func (r *ResilientLimiter) Allow(ctx context.Context, key string) (bool, error) {
+	return r.AllowN(ctx, key, 1)
+}
+
+// AllowN 是否允许消耗n个单位继续请求，Redis返回restrictor.ErrBackendUnavailable或者熔断器打开时使用兜底策略，
+// 被Redis限流器拒绝和ctx结束等错误原样返回
+func (r *ResilientLimiter) AllowN(ctx context.Context, key string, n int64) (bool, error) {
+	if !r.breaker.allow() {
+		return r.degrade(ctx, key, n, nil)
+	}
+	ok, err := r.limiter.AllowN(ctx, key, n)
+	switch {
+	case errors.Is(err, restrictor.ErrBackendUnavailable):
+		r.breaker.failure()
+		return r.degrade(ctx, key, n, err)
+	case err != nil && ctx.Err() != nil:
+		// 没有得到Redis的结果，不能说明Redis是否可用
+		r.breaker.release()
+		return ok, err
+	default:
+		r.breaker.success()
+		return ok, err
+	}
+}
+
+// degrade Redis不可用时的兜底策略，err是Redis返回的错误，熔断器打开时为nil
+func (r *ResilientLimiter) degrade(ctx context.Context, key string, n int64, err error) (bool, error) {
+	if r.fallback != nil {
+		return r.fallback.AllowN(ctx, key, n)
+	}
+	if r.failOpen {
+		return true, nil
+	}
+	if err == nil {
+		err = restrictor.NewBackendError(errCircuitOpen)
+	}
+	return false, err
+}
+
+// errCircuitOpen 熔断器打开时拒绝请求返回的错误
+var errCircuitOpen = errors.New("熔断器已经打开")
+
+// State 熔断器当前的状态
+func (r *ResilientLimiter) State() BreakerState {
+	return r.breaker.State()
+}
+
+// Close 关闭兜底的限流器，兜底的限流器没有Close方法时什么都不做
+func (r *ResilientLimiter) Close() {
+	if c, ok := r.fallback.(interface{ Close() }); ok {
+		c.Close()
+	}
+}
@@ -0,0 +1,161 @@
+package distribute
+
+import (
+	"context"
+	"errors"
+	"github.com/liquanhui-99/restrictor"
+	"github.com/liquanhui-99/restrictor/single"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+// fakeLimiter 按照err返回结果的限流器，记录调用次数
+type fakeLimiter struct {
+	err   error
+	calls int
+}
+
+func (f *fakeLimiter) Allow(ctx context.Context, key string) (bool, error) {
+	return f.AllowN(ctx, key, 1)
+}
+
+func (f *fakeLimiter) AllowN(ctx context.Context, key string, n int64) (bool, error) {
+	f.calls++
+	if f.err != nil {
+		return false, f.err
+	}
+	return true, nil
+}
+
+var errRedis = restrictor.NewBackendError(errors.New("dial tcp: connection refused"))
+
+func TestResilientLimiter_AllowN(t *testing.T) {
+	testCases := []struct {
+		name    string
+		err     error
+		opts    []Option
+		wantRes bool
+		wantErr error
+	}{
+		{
+			name:    "Redis正常",
+			wantRes: true,
+		},
+		{
+			name:    "被Redis限流器拒绝",
+			err:     restrictor.NewLimitError(restrictor.Decision{Limit: 1}),
+			wantErr: restrictor.ErrLimitExceeded,
+		},
+		{
+			name:    "Redis不可用默认拒绝",
+			err:     errRedis,
+			wantErr: restrictor.ErrBackendUnavailable,
+		},
+		{
+			name:    "Redis不可用放行",
+			err:     errRedis,
+			opts:    []Option{WithFailOpen()},
+			wantRes: true,
+		},
+		{
+			name: "Redis不可用使用兜底限流器",
+			err:  errRedis,
+			opts: []Option{WithFallback(&fakeLimiter{
+				err: restrictor.NewLimitError(restrictor.Decision{Limit: 1}),
+			})},
+			wantErr: restrictor.ErrLimitExceeded,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			limiter := NewResilientLimiter(&fakeLimiter{err: tc.err}, tc.opts...)
+			res, err := limiter.AllowN(context.Background(), "key", 1)
+			require.ErrorIs(t, err, tc.wantErr)
+			require.Equal(t, tc.wantRes, res)
+		})
+	}
+}
+
+func TestResilientLimiter_Breaker(t *testing.T) {
+	clock := restrictor.NewFakeClock(time.Now())
+	redis := &fakeLimiter{err: errRedis}
+	limiter := NewResilientLimiter(redis, WithClock(clock), WithBreaker(2, time.Second),
+		WithLocalFallback(10, 3, func(limit int64) single.Limiter {
+			return single.NewFixedWindowLimiter(time.Minute, limit, single.WithClock(clock))
+		}))
+	defer limiter.Close()
+	ctx := context.Background()
+
+	// 连续失败两次以后打开熔断器，失败期间使用本地限流器，每个实例分到4
+	for i := 0; i < 2; i++ {
+		res, err := limiter.Allow(ctx, "key")
+		require.NoError(t, err)
+		require.True(t, res)
+	}
+	require.Equal(t, BreakerOpen, limiter.State())
+
+	// 熔断器打开期间不访问Redis
+	for i := 0; i < 2; i++ {
+		res, err := limiter.Allow(ctx, "key")
+		require.NoError(t, err)
+		require.True(t, res)
+	}
+	require.Equal(t, 2, redis.calls)
+	res, err := limiter.Allow(ctx, "key")
+	require.ErrorIs(t, err, restrictor.ErrLimitExceeded)
+	require.False(t, res)
+	// 其他key不受影响
+	res, err = limiter.Allow(ctx, "other")
+	require.NoError(t, err)
+	require.True(t, res)
+
+	// 冷却以后探测失败，重新打开
+	clock.Advance(time.Second)
+	_, _ = limiter.Allow(ctx, "other")
+	require.Equal(t, 3, redis.calls)
+	require.Equal(t, BreakerOpen, limiter.State())
+	_, _ = limiter.Allow(ctx, "other")
+	require.Equal(t, 3, redis.calls)
+
+	// Redis恢复以后探测成功，关闭熔断器
+	redis.err = nil
+	clock.Advance(time.Second)
+	res, err = limiter.Allow(ctx, "key")
+	require.NoError(t, err)
+	require.True(t, res)
+	require.Equal(t, BreakerClosed, limiter.State())
+	require.Equal(t, 4, redis.calls)
+}
+
+func TestResilientLimiter_FailClosed(t *testing.T) {
+	clock := restrictor.NewFakeClock(time.Now())
+	limiter := NewResilientLimiter(&fakeLimiter{err: errRedis}, WithClock(clock), WithBreaker(1, time.Second))
+	_, _ = limiter.Allow(context.Background(), "key")
+	require.Equal(t, BreakerOpen, limiter.State())
+
+	// 熔断器打开期间同样返回Redis不可用
+	res, err := limiter.Allow(context.Background(), "key")
+	require.ErrorIs(t, err, restrictor.ErrBackendUnavailable)
+	require.False(t, res)
+}
+
+func TestLocalLimit(t *testing.T) {
+	testCases := []struct {
+		name      string
+		limit     int64
+		instances int
+		want      int64
+	}{
+		{name: "单个实例", limit: 10, instances: 1, want: 10},
+		{name: "没有实例数量", limit: 10, instances: 0, want: 10},
+		{name: "整除", limit: 10, instances: 5, want: 2},
+		{name: "向上取整", limit: 10, instances: 3, want: 4},
+		{name: "至少是1", limit: 1, instances: 3, want: 1},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.want, LocalLimit(tc.limit, tc.instances))
+		})
+	}
+}
@@ -1,6 +1,9 @@
 package distribute
 
-import "context"
+import (
+	"context"
+	"github.com/liquanhui-99/restrictor"
+)
 
 // DistributedLimiter 分布式场景下使用的限流器接口
 type DistributedLimiter interface {
@@ -8,4 +11,15 @@ type DistributedLimiter interface {
 	// key 是存储在Redis中的键，可以是单个接口，也可以是整个服务
 	// 返回true则通过，返回false和error为不通过
 	Allow(ctx context.Context, key string) (bool, error)
+	// AllowN 是否允许消耗n个单位继续请求，n个单位要么全部消耗，要么一个都不消耗，
+	// n小于等于0时返回restrictor.ErrInvalidCount
+	AllowN(ctx context.Context, key string, n int64) (bool, error)
+}
+
+// DecisionLimiter 可以返回详细判定结果的分布式限流器接口
+type DecisionLimiter interface {
+	DistributedLimiter
+	// Decide 判定是否允许消耗n个单位继续请求，请求被拒绝时不返回error，
+	// 只有Redis不可用等无法判定的情况才返回error
+	Decide(ctx context.Context, key string, n int64) (restrictor.Decision, error)
 }
@@ -0,0 +1,6 @@
+package distribute
+
+import "github.com/liquanhui-99/restrictor/single"
+
+// KeyedLimiter和Redis限流器可以互相替换
+var _ DistributedLimiter = (*single.KeyedLimiter)(nil)
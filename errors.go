@@ -0,0 +1,89 @@
+package restrictor
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrLimitExceeded 请求超过了限流器的限制，被限流器拒绝
+	ErrLimitExceeded = errors.New("restrictor: 超过了限流器的限制")
+	// ErrExceedsCapacity 请求的数量超过了限流器的容量，或者限流器永远不会恢复，等待多久都不会通过
+	ErrExceedsCapacity = errors.New("restrictor: 请求的数量超过了限流器的容量")
+	// ErrLimiterClosed 限流器已经关闭
+	ErrLimiterClosed = errors.New("restrictor: 限流器已经关闭")
+	// ErrBackendUnavailable 限流器依赖的存储不可用，例如Redis连接失败
+	ErrBackendUnavailable = errors.New("restrictor: 限流器的存储不可用")
+	// ErrInvalidCount 请求消耗的单位数量小于等于0
+	ErrInvalidCount = errors.New("restrictor: 请求消耗的数量必须大于0")
+	// ErrTierMismatch 组合限流器请求的key数量和层级的数量不一致
+	ErrTierMismatch = errors.New("restrictor: key的数量和层级的数量不一致")
+	// ErrCrossSlot 多个key的lua脚本在Redis集群中执行时，key不在同一个slot
+	ErrCrossSlot = errors.New("restrictor: Redis集群中的key不在同一个slot")
+)
+
+// LimitError 请求被限流器拒绝时返回的错误，携带判定结果，
+// errors.Is(err, ErrLimitExceeded)返回true
+type LimitError struct {
+	Decision Decision
+}
+
+// NewLimitError 根据判定结果创建LimitError
+func NewLimitError(d Decision) *LimitError {
+	return &LimitError{Decision: d}
+}
+
+func (e *LimitError) Error() string {
+	if e.Decision.RetryAfter > 0 {
+		return fmt.Sprintf("%s, 限流器: %s, 请在%s后重试", ErrLimitExceeded.Error(),
+			e.Decision.Limiter, e.Decision.RetryAfter)
+	}
+	return fmt.Sprintf("%s, 限流器: %s", ErrLimitExceeded.Error(), e.Decision.Limiter)
+}
+
+// Is 让errors.Is(err, ErrLimitExceeded)返回true
+func (e *LimitError) Is(target error) bool {
+	return target == ErrLimitExceeded
+}
+
+// BackendError 限流器依赖的存储返回的错误，errors.Is(err, ErrBackendUnavailable)返回true，
+// 通过errors.Unwrap可以拿到存储返回的原始错误
+type BackendError struct {
+	Err error
+}
+
+// NewBackendError 包装存储返回的错误
+func NewBackendError(err error) *BackendError {
+	return &BackendError{Err: err}
+}
+
+func (e *BackendError) Error() string {
+	return fmt.Sprintf("%s: %s", ErrBackendUnavailable.Error(), e.Err.Error())
+}
+
+// Is 让errors.Is(err, ErrBackendUnavailable)返回true
+func (e *BackendError) Is(target error) bool {
+	return target == ErrBackendUnavailable
+}
+
+func (e *BackendError) Unwrap() error {
+	return e.Err
+}
+
+// DecisionOf 从限流器返回的错误中取出判定结果，err不是LimitError时返回false
+func DecisionOf(err error) (Decision, bool) {
+	var le *LimitError
+	if errors.As(err, &le) {
+		return le.Decision, true
+	}
+	return Decision{}, false
+}
+
+// CheckCount 检查请求消耗的单位数量，n小于等于0时返回ErrInvalidCount，
+// 避免负数的n反向增加限流器的额度
+func CheckCount(n int64) error {
+	if n <= 0 {
+		return ErrInvalidCount
+	}
+	return nil
+}
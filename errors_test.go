@@ -0,0 +1,55 @@
+package restrictor
+
+import (
+	"errors"
+	"fmt"
+	"github.com/go-playground/assert/v2"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestLimitError(t *testing.T) {
+	d := Decision{
+		Limit:      10,
+		RetryAfter: time.Second,
+		Limiter:    FixedWindow,
+	}
+	err := fmt.Errorf("访问/profile: %w", NewLimitError(d))
+	require.ErrorIs(t, err, ErrLimitExceeded)
+	require.False(t, errors.Is(err, ErrBackendUnavailable))
+	assert.Equal(t, "访问/profile: restrictor: 超过了限流器的限制, 限流器: fixed_window, 请在1s后重试", err.Error())
+
+	res, ok := DecisionOf(err)
+	require.True(t, ok)
+	assert.Equal(t, d, res)
+
+	_, ok = DecisionOf(errors.New("其他错误"))
+	require.False(t, ok)
+}
+
+func TestBackendError(t *testing.T) {
+	cause := errors.New("dial tcp 127.0.0.1:6379: connect: connection refused")
+	err := NewBackendError(cause)
+	require.ErrorIs(t, err, ErrBackendUnavailable)
+	require.ErrorIs(t, err, cause)
+	require.False(t, errors.Is(err, ErrLimitExceeded))
+	assert.Equal(t, "restrictor: 限流器的存储不可用: dial tcp 127.0.0.1:6379: connect: connection refused", err.Error())
+}
+
+func TestCheckCount(t *testing.T) {
+	testCases := []struct {
+		name    string
+		n       int64
+		wantErr error
+	}{
+		{name: "正数", n: 1},
+		{name: "0", n: 0, wantErr: ErrInvalidCount},
+		{name: "负数", n: -100, wantErr: ErrInvalidCount},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			require.ErrorIs(t, CheckCount(tc.n), tc.wantErr)
+		})
+	}
+}
@@ -2,66 +2,79 @@ package expand
 
 import (
 	"context"
-	"errors"
+	"github.com/liquanhui-99/restrictor"
 	"github.com/liquanhui-99/restrictor/single"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 // IpLimiter 基于限流器基础上实现的ip限流器
 type IpLimiter struct {
-	// 本地缓存ip数据，key是ip地址，val是请求的数量
-	ips map[string]int64
+	// 本地缓存ip数据，key是ip地址，val是请求的数量，按照ip分段加锁
+	ips *restrictor.ShardedCounter
 	// 组合单体的限流接口
 	limiter single.Limiter
-	// 加读写锁控制本地缓存
-	mu sync.RWMutex
 	// 限流ip的间隔，多久重置一次ip限流
 	interval time.Duration
 	// 关闭限流器
 	close chan struct{}
+	// once 控制只能关闭一次
+	once sync.Once
 	// 单个ip单位时间内最大的请求数
 	maxCount int64
+	// resetAt 下一次重置ip缓存的时间，单位是纳秒
+	resetAt int64
+	// clock 获取时间和创建定时器的时钟
+	clock restrictor.Clock
 }
 
 // NewIpLimiter 初始化Ip限流器
 // limiter是单体限流器的实现
 // interval是重置ip缓存的间隔，也是ip计数的周期，例如：1分钟内单个ip只允许有100次请求，那间隔就是time.Minute
 // maxCount 间隔内单个ip的最大请求数限制
-func NewIpLimiter(limiter single.Limiter, interval time.Duration, maxCount int64) *IpLimiter {
+func NewIpLimiter(limiter single.Limiter, interval time.Duration, maxCount int64, opts ...Option) *IpLimiter {
+	o := newOptions(opts)
 	closeCh := make(chan struct{})
 	res := &IpLimiter{
-		ips:      map[string]int64{},
+		ips:      restrictor.NewShardedCounter(0),
 		limiter:  limiter,
+		interval: interval,
 		close:    closeCh,
-		mu:       sync.RWMutex{},
 		maxCount: maxCount,
+		resetAt:  o.clock.Now().Add(interval).UnixNano(),
+		clock:    o.clock,
 	}
+	ticker := o.clock.NewTicker(interval)
 	go func() {
-		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
 		for {
 			select {
 			case <-closeCh:
 				// 退出
 				return
-			case <-ticker.C:
+			case now := <-ticker.C():
 				// 过了单位时间，重新计算
-				res.mu.Lock()
-				res.ips = map[string]int64{}
-				res.mu.Unlock()
+				res.ips.Reset()
+				atomic.StoreInt64(&res.resetAt, now.Add(interval).UnixNano())
 			}
 		}
 	}()
 	return res
 }
 
+// AllowIp 是否允许ip继续请求，单个ip超过单位时间内的最大请求数时返回restrictor.LimitError，
+// 限流器关闭以后返回restrictor.ErrLimiterClosed
 func (l *IpLimiter) AllowIp(ctx context.Context, ip string) (bool, error) {
+	select {
+	case <-l.close:
+		return false, restrictor.ErrLimiterClosed
+	default:
+	}
+
 	// 快路径
-	l.mu.RLock()
-	cnt, ok := l.ips[ip]
-	l.mu.RUnlock()
-	if ok && cnt >= l.maxCount {
-		return false, errors.New("单位时间ip达到最大数量限制")
+	if l.ips.Get(ip) >= l.maxCount {
+		return false, l.limitError()
 	}
 
 	// 慢路径
@@ -71,32 +84,34 @@ func (l *IpLimiter) AllowIp(ctx context.Context, ip string) (bool, error) {
 	}
 
 	if !res {
-		return false, errors.New("达到性能瓶颈")
-	}
-
-	l.mu.RLock()
-	cnt, ok = l.ips[ip]
-	l.mu.RUnlock()
-	if ok && cnt >= l.maxCount {
-		return false, errors.New("单位时间ip达到最大数量限制")
+		return false, restrictor.ErrLimitExceeded
 	}
 
-	l.mu.Lock()
-	defer l.mu.Unlock()
-	cnt, ok = l.ips[ip]
-	if !ok {
-		l.ips[ip] = 1
-		return true, nil
+	if ok, _ := l.ips.AddIfBelow(ip, 1, l.maxCount); !ok {
+		return false, l.limitError()
 	}
-	if cnt >= l.maxCount {
-		return false, errors.New("单位时间ip达到最大数量限制")
-	}
-	l.ips[ip] = cnt + 1
 	return true, nil
+}
 
+// limitError 单个ip达到单位时间内最大请求数量时返回的错误，需要等到下一次重置ip缓存
+func (l *IpLimiter) limitError() error {
+	resetAt := time.Unix(0, atomic.LoadInt64(&l.resetAt))
+	retryAfter := resetAt.Sub(l.clock.Now())
+	if retryAfter < 0 {
+		retryAfter = 0
+	}
+	return restrictor.NewLimitError(restrictor.Decision{
+		Limit:      l.maxCount,
+		ResetAt:    resetAt,
+		RetryAfter: retryAfter,
+		Limiter:    restrictor.Ip,
+	})
 }
 
+// Close 关闭ip限流器和组合的单体限流器，可以重复调用
 func (l *IpLimiter) Close() {
-	l.limiter.Close()
-	close(l.close)
+	l.once.Do(func() {
+		l.limiter.Close()
+		close(l.close)
+	})
 }
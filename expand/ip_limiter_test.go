@@ -4,11 +4,57 @@ import (
 	"context"
 	"fmt"
 	"github.com/gin-gonic/gin"
+	"github.com/liquanhui-99/restrictor"
 	"github.com/liquanhui-99/restrictor/single"
+	"github.com/stretchr/testify/require"
 	"net/http"
+	"testing"
 	"time"
 )
 
+func TestIpLimiter_AllowIp(t *testing.T) {
+	clock := restrictor.NewFakeClock(time.Now())
+	limiter := single.NewSlideWindowLimiter(time.Minute, 10000, single.WithClock(clock))
+	ipLimiter := NewIpLimiter(limiter, time.Minute, 2, WithClock(clock))
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	for i := 0; i < 2; i++ {
+		res, err := ipLimiter.AllowIp(ctx, "127.0.0.1")
+		require.NoError(t, err)
+		require.True(t, res)
+	}
+
+	// 单个ip超过了单位时间内的最大请求数
+	res, err := ipLimiter.AllowIp(ctx, "127.0.0.1")
+	require.ErrorIs(t, err, restrictor.ErrLimitExceeded)
+	require.False(t, res)
+	d, ok := restrictor.DecisionOf(err)
+	require.True(t, ok)
+	require.Equal(t, int64(2), d.Limit)
+	require.Equal(t, restrictor.Ip, d.Limiter)
+	require.Equal(t, time.Minute, d.RetryAfter)
+
+	// 过了单位时间以后重置
+	clock.Advance(time.Minute)
+	require.Eventually(t, func() bool {
+		res, err = ipLimiter.AllowIp(ctx, "127.0.0.1")
+		return err == nil && res
+	}, time.Second, time.Millisecond)
+
+	// 其他ip不受影响
+	res, err = ipLimiter.AllowIp(ctx, "127.0.0.2")
+	require.NoError(t, err)
+	require.True(t, res)
+
+	// 关闭以后
+	ipLimiter.Close()
+	ipLimiter.Close()
+	res, err = ipLimiter.AllowIp(ctx, "127.0.0.2")
+	require.ErrorIs(t, err, restrictor.ErrLimiterClosed)
+	require.False(t, res)
+}
+
 func ExampleIpLimiter_AllowIp() {
 	limiter := single.NewSlideWindowLimiter(3*time.Millisecond, 10000)
 	ipLimiter := NewIpLimiter(limiter, time.Minute, 10)
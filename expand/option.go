@@ -0,0 +1,29 @@
+package expand
+
+import "github.com/liquanhui-99/restrictor"
+
+// Option expand包中限流器的配置项，所有构造函数都可以传入
+type Option func(*options)
+
+type options struct {
+	// clock 获取时间和创建定时器的时钟
+	clock restrictor.Clock
+}
+
+// WithClock 替换限流器使用的时钟，默认是restrictor.RealClock，测试时可以传入restrictor.FakeClock
+func WithClock(clock restrictor.Clock) Option {
+	return func(o *options) {
+		o.clock = clock
+	}
+}
+
+// newOptions 在默认配置的基础上应用opts
+func newOptions(opts []Option) options {
+	o := options{
+		clock: restrictor.RealClock,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
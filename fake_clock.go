@@ -0,0 +1,194 @@
+package restrictor
+
+import (
+	"sync"
+	"time"
+)
+
+// FakeClock 手动推进的时钟，只有调用Advance时间才会前进，用来编写不依赖真实sleep的测试。
+// 和time.Ticker一样，Ticker的channel只缓存一个触发时间，来不及接收的触发会被丢弃
+type FakeClock struct {
+	mu sync.Mutex
+	// cond 等待的Timer和Ticker发生变化时通知BlockUntil
+	cond *sync.Cond
+	now  time.Time
+	// waiters 还没有触发的Timer和Ticker
+	waiters []*fakeWaiter
+}
+
+// fakeWaiter FakeClock上的Timer或者Ticker
+type fakeWaiter struct {
+	clock *FakeClock
+	// at 下一次触发的时间
+	at time.Time
+	// period Ticker的周期，Timer为0
+	period time.Duration
+	ch     chan time.Time
+}
+
+// NewFakeClock 初始化时间为now的FakeClock
+func NewFakeClock(now time.Time) *FakeClock {
+	c := &FakeClock{now: now}
+	c.cond = sync.NewCond(&c.mu)
+	return c
+}
+
+// Now 当前时间
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// NewTicker 创建周期为d的Ticker，Advance经过触发时间时发送
+func (c *FakeClock) NewTicker(d time.Duration) Ticker {
+	if d <= 0 {
+		panic("restrictor: FakeClock.NewTicker的周期必须大于0")
+	}
+	w := &fakeWaiter{clock: c, period: d, ch: make(chan time.Time, 1)}
+	c.mu.Lock()
+	w.at = c.now.Add(d)
+	c.addLocked(w)
+	c.mu.Unlock()
+	return fakeTicker{w: w}
+}
+
+// NewTimer 创建d以后触发的Timer，d不大于0时立刻触发
+func (c *FakeClock) NewTimer(d time.Duration) Timer {
+	w := &fakeWaiter{clock: c, ch: make(chan time.Time, 1)}
+	c.mu.Lock()
+	w.at = c.now.Add(d)
+	if d <= 0 {
+		w.ch <- c.now
+	} else {
+		c.addLocked(w)
+	}
+	c.mu.Unlock()
+	return fakeTimer{w: w}
+}
+
+// Sleep 阻塞直到其他goroutine通过Advance把时间推进了d
+func (c *FakeClock) Sleep(d time.Duration) {
+	<-c.NewTimer(d).C()
+}
+
+// Advance 把时间推进d，按照触发时间的先后依次触发经过的Timer和Ticker
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	target := c.now.Add(d)
+	for {
+		w := c.earliestLocked()
+		if w == nil || w.at.After(target) {
+			break
+		}
+		c.now = w.at
+		select {
+		case w.ch <- w.at:
+		default:
+		}
+		if w.period > 0 {
+			w.at = w.at.Add(w.period)
+		} else {
+			c.removeLocked(w)
+		}
+	}
+	c.now = target
+}
+
+// BlockUntil 阻塞直到FakeClock上至少有n个还没有触发的Timer和Ticker，
+// 用来确认其他goroutine已经开始等待，再调用Advance
+func (c *FakeClock) BlockUntil(n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for len(c.waiters) < n {
+		c.cond.Wait()
+	}
+}
+
+func (c *FakeClock) addLocked(w *fakeWaiter) {
+	c.waiters = append(c.waiters, w)
+	c.cond.Broadcast()
+}
+
+// removeLocked 移除w，返回w是否还在等待
+func (c *FakeClock) removeLocked(w *fakeWaiter) bool {
+	for i, waiter := range c.waiters {
+		if waiter == w {
+			c.waiters = append(c.waiters[:i], c.waiters[i+1:]...)
+			c.cond.Broadcast()
+			return true
+		}
+	}
+	return false
+}
+
+func (c *FakeClock) earliestLocked() *fakeWaiter {
+	var res *fakeWaiter
+	for _, w := range c.waiters {
+		if res == nil || w.at.Before(res.at) {
+			res = w
+		}
+	}
+	return res
+}
+
+type fakeTicker struct {
+	w *fakeWaiter
+}
+
+func (f fakeTicker) C() <-chan time.Time {
+	return f.w.ch
+}
+
+func (f fakeTicker) Stop() {
+	c := f.w.clock
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.removeLocked(f.w)
+}
+
+func (f fakeTicker) Reset(d time.Duration) {
+	if d <= 0 {
+		panic("restrictor: FakeClock的Ticker周期必须大于0")
+	}
+	c := f.w.clock
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.removeLocked(f.w)
+	f.w.period = d
+	f.w.at = c.now.Add(d)
+	c.addLocked(f.w)
+}
+
+type fakeTimer struct {
+	w *fakeWaiter
+}
+
+func (f fakeTimer) C() <-chan time.Time {
+	return f.w.ch
+}
+
+func (f fakeTimer) Stop() bool {
+	c := f.w.clock
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.removeLocked(f.w)
+}
+
+func (f fakeTimer) Reset(d time.Duration) bool {
+	c := f.w.clock
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	active := c.removeLocked(f.w)
+	f.w.at = c.now.Add(d)
+	if d <= 0 {
+		select {
+		case f.w.ch <- c.now:
+		default:
+		}
+	} else {
+		c.addLocked(f.w)
+	}
+	return active
+}
@@ -0,0 +1,81 @@
+package restrictor
+
+import (
+	"github.com/go-playground/assert/v2"
+	"testing"
+	"time"
+)
+
+func TestFakeClock_Timer(t *testing.T) {
+	start := time.Date(2023, 9, 5, 12, 0, 0, 0, time.UTC)
+	clock := NewFakeClock(start)
+	timer := clock.NewTimer(time.Second)
+
+	// 还没有到触发时间
+	clock.Advance(999 * time.Millisecond)
+	select {
+	case <-timer.C():
+		t.Fatal("timer不应该触发")
+	default:
+	}
+
+	clock.Advance(time.Millisecond)
+	assert.Equal(t, start.Add(time.Second), <-timer.C())
+	assert.Equal(t, false, timer.Stop())
+
+	// 重新设置以后可以再次触发
+	assert.Equal(t, false, timer.Reset(time.Second))
+	assert.Equal(t, true, timer.Stop())
+	clock.Advance(time.Hour)
+	select {
+	case <-timer.C():
+		t.Fatal("停止的timer不应该触发")
+	default:
+	}
+	assert.Equal(t, start.Add(time.Hour+time.Second), clock.Now())
+}
+
+func TestFakeClock_Ticker(t *testing.T) {
+	start := time.Date(2023, 9, 5, 12, 0, 0, 0, time.UTC)
+	clock := NewFakeClock(start)
+	ticker := clock.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for i := 1; i <= 3; i++ {
+		clock.Advance(time.Second)
+		assert.Equal(t, start.Add(time.Duration(i)*time.Second), <-ticker.C())
+	}
+
+	// 来不及接收的触发会被丢弃，只保留第一次触发
+	clock.Advance(3 * time.Second)
+	assert.Equal(t, start.Add(4*time.Second), <-ticker.C())
+	select {
+	case <-ticker.C():
+		t.Fatal("ticker只缓存一次触发")
+	default:
+	}
+
+	// 修改周期
+	ticker.Reset(time.Minute)
+	clock.Advance(time.Minute)
+	assert.Equal(t, start.Add(6*time.Second+time.Minute), <-ticker.C())
+}
+
+func TestFakeClock_Sleep(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	done := make(chan struct{})
+	go func() {
+		clock.Sleep(time.Minute)
+		close(done)
+	}()
+	clock.BlockUntil(1)
+	clock.Advance(time.Minute)
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Sleep没有在推进时间以后返回")
+	}
+
+	// 不大于0的时长直接返回
+	clock.Sleep(0)
+}
@@ -0,0 +1,111 @@
+package rules
+
+import (
+	"errors"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"os"
+	"time"
+)
+
+// ErrInvalidRule 规则的配置不合法
+var ErrInvalidRule = errors.New("rules: 规则配置不合法")
+
+// 支持的限流算法
+const (
+	TokenBucket        = "token_bucket"
+	FixedWindow        = "fixed_window"
+	SlideWindow        = "slide_window"
+	SlideWindowCounter = "slide_window_counter"
+	LeakyBucket        = "leaky_bucket"
+	GCRA               = "gcra"
+)
+
+// 支持的限流器存储
+const (
+	// BackendSingle 单机限流，计数保存在进程内
+	BackendSingle = "single"
+	// BackendRedis 分布式限流，计数保存在Redis中
+	BackendRedis = "redis"
+)
+
+// Config 限流规则的配置，可以是YAML，也可以是JSON
+type Config struct {
+	Rules []Rule `yaml:"rules" json:"rules"`
+}
+
+// Rule 一条限流规则，请求满足Match时按照Key区分计数，使用Algorithm和Backend创建的限流器判断是否放行
+type Rule struct {
+	// Name 规则的名称，不能重复，也是Redis中key的一部分
+	Name string `yaml:"name" json:"name"`
+	// Match 匹配请求的条件
+	Match Match `yaml:"match" json:"match"`
+	// Key 按照什么区分计数：ip、user、route或者header:<名称>，为空时所有请求共用一个计数
+	Key string `yaml:"key" json:"key"`
+	// Algorithm 限流算法
+	Algorithm string `yaml:"algorithm" json:"algorithm"`
+	// Backend 限流器的存储，默认是single
+	Backend string `yaml:"backend" json:"backend"`
+	// Limit 窗口内或者周期内允许的最大请求数量，用于fixed_window、slide_window、slide_window_counter和gcra
+	Limit int64 `yaml:"limit" json:"limit"`
+	// Interval 窗口的大小、GCRA的周期或者漏桶流出的间隔
+	Interval Duration `yaml:"interval" json:"interval"`
+	// Rate 令牌桶每秒补充的令牌数量，可以是小数
+	Rate float64 `yaml:"rate" json:"rate"`
+	// Burst 令牌桶、漏桶的容量或者GCRA允许的突发数量
+	Burst int64 `yaml:"burst" json:"burst"`
+	// TTL backend是single时key空闲多久以后淘汰，默认10分钟
+	TTL Duration `yaml:"ttl" json:"ttl"`
+	// MaxKeys backend是single时最多保存的key数量，默认10000
+	MaxKeys int `yaml:"max_keys" json:"max_keys"`
+}
+
+// Match 匹配请求的条件，配置了的条件都满足时才匹配，同一个条件中的多个值满足一个即可，
+// 没有配置任何条件时匹配所有请求
+type Match struct {
+	// Routes 请求的路由，支持path.Match的通配符，例如/api/*
+	Routes []string `yaml:"routes" json:"routes"`
+	// Methods 请求的方法，不区分大小写
+	Methods []string `yaml:"methods" json:"methods"`
+	// Headers 请求头的名称和值，值是*时只要求请求头存在
+	Headers map[string]string `yaml:"headers" json:"headers"`
+	// CIDRs 请求的ip所在的网段，也可以是单个ip
+	CIDRs []string `yaml:"cidrs" json:"cidrs"`
+	// Users 请求的用户id，*匹配所有登录的用户
+	Users []string `yaml:"users" json:"users"`
+}
+
+// Duration 配置中的时长，格式和time.ParseDuration一致，例如1s、500ms
+type Duration time.Duration
+
+// UnmarshalYAML 解析time.ParseDuration格式的字符串
+func (d *Duration) UnmarshalYAML(value *yaml.Node) error {
+	var s string
+	if err := value.Decode(&s); err != nil {
+		return err
+	}
+	dur, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(dur)
+	return nil
+}
+
+// Parse 解析限流规则的配置，JSON是YAML的子集，两种格式都可以直接解析
+func Parse(data []byte) (*Config, error) {
+	cfg := &Config{}
+	if err := yaml.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("rules: 解析配置失败: %w", err)
+	}
+	return cfg, nil
+}
+
+// LoadFile 读取并解析path中的限流规则
+func LoadFile(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(data)
+}
@@ -0,0 +1,89 @@
+package rules
+
+import (
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	testCases := []struct {
+		name    string
+		data    string
+		want    *Config
+		wantErr bool
+	}{
+		{
+			name: "yaml",
+			data: `
+rules:
+  - name: login
+    match:
+      routes: ["/login"]
+      methods: [post]
+      headers:
+        X-Tenant: "*"
+      cidrs: [10.0.0.0/8]
+      users: ["*"]
+    key: ip
+    algorithm: token_bucket
+    backend: redis
+    rate: 0.5
+    burst: 5
+    ttl: 1m
+`,
+			want: &Config{Rules: []Rule{{
+				Name: "login",
+				Match: Match{
+					Routes:  []string{"/login"},
+					Methods: []string{"post"},
+					Headers: map[string]string{"X-Tenant": "*"},
+					CIDRs:   []string{"10.0.0.0/8"},
+					Users:   []string{"*"},
+				},
+				Key:       "ip",
+				Algorithm: TokenBucket,
+				Backend:   BackendRedis,
+				Rate:      0.5,
+				Burst:     5,
+				TTL:       Duration(time.Minute),
+			}}},
+		},
+		{
+			name: "json",
+			data: `{"rules": [{"name": "api", "match": {"routes": ["/api/*"]}, "key": "user",
+				"algorithm": "fixed_window", "limit": 100, "interval": "1s", "max_keys": 10}]}`,
+			want: &Config{Rules: []Rule{{
+				Name:      "api",
+				Match:     Match{Routes: []string{"/api/*"}},
+				Key:       "user",
+				Algorithm: FixedWindow,
+				Limit:     100,
+				Interval:  Duration(time.Second),
+				MaxKeys:   10,
+			}}},
+		},
+		{
+			name:    "invalid duration",
+			data:    "rules:\n  - name: a\n    interval: 1x\n",
+			wantErr: true,
+		},
+		{
+			name:    "invalid format",
+			data:    "rules: [",
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg, err := Parse([]byte(tc.data))
+			if tc.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.want, cfg)
+		})
+	}
+}
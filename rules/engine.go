@@ -0,0 +1,316 @@
+package rules
+
+import (
+	"context"
+	"fmt"
+	"github.com/liquanhui-99/restrictor/distribute"
+	"github.com/liquanhui-99/restrictor/distribute/Redis"
+	"github.com/liquanhui-99/restrictor/single"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// defaultTTL backend是single时key默认的空闲淘汰时间
+	defaultTTL = 10 * time.Minute
+	// defaultMaxKeys backend是single时默认最多保存的key数量
+	defaultMaxKeys = 10000
+)
+
+// Engine 根据配置创建的限流规则，按照配置的顺序匹配请求
+type Engine struct {
+	rules []*rule
+}
+
+// rule 编译以后的规则
+type rule struct {
+	Rule
+	matcher *matcher
+	limiter distribute.DistributedLimiter
+	// close 关闭限流器，backend是redis时为nil
+	close func()
+	// keyed backend是single时按照key创建的限流器，backend是redis时为nil
+	keyed *single.KeyedLimiter
+	// params keyed创建新的限流器使用的参数，沿用限流器时替换成新的参数
+	params *atomic.Pointer[Rule]
+	// prev 沿用了之前的规则的限流器，新的规则生效以后置为nil
+	prev *rule
+}
+
+// NewEngine 校验配置并通过各个限流器的构造函数创建规则，配置不合法时返回ErrInvalidRule
+func NewEngine(cfg *Config, opts ...Option) (*Engine, error) {
+	return newEngine(cfg, newOptions(opts), nil)
+}
+
+// newEngine 校验配置并创建规则，prev中名称相同的单机规则只有match或者算法的参数变化时沿用prev的限流器，
+// 通过SetRate、SetBurst、SetLimit和SetInterval修改参数，已经记录的计数和排队的请求保留，
+// 配置不合法时prev不受影响；创建成功以后需要关闭prev，只会关闭没有被沿用的规则
+func newEngine(cfg *Config, o options, prev *Engine) (*Engine, error) {
+	e := &Engine{rules: make([]*rule, 0, len(cfg.Rules))}
+	names := make(map[string]struct{}, len(cfg.Rules))
+	for _, r := range cfg.Rules {
+		if _, ok := names[r.Name]; ok {
+			e.abort()
+			return nil, fmt.Errorf("%w: 规则%s重复", ErrInvalidRule, r.Name)
+		}
+		names[r.Name] = struct{}{}
+		compiled, err := newRule(r, o, prev.lookup(r.Name))
+		if err != nil {
+			e.abort()
+			return nil, fmt.Errorf("%w: 规则%s: %s", ErrInvalidRule, r.Name, err)
+		}
+		e.rules = append(e.rules, compiled)
+	}
+	// 所有规则都合法以后再修改沿用的限流器
+	for _, r := range e.rules {
+		if r.prev == nil {
+			continue
+		}
+		r.apply(r.prev.Rule)
+		r.prev.close = nil
+		r.prev = nil
+	}
+	return e, nil
+}
+
+// lookup 名称为name的规则，e为nil或者没有找到时返回nil
+func (e *Engine) lookup(name string) *rule {
+	if e == nil {
+		return nil
+	}
+	for _, r := range e.rules {
+		if r.Name == name {
+			return r
+		}
+	}
+	return nil
+}
+
+// abort 创建失败时关闭新创建的限流器，沿用的限流器还在被之前的规则使用
+func (e *Engine) abort() {
+	for _, r := range e.rules {
+		if r.prev == nil && r.close != nil {
+			r.close()
+		}
+	}
+}
+
+// newRule 校验规则并创建限流器，prev可以沿用时使用prev的限流器
+func newRule(r Rule, o options, prev *rule) (*rule, error) {
+	if r.Name == "" {
+		return nil, fmt.Errorf("名称不能为空")
+	}
+	if err := validKey(r.Key); err != nil {
+		return nil, err
+	}
+	m, err := newMatcher(r.Match)
+	if err != nil {
+		return nil, err
+	}
+	if err = validParams(r); err != nil {
+		return nil, err
+	}
+	res := &rule{Rule: r, matcher: m}
+	if prev.reusable(r) {
+		res.limiter, res.close, res.keyed, res.params, res.prev = prev.limiter, prev.close, prev.keyed, prev.params, prev
+		return res, nil
+	}
+	switch r.Backend {
+	case "", BackendSingle:
+		ttl, maxKeys := time.Duration(r.TTL), r.MaxKeys
+		if ttl <= 0 {
+			ttl = defaultTTL
+		}
+		if maxKeys <= 0 {
+			maxKeys = defaultMaxKeys
+		}
+		params := &atomic.Pointer[Rule]{}
+		params.Store(&r)
+		keyed := single.NewKeyedLimiter(func(string) single.Limiter {
+			return newSingle(*params.Load(), o)
+		}, ttl, maxKeys, single.WithClock(o.clock))
+		res.limiter, res.close, res.keyed, res.params = keyed, keyed.Close, keyed, params
+	case BackendRedis:
+		if o.client == nil {
+			return nil, fmt.Errorf("backend是redis时需要通过WithRedis设置Redis客户端")
+		}
+		res.limiter, err = newRedis(r, o)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("不支持的backend%s", r.Backend)
+	}
+	return res, nil
+}
+
+// reusable next是否可以沿用r的限流器，只有backend是single，并且algorithm、key、ttl和max_keys都没有变化时可以沿用，
+// r为nil时返回false
+func (r *rule) reusable(next Rule) bool {
+	if r == nil || r.keyed == nil || r.close == nil {
+		return false
+	}
+	if next.Backend != "" && next.Backend != BackendSingle {
+		return false
+	}
+	return next.Algorithm == r.Algorithm && next.Key == r.Key && next.TTL == r.TTL && next.MaxKeys == r.MaxKeys
+}
+
+// apply 把规则的参数应用到已经创建的限流器，只修改和old不同的参数，之后创建的限流器直接使用新的参数
+func (r *rule) apply(old Rule) {
+	params := r.Rule
+	r.params.Store(&params)
+	r.keyed.Range(func(_ string, limiter single.Limiter) {
+		if l, ok := limiter.(interface{ SetRate(float64) }); ok && params.Rate != old.Rate {
+			l.SetRate(params.Rate)
+		}
+		if l, ok := limiter.(interface{ SetBurst(int64) }); ok && params.Burst != old.Burst {
+			l.SetBurst(params.Burst)
+		}
+		if l, ok := limiter.(interface{ SetLimit(int64) }); ok && params.Limit != old.Limit {
+			l.SetLimit(params.Limit)
+		}
+		if l, ok := limiter.(interface{ SetInterval(time.Duration) }); ok && params.Interval != old.Interval {
+			l.SetInterval(time.Duration(params.Interval))
+		}
+	})
+}
+
+// validKey 校验区分计数的维度
+func validKey(key string) error {
+	switch {
+	case key == "", key == "ip", key == "user", key == "route":
+		return nil
+	case strings.HasPrefix(key, "header:") && len(key) > len("header:"):
+		return nil
+	default:
+		return fmt.Errorf("不支持的key%s", key)
+	}
+}
+
+// validParams 校验算法需要的参数
+func validParams(r Rule) error {
+	switch r.Algorithm {
+	case TokenBucket:
+		if r.Rate <= 0 || r.Burst <= 0 {
+			return fmt.Errorf("%s的rate和burst必须大于0", r.Algorithm)
+		}
+	case FixedWindow, SlideWindow, SlideWindowCounter:
+		if r.Limit <= 0 || r.Interval <= 0 {
+			return fmt.Errorf("%s的limit和interval必须大于0", r.Algorithm)
+		}
+	case LeakyBucket:
+		if r.Interval <= 0 || r.Burst <= 0 {
+			return fmt.Errorf("%s的interval和burst必须大于0", r.Algorithm)
+		}
+	case GCRA:
+		if r.Limit <= 0 || r.Interval <= 0 || r.Burst <= 0 {
+			return fmt.Errorf("%s的limit、interval和burst必须大于0", r.Algorithm)
+		}
+	default:
+		return fmt.Errorf("不支持的algorithm%s", r.Algorithm)
+	}
+	return nil
+}
+
+// newSingle 创建一个key对应的单机限流器
+func newSingle(r Rule, o options) single.Limiter {
+	interval := time.Duration(r.Interval)
+	opt := single.WithClock(o.clock)
+	switch r.Algorithm {
+	case TokenBucket:
+		// 惰性补充的令牌桶不需要为每个key启动goroutine，语义和Redis令牌桶一致
+		return single.NewLazyTokenBucketLimiter(r.Rate, r.Burst, opt)
+	case FixedWindow:
+		return single.NewFixedWindowLimiter(interval, r.Limit, opt)
+	case SlideWindow:
+		return single.NewSlideWindowLimiter(interval, r.Limit, opt)
+	case SlideWindowCounter:
+		return single.NewSlideWindowCounterLimiter(interval, r.Limit, opt)
+	case LeakyBucket:
+		return single.NewLeakeyBucketLimiter(interval, single.WithCapacity(r.Burst), opt)
+	default:
+		return single.NewGCRALimiter(interval, r.Limit, r.Burst, opt)
+	}
+}
+
+// newRedis 创建规则对应的Redis限流器
+func newRedis(r Rule, o options) (distribute.DistributedLimiter, error) {
+	interval := time.Duration(r.Interval)
+	opt := Redis.WithClock(o.clock)
+	switch r.Algorithm {
+	case TokenBucket:
+		return Redis.NewTokenBucketLimiter(o.client, r.Rate, r.Burst, opt), nil
+	case FixedWindow:
+		return Redis.NewFixedWindowLimiter(o.client, r.Limit, interval, opt), nil
+	case SlideWindow:
+		return Redis.NewSlideWindowLimiter(o.client, r.Limit, interval, opt), nil
+	case SlideWindowCounter:
+		return Redis.NewSlideWindowCounterLimiter(o.client, r.Limit, interval, opt), nil
+	case GCRA:
+		return Redis.NewGCRALimiter(o.client, interval, r.Limit, r.Burst, opt), nil
+	default:
+		return nil, fmt.Errorf("backend是redis时不支持%s", r.Algorithm)
+	}
+}
+
+// Match 返回请求匹配的规则，按照配置的顺序排列
+func (e *Engine) Match(req Request) []Rule {
+	var res []Rule
+	for _, r := range e.rules {
+		if r.matcher.match(req) {
+			res = append(res, r.Rule)
+		}
+	}
+	return res
+}
+
+// Allow 请求是否通过所有匹配的规则
+func (e *Engine) Allow(ctx context.Context, req Request) (bool, error) {
+	return e.AllowN(ctx, req, 1)
+}
+
+// AllowN 请求消耗n个单位，按照配置的顺序检查所有匹配的规则，被一条规则拒绝时直接返回这条规则的错误，
+// 后面的规则不再检查，前面的规则已经消耗的数量不会归还；没有匹配的规则时直接放行
+func (e *Engine) AllowN(ctx context.Context, req Request, n int64) (bool, error) {
+	for _, r := range e.rules {
+		if !r.matcher.match(req) {
+			continue
+		}
+		ok, err := r.limiter.AllowN(ctx, r.key(req), n)
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// key 请求在规则中计数使用的key，backend是redis时加上规则的名称作为前缀
+func (r *rule) key(req Request) string {
+	var val string
+	switch {
+	case r.Key == "ip":
+		val = req.IP
+	case r.Key == "user":
+		val = req.UserID
+	case r.Key == "route":
+		val = req.Route
+	case strings.HasPrefix(r.Key, "header:"):
+		val = req.Header.Get(strings.TrimPrefix(r.Key, "header:"))
+	}
+	if r.Backend == BackendRedis {
+		return "rules:" + r.Name + ":" + val
+	}
+	return val
+}
+
+// Close 关闭所有单机限流器，关闭以后backend是single的规则返回restrictor.ErrLimiterClosed，
+// 被Watcher重新加载的规则沿用的限流器不会关闭
+func (e *Engine) Close() {
+	for _, r := range e.rules {
+		if r.close != nil {
+			r.close()
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package rules
+
+import (
+	"context"
+	"github.com/go-playground/assert/v2"
+	"github.com/liquanhui-99/restrictor"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestNewEngine(t *testing.T) {
+	testCases := []struct {
+		name    string
+		rules   []Rule
+		opts    []Option
+		wantErr error
+	}{
+		{
+			name: "valid",
+			rules: []Rule{
+				{Name: "a", Algorithm: TokenBucket, Rate: 1, Burst: 1},
+				{Name: "b", Algorithm: LeakyBucket, Interval: Duration(time.Second), Burst: 1, Key: "header:X-Tenant"},
+				{Name: "c", Algorithm: GCRA, Backend: BackendRedis, Limit: 1, Interval: Duration(time.Second), Burst: 1},
+			},
+			opts: []Option{WithRedis(redis.NewClient(&redis.Options{}))},
+		},
+		{
+			name: "duplicate name",
+			rules: []Rule{
+				{Name: "a", Algorithm: TokenBucket, Rate: 1, Burst: 1},
+				{Name: "a", Algorithm: TokenBucket, Rate: 1, Burst: 1},
+			},
+			wantErr: ErrInvalidRule,
+		},
+		{
+			name:    "empty name",
+			rules:   []Rule{{Algorithm: TokenBucket, Rate: 1, Burst: 1}},
+			wantErr: ErrInvalidRule,
+		},
+		{
+			name:    "unknown algorithm",
+			rules:   []Rule{{Name: "a", Algorithm: "unknown"}},
+			wantErr: ErrInvalidRule,
+		},
+		{
+			name:    "invalid params",
+			rules:   []Rule{{Name: "a", Algorithm: FixedWindow, Limit: 10}},
+			wantErr: ErrInvalidRule,
+		},
+		{
+			name:    "token bucket without rate",
+			rules:   []Rule{{Name: "a", Algorithm: TokenBucket, Burst: 1}},
+			wantErr: ErrInvalidRule,
+		},
+		{
+			name:    "negative rate",
+			rules:   []Rule{{Name: "a", Algorithm: TokenBucket, Rate: -5, Burst: 1}},
+			wantErr: ErrInvalidRule,
+		},
+		{
+			name:    "unknown key",
+			rules:   []Rule{{Name: "a", Algorithm: TokenBucket, Rate: 1, Burst: 1, Key: "cookie"}},
+			wantErr: ErrInvalidRule,
+		},
+		{
+			name:    "unknown backend",
+			rules:   []Rule{{Name: "a", Algorithm: TokenBucket, Rate: 1, Burst: 1, Backend: "memcached"}},
+			wantErr: ErrInvalidRule,
+		},
+		{
+			name:    "redis without client",
+			rules:   []Rule{{Name: "a", Algorithm: TokenBucket, Rate: 1, Burst: 1, Backend: BackendRedis}},
+			wantErr: ErrInvalidRule,
+		},
+		{
+			name: "redis leaky bucket",
+			rules: []Rule{{Name: "a", Algorithm: LeakyBucket, Interval: Duration(time.Second), Burst: 1,
+				Backend: BackendRedis}},
+			opts:    []Option{WithRedis(redis.NewClient(&redis.Options{}))},
+			wantErr: ErrInvalidRule,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			e, err := NewEngine(&Config{Rules: tc.rules}, tc.opts...)
+			require.ErrorIs(t, err, tc.wantErr)
+			if err == nil {
+				e.Close()
+			}
+		})
+	}
+}
+
+func TestEngine_AllowN(t *testing.T) {
+	clock := restrictor.NewFakeClock(time.Now())
+	e, err := NewEngine(&Config{Rules: []Rule{
+		{
+			Name:      "login",
+			Match:     Match{Routes: []string{"/login"}, Methods: []string{"POST"}},
+			Key:       "ip",
+			Algorithm: FixedWindow,
+			Limit:     2,
+			Interval:  Duration(time.Minute),
+		},
+		{
+			Name:      "global",
+			Algorithm: TokenBucket,
+			Rate:      1,
+			Burst:     3,
+		},
+	}}, WithClock(clock))
+	require.NoError(t, err)
+	defer e.Close()
+
+	login := Request{Route: "/login", Method: "POST", IP: "10.0.0.1"}
+	names := func(rules []Rule) []string {
+		var res []string
+		for _, r := range rules {
+			res = append(res, r.Name)
+		}
+		return res
+	}
+	assert.Equal(t, []string{"login", "global"}, names(e.Match(login)))
+	assert.Equal(t, []string{"global"}, names(e.Match(Request{Route: "/"})))
+
+	// 按照ip区分计数
+	require.NoError(t, allow(e, login))
+	require.NoError(t, allow(e, login))
+	err = allow(e, login)
+	require.ErrorIs(t, err, restrictor.ErrLimitExceeded)
+	d, ok := restrictor.DecisionOf(err)
+	require.True(t, ok)
+	assert.Equal(t, restrictor.FixedWindow, d.Limiter)
+
+	// 其他ip不受影响，但是受全局的令牌桶限制
+	login.IP = "10.0.0.2"
+	require.NoError(t, allow(e, login))
+	err = allow(e, login)
+	require.ErrorIs(t, err, restrictor.ErrLimitExceeded)
+	d, ok = restrictor.DecisionOf(err)
+	require.True(t, ok)
+	assert.Equal(t, restrictor.LazyTokenBucket, d.Limiter)
+
+	// 关闭以后返回错误
+	e.Close()
+	require.ErrorIs(t, allow(e, login), restrictor.ErrLimiterClosed)
+}
+
+func allow(e interface {
+	Allow(ctx context.Context, req Request) (bool, error)
+}, req Request) error {
+	_, err := e.Allow(context.Background(), req)
+	return err
+}
@@ -0,0 +1,156 @@
+package rules
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// Request 用来匹配规则的请求信息
+type Request struct {
+	// Route 请求的路由
+	Route string
+	// Method 请求的方法
+	Method string
+	// Header 请求头
+	Header http.Header
+	// IP 请求的来源ip
+	IP string
+	// UserID 请求的用户id，没有登录时为空
+	UserID string
+}
+
+// matcher 编译以后的匹配条件
+type matcher struct {
+	routes  []string
+	methods []string
+	headers map[string]string
+	nets    []*net.IPNet
+	users   []string
+}
+
+// newMatcher 校验并编译匹配条件
+func newMatcher(m Match) (*matcher, error) {
+	res := &matcher{
+		routes:  m.Routes,
+		methods: make([]string, 0, len(m.Methods)),
+		headers: make(map[string]string, len(m.Headers)),
+		users:   m.Users,
+	}
+	for _, route := range m.Routes {
+		if _, err := path.Match(route, ""); err != nil {
+			return nil, fmt.Errorf("路由%s: %w", route, err)
+		}
+	}
+	for _, method := range m.Methods {
+		res.methods = append(res.methods, strings.ToUpper(method))
+	}
+	for name, val := range m.Headers {
+		res.headers[http.CanonicalHeaderKey(name)] = val
+	}
+	for _, cidr := range m.CIDRs {
+		if !strings.Contains(cidr, "/") {
+			// 单个ip
+			ip := net.ParseIP(cidr)
+			if ip == nil {
+				return nil, fmt.Errorf("ip%s不合法", cidr)
+			}
+			bits := 8 * len(ip.To16())
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			res.nets = append(res.nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, err
+		}
+		res.nets = append(res.nets, ipNet)
+	}
+	return res, nil
+}
+
+// match 请求是否满足所有配置了的条件
+func (m *matcher) match(req Request) bool {
+	return m.matchRoute(req.Route) && m.matchMethod(req.Method) &&
+		m.matchHeader(req.Header) && m.matchIP(req.IP) && m.matchUser(req.UserID)
+}
+
+func (m *matcher) matchRoute(route string) bool {
+	if len(m.routes) == 0 {
+		return true
+	}
+	for _, pattern := range m.routes {
+		if ok, _ := path.Match(pattern, route); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *matcher) matchMethod(method string) bool {
+	if len(m.methods) == 0 {
+		return true
+	}
+	method = strings.ToUpper(method)
+	for _, val := range m.methods {
+		if val == method {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *matcher) matchHeader(header http.Header) bool {
+	for name, want := range m.headers {
+		vals := header.Values(name)
+		if len(vals) == 0 {
+			return false
+		}
+		if want == "*" {
+			continue
+		}
+		found := false
+		for _, val := range vals {
+			if val == want {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func (m *matcher) matchIP(addr string) bool {
+	if len(m.nets) == 0 {
+		return true
+	}
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false
+	}
+	for _, ipNet := range m.nets {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *matcher) matchUser(user string) bool {
+	if len(m.users) == 0 {
+		return true
+	}
+	for _, val := range m.users {
+		if val == user || (val == "*" && user != "") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,94 @@
+package rules
+
+import (
+	"github.com/go-playground/assert/v2"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"testing"
+)
+
+func TestMatcher_Match(t *testing.T) {
+	testCases := []struct {
+		name  string
+		match Match
+		req   Request
+		want  bool
+	}{
+		{
+			name: "empty",
+			req:  Request{Route: "/any"},
+			want: true,
+		},
+		{
+			name:  "route glob",
+			match: Match{Routes: []string{"/login", "/api/*"}},
+			req:   Request{Route: "/api/users"},
+			want:  true,
+		},
+		{
+			name:  "route not match",
+			match: Match{Routes: []string{"/api/*"}},
+			req:   Request{Route: "/api/users/1"},
+			want:  false,
+		},
+		{
+			name:  "method ignore case",
+			match: Match{Methods: []string{"post"}},
+			req:   Request{Method: http.MethodPost},
+			want:  true,
+		},
+		{
+			name:  "header value",
+			match: Match{Headers: map[string]string{"x-tenant": "a"}},
+			req:   Request{Header: http.Header{"X-Tenant": []string{"b", "a"}}},
+			want:  true,
+		},
+		{
+			name:  "header exists",
+			match: Match{Headers: map[string]string{"X-Tenant": "*"}},
+			req:   Request{},
+			want:  false,
+		},
+		{
+			name:  "cidr",
+			match: Match{CIDRs: []string{"10.0.0.0/8", "192.168.1.1"}},
+			req:   Request{IP: "192.168.1.1"},
+			want:  true,
+		},
+		{
+			name:  "cidr not match",
+			match: Match{CIDRs: []string{"10.0.0.0/8"}},
+			req:   Request{IP: "invalid"},
+			want:  false,
+		},
+		{
+			name:  "any user",
+			match: Match{Users: []string{"*"}},
+			req:   Request{},
+			want:  false,
+		},
+		{
+			name:  "all conditions",
+			match: Match{Routes: []string{"/login"}, Methods: []string{"POST"}, Users: []string{"u1"}},
+			req:   Request{Route: "/login", Method: "POST", UserID: "u2"},
+			want:  false,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			m, err := newMatcher(tc.match)
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, m.match(tc.req))
+		})
+	}
+}
+
+func TestNewMatcher(t *testing.T) {
+	_, err := newMatcher(Match{CIDRs: []string{"10.0.0.0/33"}})
+	require.Error(t, err)
+	_, err = newMatcher(Match{CIDRs: []string{"10.0.0"}})
+	require.Error(t, err)
+	_, err = newMatcher(Match{Routes: []string{"/api/["}})
+	require.Error(t, err)
+}
@@ -0,0 +1,51 @@
+package rules
+
+import (
+	"github.com/liquanhui-99/restrictor"
+	"github.com/redis/go-redis/v9"
+)
+
+// Option rules包的配置项，NewEngine和Watch都可以传入
+type Option func(*options)
+
+type options struct {
+	// clock 获取时间和创建定时器的时钟
+	clock restrictor.Clock
+	// client backend是redis的规则使用的Redis客户端
+	client redis.Cmdable
+	// onError 热加载配置失败时的回调
+	onError func(err error)
+}
+
+// WithClock 替换限流器和热加载使用的时钟，默认是restrictor.RealClock，测试时可以传入restrictor.FakeClock
+func WithClock(clock restrictor.Clock) Option {
+	return func(o *options) {
+		o.clock = clock
+	}
+}
+
+// WithRedis 设置backend是redis的规则使用的Redis客户端，没有设置时配置redis的规则会初始化失败
+func WithRedis(client redis.Cmdable) Option {
+	return func(o *options) {
+		o.client = client
+	}
+}
+
+// WithErrorHandler 设置热加载配置失败时的回调，失败时继续使用之前的配置
+func WithErrorHandler(fn func(err error)) Option {
+	return func(o *options) {
+		o.onError = fn
+	}
+}
+
+// newOptions 在默认配置的基础上应用opts
+func newOptions(opts []Option) options {
+	o := options{
+		clock:   restrictor.RealClock,
+		onError: func(error) {},
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
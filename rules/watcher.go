@@ -0,0 +1,148 @@
+package rules
+
+import (
+	"context"
+	"errors"
+	"github.com/liquanhui-99/restrictor"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Watcher 从文件加载限流规则，并且按照固定的间隔检查文件的修改时间和大小，文件变化以后重新加载，
+// 新的配置不合法时继续使用之前的规则，通过WithErrorHandler获取错误。重新加载时名称相同的单机规则
+// 只修改了match或者rate、burst、limit、interval时沿用之前的限流器，计数和排队的请求保留，
+// backend、algorithm、key、ttl或者max_keys变化的规则重新创建限流器，计数重新开始
+type Watcher struct {
+	// path 配置文件的路径
+	path string
+	// engine 当前生效的规则
+	engine atomic.Pointer[Engine]
+	// modTime 最近一次加载的文件修改时间
+	modTime time.Time
+	// size 最近一次加载的文件大小
+	size int64
+	// opts 创建规则使用的配置项
+	opts options
+	// onError 重新加载失败时的回调
+	onError func(err error)
+	// close 控制关闭
+	close chan struct{}
+	// once 控制只能关闭一次
+	once sync.Once
+	// done 检查文件的goroutine退出以后关闭
+	done chan struct{}
+}
+
+// Watch 加载path中的限流规则，并且每隔interval检查一次文件是否变化，第一次加载失败时直接返回error
+func Watch(path string, interval time.Duration, opts ...Option) (*Watcher, error) {
+	o := newOptions(opts)
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	engine, err := load(path, o, nil)
+	if err != nil {
+		return nil, err
+	}
+	w := &Watcher{
+		path:    path,
+		modTime: info.ModTime(),
+		size:    info.Size(),
+		opts:    o,
+		onError: o.onError,
+		close:   make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	w.engine.Store(engine)
+	ticker := o.clock.NewTicker(interval)
+	go w.watch(ticker)
+	return w, nil
+}
+
+// load 读取配置并创建规则，沿用prev中可以沿用的限流器
+func load(path string, o options, prev *Engine) (*Engine, error) {
+	cfg, err := LoadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return newEngine(cfg, o, prev)
+}
+
+// watch 每次ticker触发时检查文件是否变化
+func (w *Watcher) watch(ticker restrictor.Ticker) {
+	defer close(w.done)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.close:
+			return
+		case <-ticker.C():
+			if err := w.reload(); err != nil {
+				w.onError(err)
+			}
+		}
+	}
+}
+
+// reload 文件的修改时间或者大小变化以后重新加载规则，替换以后关闭之前的规则中没有被沿用的限流器
+func (w *Watcher) reload() error {
+	info, err := os.Stat(w.path)
+	if err != nil {
+		return err
+	}
+	if info.ModTime().Equal(w.modTime) && info.Size() == w.size {
+		return nil
+	}
+	// 不管加载是否成功都记录下来，同一个错误的文件不重复加载
+	w.modTime, w.size = info.ModTime(), info.Size()
+	engine, err := load(w.path, w.opts, w.engine.Load())
+	if err != nil {
+		return err
+	}
+	w.engine.Swap(engine).Close()
+	return nil
+}
+
+// Engine 当前生效的规则
+func (w *Watcher) Engine() *Engine {
+	return w.engine.Load()
+}
+
+// Match 返回请求匹配的规则
+func (w *Watcher) Match(req Request) []Rule {
+	return w.engine.Load().Match(req)
+}
+
+// Allow 请求是否通过所有匹配的规则
+func (w *Watcher) Allow(ctx context.Context, req Request) (bool, error) {
+	return w.AllowN(ctx, req, 1)
+}
+
+// AllowN 请求消耗n个单位，检查当前生效的规则，关闭以后返回restrictor.ErrLimiterClosed
+func (w *Watcher) AllowN(ctx context.Context, req Request, n int64) (bool, error) {
+	for {
+		select {
+		case <-w.close:
+			return false, restrictor.ErrLimiterClosed
+		default:
+		}
+		engine := w.engine.Load()
+		ok, err := engine.AllowN(ctx, req, n)
+		// 检查的过程中规则被替换了，使用新的规则重新检查
+		if errors.Is(err, restrictor.ErrLimiterClosed) && w.engine.Load() != engine {
+			continue
+		}
+		return ok, err
+	}
+}
+
+// Close 停止检查文件并关闭当前的规则，可以重复调用
+func (w *Watcher) Close() {
+	w.once.Do(func() {
+		close(w.close)
+		<-w.done
+		w.engine.Load().Close()
+	})
+}
@@ -0,0 +1,115 @@
+package rules
+
+import (
+	"github.com/go-playground/assert/v2"
+	"github.com/liquanhui-99/restrictor"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWatch(t *testing.T) {
+	clock := restrictor.NewFakeClock(time.Now())
+	path := filepath.Join(t.TempDir(), "rules.yaml")
+	mtime := time.Now()
+	write := func(data string) {
+		require.NoError(t, os.WriteFile(path, []byte(data), 0o644))
+		mtime = mtime.Add(time.Second)
+		require.NoError(t, os.Chtimes(path, mtime, mtime))
+	}
+	write(`
+rules:
+  - name: api
+    match:
+      routes: ["/api/*"]
+    key: route
+    algorithm: fixed_window
+    limit: 1
+    interval: 1m
+`)
+	errs := make(chan error, 1)
+	w, err := Watch(path, time.Second, WithClock(clock), WithErrorHandler(func(err error) {
+		errs <- err
+	}))
+	require.NoError(t, err)
+	defer w.Close()
+
+	req := Request{Route: "/api/users"}
+	require.NoError(t, allow(w, req))
+	require.ErrorIs(t, allow(w, req), restrictor.ErrLimitExceeded)
+
+	// 文件变化以后重新加载，只修改了参数的规则沿用之前的限流器，计数保留
+	write(`
+rules:
+  - name: api
+    match:
+      routes: ["/api/*"]
+    key: route
+    algorithm: fixed_window
+    limit: 2
+    interval: 1m
+`)
+	old := w.Engine()
+	clock.BlockUntil(1)
+	clock.Advance(time.Second)
+	require.Eventually(t, func() bool {
+		return w.Engine() != old
+	}, time.Second, time.Millisecond)
+	assert.Equal(t, int64(2), w.Match(req)[0].Limit)
+	require.NoError(t, allow(w, req))
+	require.ErrorIs(t, allow(w, req), restrictor.ErrLimitExceeded)
+	// 之前创建的key按照新的参数计数，新的key直接使用新的参数
+	other := Request{Route: "/api/orders"}
+	require.NoError(t, allow(w, other))
+	require.NoError(t, allow(w, other))
+	require.ErrorIs(t, allow(w, other), restrictor.ErrLimitExceeded)
+	// 之前的规则和新的规则共用限流器，没有被关闭
+	require.ErrorIs(t, allow(old, req), restrictor.ErrLimitExceeded)
+
+	// 算法变化以后重新创建限流器，计数重新开始，之前的规则关闭
+	write(`
+rules:
+  - name: api
+    match:
+      routes: ["/api/*"]
+    key: route
+    algorithm: slide_window
+    limit: 2
+    interval: 1m
+`)
+	old = w.Engine()
+	clock.BlockUntil(1)
+	clock.Advance(time.Second)
+	require.Eventually(t, func() bool {
+		return w.Engine() != old
+	}, time.Second, time.Millisecond)
+	require.NoError(t, allow(w, req))
+	require.NoError(t, allow(w, req))
+	require.ErrorIs(t, allow(w, req), restrictor.ErrLimitExceeded)
+	require.ErrorIs(t, allow(old, req), restrictor.ErrLimiterClosed)
+
+	// 新的配置不合法时继续使用之前的规则
+	write("rules:\n  - name: api\n    algorithm: unknown\n")
+	current := w.Engine()
+	clock.BlockUntil(1)
+	clock.Advance(time.Second)
+	require.ErrorIs(t, <-errs, ErrInvalidRule)
+	assert.Equal(t, current, w.Engine())
+
+	// 关闭以后返回错误
+	w.Close()
+	w.Close()
+	require.ErrorIs(t, allow(w, req), restrictor.ErrLimiterClosed)
+}
+
+func TestWatch_Error(t *testing.T) {
+	_, err := Watch(filepath.Join(t.TempDir(), "missing.yaml"), time.Second)
+	require.Error(t, err)
+
+	path := filepath.Join(t.TempDir(), "rules.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"rules": [{"name": "a"}]}`), 0o644))
+	_, err = Watch(path, time.Second)
+	require.ErrorIs(t, err, ErrInvalidRule)
+}
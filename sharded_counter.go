@@ -0,0 +1,113 @@
+package restrictor
+
+import (
+	"runtime"
+	"sync"
+)
+
+// ShardedCounter 按照key计数的并发安全计数器，key按照哈希值分散到多个分段，
+// 每个分段单独加锁，减少只用一把锁保护一个map时的锁竞争
+type ShardedCounter struct {
+	// shards 分段，数量是2的幂
+	shards []counterShard
+	// mask 计算key所在分段的掩码
+	mask uint32
+}
+
+// counterShard 一个分段，填充到缓存行大小避免伪共享
+type counterShard struct {
+	mu     sync.Mutex
+	counts map[string]int64
+	_      [48]byte
+}
+
+// NewShardedCounter 初始化分段计数器，shards是分段的数量，会向上取整到2的幂，
+// 小于等于0时使用GOMAXPROCS的4倍
+func NewShardedCounter(shards int) *ShardedCounter {
+	if shards <= 0 {
+		shards = 4 * runtime.GOMAXPROCS(0)
+	}
+	size := 1
+	for size < shards {
+		size <<= 1
+	}
+	c := &ShardedCounter{
+		shards: make([]counterShard, size),
+		mask:   uint32(size - 1),
+	}
+	for i := range c.shards {
+		c.shards[i].counts = map[string]int64{}
+	}
+	return c
+}
+
+// Get 获取key当前的计数
+func (c *ShardedCounter) Get(key string) int64 {
+	s := c.shard(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.counts[key]
+}
+
+// AddIfBelow 当key的计数加上n不超过max时加上n，返回是否加上了和加完以后的计数，
+// 没有加上时返回当前的计数
+func (c *ShardedCounter) AddIfBelow(key string, n int64, max int64) (bool, int64) {
+	s := c.shard(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cnt := s.counts[key]
+	if cnt+n > max {
+		return false, cnt
+	}
+	s.counts[key] = cnt + n
+	return true, cnt + n
+}
+
+// Delete 删除key的计数
+func (c *ShardedCounter) Delete(key string) {
+	s := c.shard(key)
+	s.mu.Lock()
+	delete(s.counts, key)
+	s.mu.Unlock()
+}
+
+// Reset 清空所有key的计数
+func (c *ShardedCounter) Reset() {
+	for i := range c.shards {
+		s := &c.shards[i]
+		s.mu.Lock()
+		s.counts = map[string]int64{}
+		s.mu.Unlock()
+	}
+}
+
+// Len 当前计数的key数量
+func (c *ShardedCounter) Len() int {
+	var res int
+	for i := range c.shards {
+		s := &c.shards[i]
+		s.mu.Lock()
+		res += len(s.counts)
+		s.mu.Unlock()
+	}
+	return res
+}
+
+// shard key所在的分段
+func (c *ShardedCounter) shard(key string) *counterShard {
+	return &c.shards[fnv32a(key)&c.mask]
+}
+
+// fnv32a FNV-1a哈希，不分配内存
+func fnv32a(key string) uint32 {
+	const (
+		offset = 2166136261
+		prime  = 16777619
+	)
+	h := uint32(offset)
+	for i := 0; i < len(key); i++ {
+		h ^= uint32(key[i])
+		h *= prime
+	}
+	return h
+}
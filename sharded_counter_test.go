@@ -0,0 +1,156 @@
+package restrictor
+
+import (
+	"github.com/go-playground/assert/v2"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func TestShardedCounter_AddIfBelow(t *testing.T) {
+	testCases := []struct {
+		name      string
+		before    func(c *ShardedCounter)
+		n         int64
+		max       int64
+		wantOk    bool
+		wantCount int64
+	}{
+		// 第一次计数
+		{
+			name:      "first",
+			before:    func(c *ShardedCounter) {},
+			n:         3,
+			max:       10,
+			wantOk:    true,
+			wantCount: 3,
+		},
+		// 刚好达到最大值
+		{
+			name: "reach max",
+			before: func(c *ShardedCounter) {
+				c.AddIfBelow("key", 7, 10)
+			},
+			n:         3,
+			max:       10,
+			wantOk:    true,
+			wantCount: 10,
+		},
+		// 超过最大值时不加
+		{
+			name: "over max",
+			before: func(c *ShardedCounter) {
+				c.AddIfBelow("key", 8, 10)
+			},
+			n:         3,
+			max:       10,
+			wantOk:    false,
+			wantCount: 8,
+		},
+		// 清空以后重新计数
+		{
+			name: "reset",
+			before: func(c *ShardedCounter) {
+				c.AddIfBelow("key", 10, 10)
+				c.Reset()
+			},
+			n:         3,
+			max:       10,
+			wantOk:    true,
+			wantCount: 3,
+		},
+		// 删除以后重新计数
+		{
+			name: "delete",
+			before: func(c *ShardedCounter) {
+				c.AddIfBelow("key", 10, 10)
+				c.Delete("key")
+			},
+			n:         3,
+			max:       10,
+			wantOk:    true,
+			wantCount: 3,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := NewShardedCounter(4)
+			tc.before(c)
+			ok, cnt := c.AddIfBelow("key", tc.n, tc.max)
+			assert.Equal(t, tc.wantOk, ok)
+			assert.Equal(t, tc.wantCount, cnt)
+			assert.Equal(t, tc.wantCount, c.Get("key"))
+		})
+	}
+}
+
+func TestShardedCounter_Concurrent(t *testing.T) {
+	c := NewShardedCounter(3)
+	// 分段的数量向上取整到2的幂
+	assert.Equal(t, 4, len(c.shards))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				c.AddIfBelow(strconv.Itoa(j%10), 1, 150)
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, 10, c.Len())
+	for i := 0; i < 10; i++ {
+		assert.Equal(t, int64(150), c.Get(strconv.Itoa(i)))
+	}
+}
+
+// mutexCounter 只用一把读写锁保护一个map，和IpLimiter原来的实现一样，用来对比性能
+type mutexCounter struct {
+	mu     sync.RWMutex
+	counts map[string]int64
+}
+
+func (c *mutexCounter) AddIfBelow(key string, n int64, max int64) (bool, int64) {
+	c.mu.RLock()
+	cnt := c.counts[key]
+	c.mu.RUnlock()
+	if cnt+n > max {
+		return false, cnt
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cnt = c.counts[key]
+	if cnt+n > max {
+		return false, cnt
+	}
+	c.counts[key] = cnt + n
+	return true, cnt + n
+}
+
+func BenchmarkCounter_Parallel(b *testing.B) {
+	keys := make([]string, 1024)
+	for i := range keys {
+		keys[i] = "192.168.0." + strconv.Itoa(i)
+	}
+	counters := []struct {
+		name string
+		add  func(key string, n int64, max int64) (bool, int64)
+	}{
+		{name: "mutex", add: (&mutexCounter{counts: map[string]int64{}}).AddIfBelow},
+		{name: "sharded", add: NewShardedCounter(0).AddIfBelow},
+	}
+	for _, c := range counters {
+		b.Run(c.name, func(b *testing.B) {
+			b.RunParallel(func(pb *testing.PB) {
+				i := 0
+				for pb.Next() {
+					c.add(keys[i&(len(keys)-1)], 1, 1<<62)
+					i++
+				}
+			})
+		})
+	}
+}
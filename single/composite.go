@@ -0,0 +1,61 @@
+package single
+
+import (
+	"context"
+	"github.com/liquanhui-99/restrictor"
+	"time"
+)
+
+// Tier 组合限流器中的一个层级，例如用户、租户或者全局，按照key区分计数，
+// 后面的层级拒绝时通过RefundN归还前面的层级在at时消耗的数量，at是调用AllowN之前Now返回的时间，
+// KeyedLimiter实现了这个接口
+type Tier interface {
+	AllowN(ctx context.Context, key string, n int64) (bool, error)
+	RefundN(key string, n int64, at time.Time)
+	Now() time.Time
+}
+
+// CompositeLimiter 组合多个层级的限流器，请求需要同时通过所有层级，例如用户、租户和全局的限制，
+// 按照顺序检查每个层级，被某个层级拒绝时回滚前面的层级已经消耗的数量，不会白白消耗用户的额度。
+// 只有实现了RefundLimiter的限流器可以回滚，LeakeyBucketLimiter和WarmUpTokenBucketLimiter被后面的层级拒绝时
+// 已经消耗的数量不会归还，这样的层级需要放在最后
+type CompositeLimiter struct {
+	tiers []Tier
+}
+
+// NewCompositeLimiter 初始化组合限流器，tiers按照检查的顺序排列，
+// 建议把最容易拒绝的层级放在前面，减少需要回滚的数量
+func NewCompositeLimiter(tiers ...Tier) *CompositeLimiter {
+	return &CompositeLimiter{tiers: tiers}
+}
+
+// Allow 是否允许请求通过所有层级，keys[i]是请求在第i个层级的key
+func (c *CompositeLimiter) Allow(ctx context.Context, keys []string) (bool, error) {
+	return c.AllowN(ctx, keys, 1)
+}
+
+// AllowN 是否允许请求在所有层级消耗n个单位，keys[i]是请求在第i个层级的key，
+// 被某个层级拒绝时返回这个层级的错误，前面的层级已经消耗的n个单位会归还，
+// keys的数量和层级的数量不一致时返回restrictor.ErrTierMismatch
+func (c *CompositeLimiter) AllowN(ctx context.Context, keys []string, n int64) (bool, error) {
+	if err := restrictor.CheckCount(n); err != nil {
+		return false, err
+	}
+	if len(keys) != len(c.tiers) {
+		return false, restrictor.ErrTierMismatch
+	}
+	ats := make([]time.Time, len(c.tiers))
+	for i, tier := range c.tiers {
+		ats[i] = tier.Now()
+		ok, err := tier.AllowN(ctx, keys[i], n)
+		if err == nil && ok {
+			continue
+		}
+		// 倒序回滚已经通过的层级
+		for j := i - 1; j >= 0; j-- {
+			c.tiers[j].RefundN(keys[j], n, ats[j])
+		}
+		return false, err
+	}
+	return true, nil
+}
@@ -0,0 +1,196 @@
+package single
+
+import (
+	"context"
+	"github.com/go-playground/assert/v2"
+	"github.com/liquanhui-99/restrictor"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestCompositeLimiter_AllowN(t *testing.T) {
+	clock := restrictor.NewFakeClock(time.Now())
+	window := func(maxCount int64) *KeyedLimiter {
+		return NewKeyedLimiter(func(string) Limiter {
+			return NewFixedWindowLimiter(time.Minute, maxCount, WithClock(clock))
+		}, 0, 0, WithClock(clock))
+	}
+	user, tenant := window(2), window(3)
+	global := NewKeyedLimiter(func(string) Limiter {
+		return NewLazyTokenBucketLimiter(0, 4, WithClock(clock))
+	}, 0, 0, WithClock(clock))
+	limiter := NewCompositeLimiter(user, tenant, global)
+
+	testCases := []struct {
+		name        string
+		keys        []string
+		wantErr     error
+		wantLimiter string
+	}{
+		{name: "u1", keys: []string{"u1", "t1", "g"}},
+		{name: "u1 again", keys: []string{"u1", "t1", "g"}},
+		// 用户的额度用完了
+		{name: "user rejected", keys: []string{"u1", "t1", "g"}, wantErr: restrictor.ErrLimitExceeded,
+			wantLimiter: restrictor.FixedWindow},
+		{name: "u2", keys: []string{"u2", "t1", "g"}},
+		// 租户的额度用完了，u2的额度归还
+		{name: "tenant rejected", keys: []string{"u2", "t1", "g"}, wantErr: restrictor.ErrLimitExceeded,
+			wantLimiter: restrictor.FixedWindow},
+		{name: "u2 other tenant", keys: []string{"u2", "t2", "g"}},
+		// 全局的额度用完了，u3和t2的额度归还
+		{name: "global rejected", keys: []string{"u3", "t2", "g"}, wantErr: restrictor.ErrLimitExceeded,
+			wantLimiter: restrictor.LazyTokenBucket},
+		{name: "mismatch", keys: []string{"u3", "t2"}, wantErr: restrictor.ErrTierMismatch},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			res, err := limiter.Allow(context.Background(), tc.keys)
+			require.ErrorIs(t, err, tc.wantErr)
+			assert.Equal(t, tc.wantErr == nil, res)
+			if tc.wantLimiter != "" {
+				d, ok := restrictor.DecisionOf(err)
+				require.True(t, ok)
+				assert.Equal(t, tc.wantLimiter, d.Limiter)
+			}
+		})
+	}
+
+	// 被拒绝的请求没有消耗用户和租户的额度，u2通过了两次
+	require.ErrorIs(t, allowN(mustGet(t, user, "u2"), 1), restrictor.ErrLimitExceeded)
+	require.NoError(t, allowN(mustGet(t, user, "u3"), 2))
+	require.NoError(t, allowN(mustGet(t, tenant, "t2"), 2))
+	require.ErrorIs(t, allowN(mustGet(t, tenant, "t2"), 1), restrictor.ErrLimitExceeded)
+}
+
+func TestRefundLimiter_RefundN(t *testing.T) {
+	testCases := []struct {
+		name    string
+		limiter func(clock restrictor.Clock) RefundLimiter
+	}{
+		{
+			name: "fixed window",
+			limiter: func(clock restrictor.Clock) RefundLimiter {
+				return NewFixedWindowLimiter(time.Minute, 3, WithClock(clock))
+			},
+		},
+		{
+			name: "slide window",
+			limiter: func(clock restrictor.Clock) RefundLimiter {
+				return NewSlideWindowLimiter(time.Minute, 3, WithClock(clock))
+			},
+		},
+		{
+			name: "slide window counter",
+			limiter: func(clock restrictor.Clock) RefundLimiter {
+				return NewSlideWindowCounterLimiter(time.Minute, 3, WithClock(clock))
+			},
+		},
+		{
+			name: "lazy token bucket",
+			limiter: func(clock restrictor.Clock) RefundLimiter {
+				return NewLazyTokenBucketLimiter(0, 3, WithClock(clock))
+			},
+		},
+		{
+			name: "gcra",
+			limiter: func(clock restrictor.Clock) RefundLimiter {
+				return NewGCRALimiter(time.Minute, 1, 3, WithClock(clock))
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			clock := restrictor.NewFakeClock(time.Unix(0, 0))
+			limiter := tc.limiter(clock)
+			defer limiter.Close()
+			at := clock.Now()
+			require.NoError(t, allowN(limiter, 3))
+			require.ErrorIs(t, allowN(limiter, 1), restrictor.ErrLimitExceeded)
+
+			// 归还以后可以再通过，最多恢复到消耗之前的状态
+			limiter.RefundN(2, at)
+			require.NoError(t, allowN(limiter, 2))
+			require.ErrorIs(t, allowN(limiter, 1), restrictor.ErrLimitExceeded)
+			limiter.RefundN(10, at)
+			require.ErrorIs(t, allowN(limiter, 4), restrictor.ErrLimitExceeded)
+			require.NoError(t, allowN(limiter, 3))
+		})
+	}
+}
+
+func TestRefundLimiter_RefundNAfterSwitch(t *testing.T) {
+	testCases := []struct {
+		name    string
+		limiter func(clock restrictor.Clock) RefundLimiter
+	}{
+		{
+			name: "fixed window",
+			limiter: func(clock restrictor.Clock) RefundLimiter {
+				return NewFixedWindowLimiter(time.Minute, 2, WithClock(clock))
+			},
+		},
+		{
+			name: "slide window",
+			limiter: func(clock restrictor.Clock) RefundLimiter {
+				return NewSlideWindowLimiter(time.Minute, 2, WithClock(clock))
+			},
+		},
+		{
+			name: "slide window counter",
+			limiter: func(clock restrictor.Clock) RefundLimiter {
+				return NewSlideWindowCounterLimiter(time.Minute, 2, WithClock(clock))
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			clock := restrictor.NewFakeClock(time.Unix(0, 0))
+			limiter := tc.limiter(clock)
+			defer limiter.Close()
+			at := clock.Now()
+			require.NoError(t, allowN(limiter, 2))
+
+			// 切换到新的窗口，新窗口的额度用完以后归还上一个窗口消耗的数量，不会多放行
+			clock.Advance(3 * time.Minute)
+			require.NoError(t, allowN(limiter, 2))
+			limiter.RefundN(2, at)
+			require.ErrorIs(t, allowN(limiter, 1), restrictor.ErrLimitExceeded)
+		})
+	}
+}
+
+func TestCompositeLimiter_NonRefundTier(t *testing.T) {
+	clock := restrictor.NewFakeClock(time.Now())
+	warmUp := NewKeyedLimiter(func(string) Limiter {
+		return NewWarmUpTokenBucketLimiter(1, 0, WithClock(clock))
+	}, 0, 0, WithClock(clock))
+	window := NewKeyedLimiter(func(string) Limiter {
+		return NewFixedWindowLimiter(time.Minute, 1, WithClock(clock))
+	}, 0, 0, WithClock(clock))
+	ctx := context.Background()
+
+	// 预热令牌桶没有实现RefundLimiter，被后面的层级拒绝时消耗的令牌不会归还
+	limiter := NewCompositeLimiter(warmUp, window)
+	require.NoError(t, allowN(mustGet(t, window, "w"), 1))
+	_, err := limiter.Allow(ctx, []string{"a", "w"})
+	require.ErrorIs(t, err, restrictor.ErrLimitExceeded)
+	require.ErrorIs(t, allowN(mustGet(t, warmUp, "a"), 1), restrictor.ErrLimitExceeded)
+
+	// 放在最后的层级不需要回滚
+	limiter = NewCompositeLimiter(window, warmUp)
+	_, err = limiter.Allow(ctx, []string{"w", "b"})
+	require.ErrorIs(t, err, restrictor.ErrLimitExceeded)
+	require.NoError(t, allowN(mustGet(t, warmUp, "b"), 1))
+}
+
+// mustGet 获取key对应的限流器
+func mustGet(t *testing.T, k *KeyedLimiter, key string) Limiter {
+	entry, err := k.get(key)
+	require.NoError(t, err)
+	k.release(entry)
+	return entry.limiter
+}
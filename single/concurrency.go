@@ -0,0 +1,178 @@
+package single
+
+import (
+	"container/list"
+	"context"
+	"github.com/liquanhui-99/restrictor"
+	"sync"
+	"time"
+)
+
+// ConcurrencyLimiter 并发限流器，限制同时在处理的请求数量，而不是单位时间内的请求数量，
+// 达到上限以后的请求可以在有界的FIFO队列中排队，等到前面的请求释放
+type ConcurrencyLimiter struct {
+	mu sync.Mutex
+	// maxInFlight 同时处理的最大请求数量
+	maxInFlight int64
+	// inFlight 正在处理的请求数量
+	inFlight int64
+	// queueSize 排队的最大请求数量，0表示不排队，达到上限直接拒绝
+	queueSize int
+	// queueTimeout 排队的最长时间，小于等于0时一直等到ctx结束
+	queueTimeout time.Duration
+	// waiters 排队的请求，先到先得
+	waiters *list.List
+	// closed 限流器是否已经关闭
+	closed bool
+	// clock 创建排队超时定时器的时钟
+	clock restrictor.Clock
+}
+
+// concurrencyWaiter 排队的请求，轮到的时候关闭ready
+type concurrencyWaiter struct {
+	ready chan struct{}
+	// err 不为nil说明限流器关闭了，没有拿到位置
+	err error
+}
+
+// NewConcurrencyLimiter 初始化并发限流器，maxInFlight是同时处理的最大请求数量，
+// queueSize是排队的最大请求数量，0表示不排队；queueTimeout是排队的最长时间，小于等于0时一直等到ctx结束
+func NewConcurrencyLimiter(maxInFlight int64, queueSize int, queueTimeout time.Duration, opts ...Option) *ConcurrencyLimiter {
+	o := newOptions(opts)
+	return &ConcurrencyLimiter{
+		maxInFlight:  maxInFlight,
+		queueSize:    queueSize,
+		queueTimeout: queueTimeout,
+		waiters:      list.New(),
+		clock:        o.clock,
+	}
+}
+
+// Acquire 获取一个处理请求的位置，成功时返回释放位置的函数，请求处理完以后必须调用，重复调用只释放一次；
+// 没有位置并且队列已满或者排队超时返回restrictor.ErrLimitExceeded，排队时ctx结束返回ctx的错误，
+// 限流器关闭以后返回restrictor.ErrLimiterClosed
+func (c *ConcurrencyLimiter) Acquire(ctx context.Context) (func(), error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil, restrictor.ErrLimiterClosed
+	}
+	// 有空闲的位置并且没有人在排队
+	if c.inFlight < c.maxInFlight && c.waiters.Len() == 0 {
+		c.inFlight++
+		c.mu.Unlock()
+		return c.releaseFunc(), nil
+	}
+	if c.waiters.Len() >= c.queueSize {
+		c.mu.Unlock()
+		return nil, restrictor.ErrLimitExceeded
+	}
+	w := &concurrencyWaiter{ready: make(chan struct{})}
+	elem := c.waiters.PushBack(w)
+	c.mu.Unlock()
+
+	var timeout <-chan time.Time
+	if c.queueTimeout > 0 {
+		timer := c.clock.NewTimer(c.queueTimeout)
+		defer timer.Stop()
+		timeout = timer.C()
+	}
+
+	var err error
+	select {
+	case <-w.ready:
+		if w.err != nil {
+			return nil, w.err
+		}
+		return c.releaseFunc(), nil
+	case <-ctx.Done():
+		err = ctx.Err()
+	case <-timeout:
+		err = restrictor.ErrLimitExceeded
+	}
+
+	c.mu.Lock()
+	select {
+	case <-w.ready:
+		// 放弃排队的同时轮到了，把位置让给下一个
+		c.mu.Unlock()
+		if w.err == nil {
+			c.release()
+		}
+	default:
+		c.waiters.Remove(elem)
+		c.mu.Unlock()
+	}
+	return nil, err
+}
+
+// InFlight 正在处理的请求数量
+func (c *ConcurrencyLimiter) InFlight() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.inFlight
+}
+
+// QueueLen 正在排队的请求数量
+func (c *ConcurrencyLimiter) QueueLen() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.waiters.Len()
+}
+
+// releaseFunc 创建只会释放一次位置的函数
+func (c *ConcurrencyLimiter) releaseFunc() func() {
+	var once sync.Once
+	return func() {
+		once.Do(c.release)
+	}
+}
+
+// release 释放一个位置，有请求在排队时直接把位置交给队头的请求
+func (c *ConcurrencyLimiter) release() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.inFlight--
+	c.wake()
+}
+
+// SetLimit 修改同时处理的最大请求数量，可以和Acquire并发调用。调大时空出来的位置按照顺序交给排队的请求，
+// 调小时已经拿到位置的请求不受影响，释放的位置不再交给排队的请求，直到正在处理的请求数量低于新的上限
+func (c *ConcurrencyLimiter) SetLimit(maxInFlight int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.maxInFlight = maxInFlight
+	c.wake()
+}
+
+// wake 有空闲的位置时按照顺序交给排队的请求，调用方需要持有锁
+func (c *ConcurrencyLimiter) wake() {
+	for c.inFlight < c.maxInFlight {
+		front := c.waiters.Front()
+		if front == nil {
+			return
+		}
+		c.waiters.Remove(front)
+		c.inFlight++
+		close(front.Value.(*concurrencyWaiter).ready)
+	}
+}
+
+// Close 关闭限流器，正在排队的请求返回restrictor.ErrLimiterClosed，已经拿到位置的请求不受影响，可以重复调用
+func (c *ConcurrencyLimiter) Close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return
+	}
+	c.closed = true
+	for elem := c.waiters.Front(); elem != nil; elem = elem.Next() {
+		w := elem.Value.(*concurrencyWaiter)
+		w.err = restrictor.ErrLimiterClosed
+		close(w.ready)
+	}
+	c.waiters.Init()
+}
@@ -0,0 +1,200 @@
+package single
+
+import (
+	"context"
+	"github.com/go-playground/assert/v2"
+	"github.com/liquanhui-99/restrictor"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestConcurrencyLimiter_Acquire(t *testing.T) {
+	testCases := []struct {
+		name         string
+		maxInFlight  int64
+		queueSize    int
+		queueTimeout time.Duration
+		// 提前占用的位置数量
+		hold int
+		ctx  func() (context.Context, context.CancelFunc)
+		// 排队开始以后把时间推进多久
+		advance      time.Duration
+		wantErr      error
+		wantInFlight int64
+	}{
+		// 有空闲的位置
+		{
+			name:        "success",
+			maxInFlight: 2,
+			hold:        1,
+			ctx: func() (context.Context, context.CancelFunc) {
+				return context.WithTimeout(context.Background(), time.Second)
+			},
+			wantInFlight: 2,
+		},
+		// 没有位置也不排队
+		{
+			name:        "no queue",
+			maxInFlight: 1,
+			hold:        1,
+			ctx: func() (context.Context, context.CancelFunc) {
+				return context.WithTimeout(context.Background(), time.Second)
+			},
+			wantErr:      restrictor.ErrLimitExceeded,
+			wantInFlight: 1,
+		},
+		// 排队超时
+		{
+			name:         "queue timeout",
+			maxInFlight:  1,
+			queueSize:    1,
+			queueTimeout: 100 * time.Millisecond,
+			hold:         1,
+			ctx: func() (context.Context, context.CancelFunc) {
+				return context.WithTimeout(context.Background(), time.Second)
+			},
+			advance:      100 * time.Millisecond,
+			wantErr:      restrictor.ErrLimitExceeded,
+			wantInFlight: 1,
+		},
+		// 排队的时候ctx结束
+		{
+			name:        "Deadline",
+			maxInFlight: 1,
+			queueSize:   1,
+			hold:        1,
+			ctx: func() (context.Context, context.CancelFunc) {
+				return context.WithTimeout(context.Background(), 10*time.Millisecond)
+			},
+			wantErr:      context.DeadlineExceeded,
+			wantInFlight: 1,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			clock := restrictor.NewFakeClock(time.Now())
+			limiter := NewConcurrencyLimiter(tc.maxInFlight, tc.queueSize, tc.queueTimeout, WithClock(clock))
+			defer limiter.Close()
+			for i := 0; i < tc.hold; i++ {
+				_, err := limiter.Acquire(context.Background())
+				require.NoError(t, err)
+			}
+			if tc.advance > 0 {
+				go func() {
+					clock.BlockUntil(1)
+					clock.Advance(tc.advance)
+				}()
+			}
+			ctx, cancel := tc.ctx()
+			defer cancel()
+			release, err := limiter.Acquire(ctx)
+			require.ErrorIs(t, err, tc.wantErr)
+			if err == nil {
+				require.NotNil(t, release)
+			}
+			assert.Equal(t, tc.wantInFlight, limiter.InFlight())
+			assert.Equal(t, 0, limiter.QueueLen())
+		})
+	}
+}
+
+func TestConcurrencyLimiter_FIFO(t *testing.T) {
+	limiter := NewConcurrencyLimiter(1, 2, 0)
+	release, err := limiter.Acquire(context.Background())
+	require.NoError(t, err)
+
+	// 两个请求按顺序排队
+	order := make(chan int, 2)
+	releases := make(chan func(), 2)
+	for i := 0; i < 2; i++ {
+		i := i
+		go func() {
+			r, err := limiter.Acquire(context.Background())
+			require.NoError(t, err)
+			order <- i
+			releases <- r
+		}()
+		require.Eventually(t, func() bool {
+			return limiter.QueueLen() == i+1
+		}, time.Second, time.Millisecond)
+	}
+
+	// 队列满了直接拒绝
+	_, err = limiter.Acquire(context.Background())
+	require.ErrorIs(t, err, restrictor.ErrLimitExceeded)
+
+	// 释放的位置直接交给队头，重复释放只生效一次
+	release()
+	release()
+	assert.Equal(t, 0, <-order)
+	assert.Equal(t, int64(1), limiter.InFlight())
+	(<-releases)()
+	assert.Equal(t, 1, <-order)
+	(<-releases)()
+	assert.Equal(t, int64(0), limiter.InFlight())
+}
+
+func TestConcurrencyLimiter_Close(t *testing.T) {
+	limiter := NewConcurrencyLimiter(1, 1, 0)
+	release, err := limiter.Acquire(context.Background())
+	require.NoError(t, err)
+
+	errCh := make(chan error)
+	go func() {
+		_, err := limiter.Acquire(context.Background())
+		errCh <- err
+	}()
+	require.Eventually(t, func() bool {
+		return limiter.QueueLen() == 1
+	}, time.Second, time.Millisecond)
+
+	// 关闭以后排队的请求返回错误
+	limiter.Close()
+	limiter.Close()
+	require.ErrorIs(t, <-errCh, restrictor.ErrLimiterClosed)
+	_, err = limiter.Acquire(context.Background())
+	require.ErrorIs(t, err, restrictor.ErrLimiterClosed)
+
+	// 已经拿到位置的请求正常释放
+	release()
+	assert.Equal(t, int64(0), limiter.InFlight())
+}
+
+func TestConcurrencyLimiter_SetLimit(t *testing.T) {
+	limiter := NewConcurrencyLimiter(1, 2, 0)
+	release, err := limiter.Acquire(context.Background())
+	require.NoError(t, err)
+
+	releases := make(chan func(), 3)
+	acquire := func(want int) {
+		go func() {
+			r, err := limiter.Acquire(context.Background())
+			require.NoError(t, err)
+			releases <- r
+		}()
+		require.Eventually(t, func() bool {
+			return limiter.QueueLen() == want
+		}, time.Second, time.Millisecond)
+	}
+	acquire(1)
+	acquire(2)
+
+	// 调大以后空出来的位置交给排队的请求
+	limiter.SetLimit(3)
+	(<-releases)()
+	(<-releases)()
+	assert.Equal(t, int64(1), limiter.InFlight())
+	assert.Equal(t, 0, limiter.QueueLen())
+
+	// 调小以后释放的位置不再交给排队的请求，直到低于新的上限
+	limiter.SetLimit(0)
+	acquire(1)
+	release()
+	assert.Equal(t, int64(0), limiter.InFlight())
+	assert.Equal(t, 1, limiter.QueueLen())
+	limiter.SetLimit(1)
+	(<-releases)()
+	assert.Equal(t, int64(0), limiter.InFlight())
+}
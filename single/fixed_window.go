@@ -2,8 +2,8 @@ package single
 
 import (
 	"context"
-	"errors"
-	"sync/atomic"
+	"github.com/liquanhui-99/restrictor"
+	"sync"
 	"time"
 )
 
@@ -17,38 +17,142 @@ type FixedWindowLimiter struct {
 	maxCount int64
 	// 当前已经通过的请求数量
 	currentCount int64
+	// 加锁保护timeStamp、interval、maxCount和currentCount，切换窗口和计数必须一起完成，
+	// 否则切换窗口时清零计数会覆盖掉其他请求刚刚计入新窗口的数量
+	mu sync.Mutex
+	// clock 获取时间的时钟
+	clock restrictor.Clock
 }
 
 // NewFixedWindowLimiter 初始化固定窗口限流器，interval标识窗口的大小，
 // maxCount窗口内允许的最大请求数量
-func NewFixedWindowLimiter(interval time.Duration, maxCount int64) *FixedWindowLimiter {
+func NewFixedWindowLimiter(interval time.Duration, maxCount int64, opts ...Option) *FixedWindowLimiter {
+	o := newOptions(opts)
 	return &FixedWindowLimiter{
-		timeStamp: time.Now().UnixNano(),
+		timeStamp: o.clock.Now().UnixNano(),
 		interval:  int64(interval),
 		maxCount:  maxCount,
+		clock:     o.clock,
 	}
 }
 
 // Allow 是否允许通过限流器继续请求
 func (f *FixedWindowLimiter) Allow(ctx context.Context) (bool, error) {
-	now := time.Now().UnixNano()
-	tm := atomic.LoadInt64(&f.timeStamp)
-	cc := atomic.LoadInt64(&f.currentCount)
-	// 窗口时间超过了限制，需要新开一个窗口
-	if tm+f.interval < now {
-		if atomic.CompareAndSwapInt64(&f.timeStamp, tm, 0) {
-			atomic.CompareAndSwapInt64(&f.currentCount, cc, 0)
+	return f.AllowN(ctx, 1)
+}
+
+// AllowN 是否允许n个单位的请求通过限流器，窗口内剩余的数量不够n时一个都不消耗
+func (f *FixedWindowLimiter) AllowN(ctx context.Context, n int64) (bool, error) {
+	d, err := f.Decide(ctx, n)
+	if err != nil {
+		return false, err
+	}
+	if !d.Allowed {
+		return false, restrictor.NewLimitError(d)
+	}
+	return true, nil
+}
+
+// Decide 判定窗口内是否允许通过n个请求，返回窗口内剩余的数量和窗口结束的时间
+func (f *FixedWindowLimiter) Decide(ctx context.Context, n int64) (restrictor.Decision, error) {
+	if err := restrictor.CheckCount(n); err != nil {
+		return restrictor.Decision{}, err
+	}
+	now := f.clock.Now().UnixNano()
+	f.mu.Lock()
+	ok, count, start := f.allowN(now, n)
+	interval, maxCount := f.interval, f.maxCount
+	f.mu.Unlock()
+	d := restrictor.Decision{
+		Allowed:   ok,
+		Limit:     maxCount,
+		Remaining: maxCount - count,
+		ResetAt:   time.Unix(0, start+interval),
+		Limiter:   restrictor.FixedWindow,
+	}
+	if d.Remaining < 0 {
+		// 调小maxCount以后窗口内已经通过的请求可能超过新的限制
+		d.Remaining = 0
+	}
+	if !ok && n <= maxCount {
+		// 等到当前窗口结束
+		d.RetryAfter = time.Duration(start + interval - now + 1)
+	}
+	return d, nil
+}
+
+// Wait 阻塞直到窗口内允许通过一个请求
+func (f *FixedWindowLimiter) Wait(ctx context.Context) error {
+	return f.WaitN(ctx, 1)
+}
+
+// WaitN 阻塞直到窗口内允许通过n个请求，当前窗口放不下时会一直等到窗口结束，
+// n超过窗口内允许的最大请求数量时直接返回error
+func (f *FixedWindowLimiter) WaitN(ctx context.Context, n int64) error {
+	if err := restrictor.CheckCount(n); err != nil {
+		return err
+	}
+	for {
+		now := f.clock.Now().UnixNano()
+		f.mu.Lock()
+		if n > f.maxCount {
+			f.mu.Unlock()
+			return restrictor.ErrExceedsCapacity
+		}
+		ok, _, start := f.allowN(now, n)
+		interval := f.interval
+		f.mu.Unlock()
+		if ok {
+			return nil
+		}
+		// 等到当前窗口结束，新的窗口开启以后再尝试
+		if err := sleep(ctx, f.clock, time.Duration(start+interval-now+1)); err != nil {
+			return err
 		}
 	}
+}
+
+// allowN 尝试在now所在的窗口内通过n个请求，返回是否通过、窗口内的请求数量和窗口的起始时间，调用方需要持有锁
+func (f *FixedWindowLimiter) allowN(now int64, n int64) (bool, int64, int64) {
+	// 窗口时间超过了限制，需要新开一个窗口
+	if f.timeStamp+f.interval < now {
+		f.timeStamp, f.currentCount = now, 0
+	}
 	// 窗口内的请求数量已经超过最大限度
-	cc = atomic.LoadInt64(&f.currentCount)
-	if f.currentCount >= f.maxCount {
-		return false, errors.New("超过最大请求数量限制")
+	if f.currentCount+n > f.maxCount {
+		return false, f.currentCount, f.timeStamp
 	}
+	f.currentCount += n
+	return true, f.currentCount, f.timeStamp
+}
 
-	atomic.AddInt64(&f.currentCount, 1)
+// RefundN 把at时消耗的n个单位归还给当前窗口，当前窗口已经通过的请求数量不会小于0，
+// at在当前窗口开始之前或者当前窗口已经结束时直接忽略
+func (f *FixedWindowLimiter) RefundN(n int64, at time.Time) {
+	now := f.clock.Now().UnixNano()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if at.UnixNano() < f.timeStamp || f.timeStamp+f.interval < now {
+		return
+	}
+	if n > f.currentCount {
+		n = f.currentCount
+	}
+	f.currentCount -= n
+}
 
-	return true, nil
+// SetLimit 修改窗口内允许通过的最大请求数量，当前窗口已经通过的请求数量保留，可以和Allow并发调用
+func (f *FixedWindowLimiter) SetLimit(maxCount int64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.maxCount = maxCount
+}
+
+// SetInterval 修改窗口的大小，当前窗口的起始时间和已经通过的请求数量保留，可以和Allow并发调用
+func (f *FixedWindowLimiter) SetInterval(interval time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.interval = int64(interval)
 }
 
 func (f *FixedWindowLimiter) Close() {}
@@ -2,11 +2,13 @@ package single
 
 import (
 	"context"
-	"errors"
 	"github.com/gin-gonic/gin"
 	"github.com/go-playground/assert/v2"
+	"github.com/liquanhui-99/restrictor"
 	"github.com/stretchr/testify/require"
 	"net/http"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -15,7 +17,7 @@ func TestFixedWindowLimiter_Allow(t *testing.T) {
 	testCases := []struct {
 		name     string
 		interval time.Duration
-		before   func(*testing.T, *FixedWindowLimiter)
+		before   func(*testing.T, *FixedWindowLimiter, *restrictor.FakeClock)
 		ctx      func() (context.Context, context.CancelFunc)
 		wantErr  error
 		wantRes  bool
@@ -25,11 +27,11 @@ func TestFixedWindowLimiter_Allow(t *testing.T) {
 		{
 			name:     "reset",
 			interval: 10 * time.Millisecond,
-			before: func(t *testing.T, limiter *FixedWindowLimiter) {
+			before: func(t *testing.T, limiter *FixedWindowLimiter, clock *restrictor.FakeClock) {
 				ctx, cancel := context.WithTimeout(context.Background(), time.Second)
 				defer cancel()
 				for i := 0; i < 10; i++ {
-					time.Sleep(10 * time.Millisecond)
+					clock.Advance(11 * time.Millisecond)
 					res, err := limiter.Allow(ctx)
 					require.NoError(t, err)
 					require.True(t, res)
@@ -43,7 +45,7 @@ func TestFixedWindowLimiter_Allow(t *testing.T) {
 		{
 			name:     "over max count",
 			interval: 2 * time.Minute,
-			before: func(t *testing.T, limiter *FixedWindowLimiter) {
+			before: func(t *testing.T, limiter *FixedWindowLimiter, clock *restrictor.FakeClock) {
 				ctx, cancel := context.WithTimeout(context.Background(), time.Second)
 				defer cancel()
 				for i := 0; i < 10; i++ {
@@ -53,14 +55,14 @@ func TestFixedWindowLimiter_Allow(t *testing.T) {
 				}
 			},
 			maxCount: 10,
-			wantErr:  errors.New("超过最大请求数量限制"),
+			wantErr:  restrictor.ErrLimitExceeded,
 			wantRes:  false,
 		},
 		// 超过最大数量
 		{
 			name:     "over max count",
 			interval: 2 * time.Minute,
-			before:   func(t *testing.T, limiter *FixedWindowLimiter) {},
+			before:   func(t *testing.T, limiter *FixedWindowLimiter, clock *restrictor.FakeClock) {},
 			maxCount: 10,
 			wantErr:  nil,
 			wantRes:  true,
@@ -69,17 +71,181 @@ func TestFixedWindowLimiter_Allow(t *testing.T) {
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			limiter := NewFixedWindowLimiter(tc.interval, tc.maxCount)
-			tc.before(t, limiter)
+			clock := restrictor.NewFakeClock(time.Now())
+			limiter := NewFixedWindowLimiter(tc.interval, tc.maxCount, WithClock(clock))
+			tc.before(t, limiter, clock)
 			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
 			defer cancel()
 			res, err := limiter.Allow(ctx)
-			assert.Equal(t, tc.wantErr, err)
+			require.ErrorIs(t, err, tc.wantErr)
 			assert.Equal(t, tc.wantRes, res)
 		})
 	}
 }
 
+func TestFixedWindowLimiter_AllowN(t *testing.T) {
+	testCases := []struct {
+		name     string
+		maxCount int64
+		before   func(*testing.T, *FixedWindowLimiter, *restrictor.FakeClock)
+		n        int64
+		wantErr  error
+		wantRes  bool
+		// 执行完以后窗口内的请求数量
+		wantCount int64
+	}{
+		// 全部消耗
+		{
+			name:      "success",
+			maxCount:  10,
+			before:    func(t *testing.T, limiter *FixedWindowLimiter, clock *restrictor.FakeClock) {},
+			n:         10,
+			wantRes:   true,
+			wantCount: 10,
+		},
+		// 剩余数量不够，一个都不消耗
+		{
+			name:     "not enough",
+			maxCount: 10,
+			before: func(t *testing.T, limiter *FixedWindowLimiter, clock *restrictor.FakeClock) {
+				res, err := limiter.AllowN(context.Background(), 6)
+				require.NoError(t, err)
+				require.True(t, res)
+			},
+			n:         5,
+			wantErr:   restrictor.ErrLimitExceeded,
+			wantRes:   false,
+			wantCount: 6,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			clock := restrictor.NewFakeClock(time.Now())
+			limiter := NewFixedWindowLimiter(time.Minute, tc.maxCount, WithClock(clock))
+			tc.before(t, limiter, clock)
+			res, err := limiter.AllowN(context.Background(), tc.n)
+			require.ErrorIs(t, err, tc.wantErr)
+			assert.Equal(t, tc.wantRes, res)
+			assert.Equal(t, tc.wantCount, limiter.currentCount)
+		})
+	}
+}
+
+func TestFixedWindowLimiter_Decide(t *testing.T) {
+	clock := restrictor.NewFakeClock(time.Now())
+	limiter := NewFixedWindowLimiter(time.Minute, 10, WithClock(clock))
+	d, err := limiter.Decide(context.Background(), 6)
+	require.NoError(t, err)
+	assert.Equal(t, true, d.Allowed)
+	assert.Equal(t, int64(10), d.Limit)
+	assert.Equal(t, int64(4), d.Remaining)
+	assert.Equal(t, time.Duration(0), d.RetryAfter)
+	assert.Equal(t, restrictor.FixedWindow, d.Limiter)
+	assert.Equal(t, clock.Now().Add(time.Minute).UnixNano(), d.ResetAt.UnixNano())
+
+	// 剩余的数量不够，等到窗口结束
+	clock.Advance(10 * time.Second)
+	d, err = limiter.Decide(context.Background(), 5)
+	require.NoError(t, err)
+	assert.Equal(t, false, d.Allowed)
+	assert.Equal(t, int64(4), d.Remaining)
+	assert.Equal(t, 50*time.Second+1, d.RetryAfter)
+
+	// 新的窗口
+	clock.Advance(50*time.Second + 1)
+	d, err = limiter.Decide(context.Background(), 5)
+	require.NoError(t, err)
+	assert.Equal(t, true, d.Allowed)
+	assert.Equal(t, int64(5), d.Remaining)
+
+	// 超过窗口的最大数量，重试也不会通过
+	d, err = limiter.Decide(context.Background(), 11)
+	require.NoError(t, err)
+	assert.Equal(t, false, d.Allowed)
+	assert.Equal(t, time.Duration(0), d.RetryAfter)
+}
+
+func TestFixedWindowLimiter_WaitN(t *testing.T) {
+	testCases := []struct {
+		name     string
+		interval time.Duration
+		maxCount int64
+		before   func(*testing.T, *FixedWindowLimiter, *restrictor.FakeClock)
+		n        int64
+		timeout  time.Duration
+		// 等待开始以后把时间推进多久
+		advance  time.Duration
+		wantErr  error
+		wantWait time.Duration
+	}{
+		// 窗口内还有余量，直接通过
+		{
+			name:     "no wait",
+			interval: time.Minute,
+			maxCount: 10,
+			before:   func(t *testing.T, limiter *FixedWindowLimiter, clock *restrictor.FakeClock) {},
+			n:        10,
+			timeout:  time.Second,
+		},
+		// 等到下一个窗口
+		{
+			name:     "next window",
+			interval: 50 * time.Millisecond,
+			maxCount: 10,
+			before: func(t *testing.T, limiter *FixedWindowLimiter, clock *restrictor.FakeClock) {
+				require.NoError(t, limiter.WaitN(context.Background(), 8))
+			},
+			n:        5,
+			timeout:  time.Second,
+			advance:  50*time.Millisecond + 1,
+			wantWait: 50*time.Millisecond + 1,
+		},
+		// 窗口结束之前超时
+		{
+			name:     "Deadline",
+			interval: time.Minute,
+			maxCount: 10,
+			before: func(t *testing.T, limiter *FixedWindowLimiter, clock *restrictor.FakeClock) {
+				require.NoError(t, limiter.WaitN(context.Background(), 10))
+			},
+			n:       1,
+			timeout: 10 * time.Millisecond,
+			wantErr: context.DeadlineExceeded,
+		},
+		// 超过窗口内的最大请求数量
+		{
+			name:     "over max count",
+			interval: time.Minute,
+			maxCount: 10,
+			before:   func(t *testing.T, limiter *FixedWindowLimiter, clock *restrictor.FakeClock) {},
+			n:        11,
+			timeout:  time.Second,
+			wantErr:  restrictor.ErrExceedsCapacity,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			clock := restrictor.NewFakeClock(time.Now())
+			limiter := NewFixedWindowLimiter(tc.interval, tc.maxCount, WithClock(clock))
+			tc.before(t, limiter, clock)
+			ctx, cancel := context.WithTimeout(context.Background(), tc.timeout)
+			defer cancel()
+			if tc.advance > 0 {
+				go func() {
+					clock.BlockUntil(1)
+					clock.Advance(tc.advance)
+				}()
+			}
+			start := clock.Now()
+			err := limiter.WaitN(ctx, tc.n)
+			require.ErrorIs(t, err, tc.wantErr)
+			assert.Equal(t, tc.wantWait, clock.Now().Sub(start))
+		})
+	}
+}
+
 func ExampleFixedWindowLimiter_Allow() {
 	r := gin.Default()
 	var limit = NewFixedWindowLimiter(10*time.Second, 10)
@@ -106,3 +272,81 @@ func ExampleFixedWindowLimiter_Allow() {
 	}
 	//output
 }
+
+func TestFixedWindowLimiter_SetLimit(t *testing.T) {
+	clock := restrictor.NewFakeClock(time.Now())
+	limiter := NewFixedWindowLimiter(time.Minute, 2, WithClock(clock))
+	require.NoError(t, allowN(limiter, 2))
+	require.ErrorIs(t, allowN(limiter, 1), restrictor.ErrLimitExceeded)
+
+	// 调大以后当前窗口已经通过的请求数量保留
+	limiter.SetLimit(3)
+	require.NoError(t, allowN(limiter, 1))
+	require.ErrorIs(t, allowN(limiter, 1), restrictor.ErrLimitExceeded)
+
+	// 调小以后剩余的数量不会是负数
+	limiter.SetLimit(1)
+	d, err := limiter.Decide(context.Background(), 1)
+	require.NoError(t, err)
+	assert.Equal(t, false, d.Allowed)
+	assert.Equal(t, int64(1), d.Limit)
+	assert.Equal(t, int64(0), d.Remaining)
+	require.ErrorIs(t, limiter.WaitN(context.Background(), 2), restrictor.ErrExceedsCapacity)
+
+	// 调小窗口以后按照新的大小开启下一个窗口
+	limiter.SetInterval(time.Second)
+	clock.Advance(2 * time.Second)
+	require.NoError(t, allowN(limiter, 1))
+	require.ErrorIs(t, allowN(limiter, 1), restrictor.ErrLimitExceeded)
+}
+
+func TestFixedWindowLimiter_SetLimitConcurrent(t *testing.T) {
+	limiter := NewFixedWindowLimiter(time.Minute, 100, WithClock(restrictor.NewFakeClock(time.Now())))
+	var passed int64
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				if ok, _ := limiter.Allow(context.Background()); ok {
+					atomic.AddInt64(&passed, 1)
+				}
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			limiter.SetLimit(100)
+			limiter.SetInterval(time.Minute)
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int64(100), passed)
+}
+
+func TestFixedWindowLimiter_Rollover(t *testing.T) {
+	clock := restrictor.NewFakeClock(time.Now())
+	limiter := NewFixedWindowLimiter(time.Minute, 8, WithClock(clock))
+	ctx := context.Background()
+
+	// 所有请求同时进入新的窗口，切换窗口时不能清掉其他请求已经计入新窗口的数量
+	for round := 0; round < 500; round++ {
+		clock.Advance(time.Minute + 1)
+		start := make(chan struct{})
+		var passed int64
+		var wg sync.WaitGroup
+		for i := 0; i < 16; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				<-start
+				if ok, _ := limiter.Allow(ctx); ok {
+					atomic.AddInt64(&passed, 1)
+				}
+			}()
+		}
+		close(start)
+		wg.Wait()
+		require.Equal(t, int64(8), passed)
+	}
+}
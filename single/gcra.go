@@ -0,0 +1,164 @@
+package single
+
+import (
+	"context"
+	"github.com/liquanhui-99/restrictor"
+	"sync/atomic"
+	"time"
+)
+
+// GCRALimiter 基于GCRA(通用信元速率算法)实现的限流器，只保存一个理论到达时间(TAT)，
+// 效果和令牌桶一样允许突发流量，但是不需要补充令牌，被拒绝时可以精确计算需要等待的时间
+type GCRALimiter struct {
+	// params 限流的参数，修改时整体替换
+	params atomic.Pointer[gcraParams]
+	// tat 理论到达时间，单位是纳秒，通过CAS更新
+	tat atomic.Int64
+	// clock 获取时间的时钟
+	clock restrictor.Clock
+}
+
+// gcraParams GCRA限流器的参数，创建以后不再修改
+type gcraParams struct {
+	// period 统计的周期
+	period time.Duration
+	// limit period内平均允许的请求数量
+	limit int64
+	// emission 两个请求之间的理论间隔，也就是period/limit
+	emission time.Duration
+	// burst 允许的最大突发请求数量
+	burst int64
+}
+
+// NewGCRALimiter 初始化GCRA限流器，period内平均允许limit个请求，burst是允许的最大突发请求数量，
+// limit必须大于0
+func NewGCRALimiter(period time.Duration, limit int64, burst int64, opts ...Option) *GCRALimiter {
+	o := newOptions(opts)
+	limiter := &GCRALimiter{clock: o.clock}
+	limiter.params.Store(newGCRAParams(period, limit, burst))
+	return limiter
+}
+
+func newGCRAParams(period time.Duration, limit int64, burst int64) *gcraParams {
+	return &gcraParams{
+		period:   period,
+		limit:    limit,
+		emission: period / time.Duration(limit),
+		burst:    burst,
+	}
+}
+
+// Allow 是否允许继续请求
+func (g *GCRALimiter) Allow(ctx context.Context) (bool, error) {
+	return g.AllowN(ctx, 1)
+}
+
+// AllowN 是否允许n个请求继续，n个请求要么全部通过，要么全部拒绝
+func (g *GCRALimiter) AllowN(ctx context.Context, n int64) (bool, error) {
+	d, err := g.Decide(ctx, n)
+	if err != nil {
+		return false, err
+	}
+	if !d.Allowed {
+		return false, restrictor.NewLimitError(d)
+	}
+	return true, nil
+}
+
+// Decide 判定是否允许n个请求继续，被拒绝时RetryAfter是理论上允许这n个请求的时间
+func (g *GCRALimiter) Decide(ctx context.Context, n int64) (restrictor.Decision, error) {
+	if err := restrictor.CheckCount(n); err != nil {
+		return restrictor.Decision{}, err
+	}
+	if err := ctx.Err(); err != nil {
+		return restrictor.Decision{}, err
+	}
+	now := g.clock.Now().UnixNano()
+	p := g.params.Load()
+	// 允许突发的时间范围
+	tolerance := p.burst * int64(p.emission)
+	for {
+		old := g.tat.Load()
+		tat := old
+		if tat < now {
+			tat = now
+		}
+		newTat := tat + n*int64(p.emission)
+		allowAt := newTat - tolerance
+		if n > p.burst || allowAt > now {
+			d := p.decision(now, tat-tolerance, tat, false)
+			if n <= p.burst {
+				d.RetryAfter = time.Duration(allowAt - now)
+			}
+			return d, nil
+		}
+		if g.tat.CompareAndSwap(old, newTat) {
+			return p.decision(now, allowAt, newTat, true), nil
+		}
+	}
+}
+
+// decision 根据允许的最早时间和理论到达时间生成判定结果
+func (p *gcraParams) decision(now, allowAt, tat int64, allowed bool) restrictor.Decision {
+	d := restrictor.Decision{
+		Allowed: allowed,
+		Limit:   p.burst,
+		ResetAt: time.Unix(0, tat),
+		Limiter: restrictor.GCRA,
+	}
+	if p.emission > 0 && now > allowAt {
+		d.Remaining = (now - allowAt) / int64(p.emission)
+	}
+	return d
+}
+
+// RefundN 把理论到达时间往前移动n个请求的间隔，不早于当前时间，at不影响归还
+func (g *GCRALimiter) RefundN(n int64, at time.Time) {
+	now := g.clock.Now().UnixNano()
+	emission := int64(g.params.Load().emission)
+	for {
+		old := g.tat.Load()
+		tat := old - n*emission
+		if tat < now {
+			tat = now
+		}
+		if tat >= old || g.tat.CompareAndSwap(old, tat) {
+			return
+		}
+	}
+}
+
+// SetLimit 修改period内平均允许的请求数量，limit必须大于0，可以和Allow并发调用。
+// 理论到达时间保留，已经消耗的额度按照新的速率恢复
+func (g *GCRALimiter) SetLimit(limit int64) {
+	g.update(func(p *gcraParams) *gcraParams {
+		return newGCRAParams(p.period, limit, p.burst)
+	})
+}
+
+// SetInterval 修改统计的周期，可以和Allow并发调用
+func (g *GCRALimiter) SetInterval(period time.Duration) {
+	g.update(func(p *gcraParams) *gcraParams {
+		return newGCRAParams(period, p.limit, p.burst)
+	})
+}
+
+// SetBurst 修改允许的最大突发请求数量，可以和Allow并发调用
+func (g *GCRALimiter) SetBurst(burst int64) {
+	g.update(func(p *gcraParams) *gcraParams {
+		return newGCRAParams(p.period, p.limit, burst)
+	})
+}
+
+// update 通过CAS替换参数，避免并发修改不同的参数时互相覆盖
+func (g *GCRALimiter) update(fn func(p *gcraParams) *gcraParams) {
+	for {
+		old := g.params.Load()
+		if g.params.CompareAndSwap(old, fn(old)) {
+			return
+		}
+	}
+}
+
+// Close GCRA限流器没有需要释放的资源
+func (g *GCRALimiter) Close() {}
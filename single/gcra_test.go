@@ -0,0 +1,186 @@
+package single
+
+import (
+	"context"
+	"github.com/go-playground/assert/v2"
+	"github.com/liquanhui-99/restrictor"
+	"github.com/stretchr/testify/require"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestGCRALimiter_AllowN(t *testing.T) {
+	testCases := []struct {
+		name    string
+		period  time.Duration
+		limit   int64
+		burst   int64
+		before  func(*testing.T, *GCRALimiter, *restrictor.FakeClock)
+		n       int64
+		wantErr error
+		wantRes bool
+	}{
+		// 一开始允许突发的请求
+		{
+			name:    "burst",
+			period:  time.Second,
+			limit:   10,
+			burst:   5,
+			before:  func(t *testing.T, limiter *GCRALimiter, clock *restrictor.FakeClock) {},
+			n:       5,
+			wantRes: true,
+		},
+		// 超过突发的数量
+		{
+			name:    "over burst",
+			period:  time.Second,
+			limit:   10,
+			burst:   5,
+			before:  func(t *testing.T, limiter *GCRALimiter, clock *restrictor.FakeClock) {},
+			n:       6,
+			wantErr: restrictor.ErrLimitExceeded,
+			wantRes: false,
+		},
+		// 突发的请求用完以后还没有到下一个请求的理论到达时间
+		{
+			name:   "too early",
+			period: time.Second,
+			limit:  10,
+			burst:  5,
+			before: func(t *testing.T, limiter *GCRALimiter, clock *restrictor.FakeClock) {
+				ok, err := limiter.AllowN(context.Background(), 5)
+				require.NoError(t, err)
+				require.True(t, ok)
+				clock.Advance(99 * time.Millisecond)
+			},
+			n:       1,
+			wantErr: restrictor.ErrLimitExceeded,
+			wantRes: false,
+		},
+		// 到了下一个请求的理论到达时间
+		{
+			name:   "emission",
+			period: time.Second,
+			limit:  10,
+			burst:  5,
+			before: func(t *testing.T, limiter *GCRALimiter, clock *restrictor.FakeClock) {
+				ok, err := limiter.AllowN(context.Background(), 5)
+				require.NoError(t, err)
+				require.True(t, ok)
+				clock.Advance(100 * time.Millisecond)
+			},
+			n:       1,
+			wantRes: true,
+		},
+		// 空闲很久以后最多也只允许burst个突发请求
+		{
+			name:   "cap at burst",
+			period: time.Second,
+			limit:  10,
+			burst:  5,
+			before: func(t *testing.T, limiter *GCRALimiter, clock *restrictor.FakeClock) {
+				ok, err := limiter.AllowN(context.Background(), 5)
+				require.NoError(t, err)
+				require.True(t, ok)
+				clock.Advance(time.Hour)
+			},
+			n:       6,
+			wantErr: restrictor.ErrLimitExceeded,
+			wantRes: false,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			clock := restrictor.NewFakeClock(time.Now())
+			limiter := NewGCRALimiter(tc.period, tc.limit, tc.burst, WithClock(clock))
+			defer limiter.Close()
+			tc.before(t, limiter, clock)
+			res, err := limiter.AllowN(context.Background(), tc.n)
+			require.ErrorIs(t, err, tc.wantErr)
+			assert.Equal(t, tc.wantRes, res)
+		})
+	}
+}
+
+func TestGCRALimiter_Decide(t *testing.T) {
+	clock := restrictor.NewFakeClock(time.Now())
+	limiter := NewGCRALimiter(time.Second, 10, 5, WithClock(clock))
+	d, err := limiter.Decide(context.Background(), 2)
+	require.NoError(t, err)
+	assert.Equal(t, true, d.Allowed)
+	assert.Equal(t, int64(5), d.Limit)
+	assert.Equal(t, int64(3), d.Remaining)
+	assert.Equal(t, restrictor.GCRA, d.Limiter)
+	assert.Equal(t, clock.Now().Add(200*time.Millisecond).UnixNano(), d.ResetAt.UnixNano())
+
+	// 剩下的3个都用完以后，过了30毫秒再请求2个，需要等到第二个的理论到达时间
+	_, err = limiter.Decide(context.Background(), 3)
+	require.NoError(t, err)
+	clock.Advance(30 * time.Millisecond)
+	d, err = limiter.Decide(context.Background(), 2)
+	require.NoError(t, err)
+	assert.Equal(t, false, d.Allowed)
+	assert.Equal(t, int64(0), d.Remaining)
+	assert.Equal(t, 170*time.Millisecond, d.RetryAfter)
+	assert.Equal(t, clock.Now().Add(470*time.Millisecond).UnixNano(), d.ResetAt.UnixNano())
+
+	// 超过突发的数量，重试也不会通过
+	d, err = limiter.Decide(context.Background(), 6)
+	require.NoError(t, err)
+	assert.Equal(t, false, d.Allowed)
+	assert.Equal(t, time.Duration(0), d.RetryAfter)
+}
+
+func TestGCRALimiter_Concurrent(t *testing.T) {
+	limiter := NewGCRALimiter(time.Hour, 1, 100, WithClock(restrictor.NewFakeClock(time.Now())))
+	var passed int64
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				if ok, _ := limiter.Allow(context.Background()); ok {
+					atomic.AddInt64(&passed, 1)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int64(100), passed)
+}
+
+func TestGCRALimiter_SetLimit(t *testing.T) {
+	clock := restrictor.NewFakeClock(time.Now())
+	// 每秒10个，允许突发2个
+	limiter := NewGCRALimiter(time.Second, 10, 2, WithClock(clock))
+	require.NoError(t, allowN(limiter, 2))
+	d, err := limiter.Decide(context.Background(), 1)
+	require.NoError(t, err)
+	assert.Equal(t, false, d.Allowed)
+	assert.Equal(t, 100*time.Millisecond, d.RetryAfter)
+
+	// 调大突发以后理论到达时间保留，可以再通过一个
+	limiter.SetBurst(3)
+	require.NoError(t, allowN(limiter, 1))
+	require.ErrorIs(t, allowN(limiter, 1), restrictor.ErrLimitExceeded)
+
+	// 调大速率以后新的请求按照新的间隔计算
+	limiter.SetLimit(20)
+	clock.Advance(250 * time.Millisecond)
+	d, err = limiter.Decide(context.Background(), 1)
+	require.NoError(t, err)
+	assert.Equal(t, true, d.Allowed)
+	assert.Equal(t, int64(3), d.Limit)
+
+	// 调大周期以后间隔变回100毫秒
+	limiter.SetInterval(2 * time.Second)
+	require.NoError(t, allowN(limiter, 2))
+	d, err = limiter.Decide(context.Background(), 1)
+	require.NoError(t, err)
+	assert.Equal(t, false, d.Allowed)
+	assert.Equal(t, 100*time.Millisecond, d.RetryAfter)
+}
@@ -0,0 +1,209 @@
+package single
+
+import (
+	"container/list"
+	"context"
+	"github.com/liquanhui-99/restrictor"
+	"sync"
+	"time"
+)
+
+// KeyedLimiter 按照key区分的限流器，每个key第一次请求时通过factory创建一个限流器，
+// 空闲超过ttl的key和超过maxKeys时最久没有访问的key会被淘汰，淘汰时调用限流器的Close，
+// 淘汰时还有请求正在使用的限流器等到最后一个请求结束再关闭，请求不会用到已经关闭的限流器，
+// Allow和AllowN的签名和distribute.DistributedLimiter一致，可以和Redis限流器互相替换
+type KeyedLimiter struct {
+	mu sync.Mutex
+	// factory 创建key对应的限流器
+	factory func(key string) Limiter
+	// ttl key空闲多久以后淘汰，小于等于0时不按照空闲时间淘汰
+	ttl time.Duration
+	// maxKeys 最多保存的key数量，小于等于0时不限制
+	maxKeys int
+	// lru 按照访问时间排序的key，最近访问的在前面
+	lru *list.List
+	// entries key对应lru中的元素
+	entries map[string]*list.Element
+	// closed 限流器是否已经关闭
+	closed bool
+	// clock 获取时间的时钟
+	clock restrictor.Clock
+}
+
+// keyedEntry lru中保存的key和限流器
+type keyedEntry struct {
+	key     string
+	limiter Limiter
+	// last 最近一次访问的时间，单位是纳秒
+	last int64
+	// refs 正在使用限流器的请求数量
+	refs int
+	// evicted 已经被淘汰，最后一个请求结束时关闭限流器
+	evicted bool
+}
+
+// NewKeyedLimiter 初始化按照key区分的限流器，factory创建每个key的限流器，
+// ttl是key空闲多久以后淘汰，maxKeys是最多保存的key数量，小于等于0时不限制
+func NewKeyedLimiter(factory func(key string) Limiter, ttl time.Duration, maxKeys int, opts ...Option) *KeyedLimiter {
+	o := newOptions(opts)
+	return &KeyedLimiter{
+		factory: factory,
+		ttl:     ttl,
+		maxKeys: maxKeys,
+		lru:     list.New(),
+		entries: map[string]*list.Element{},
+		clock:   o.clock,
+	}
+}
+
+// Allow 是否允许key继续请求
+func (k *KeyedLimiter) Allow(ctx context.Context, key string) (bool, error) {
+	return k.AllowN(ctx, key, 1)
+}
+
+// AllowN 是否允许key消耗n个单位继续请求，限流器关闭以后返回restrictor.ErrLimiterClosed
+func (k *KeyedLimiter) AllowN(ctx context.Context, key string, n int64) (bool, error) {
+	if err := restrictor.CheckCount(n); err != nil {
+		return false, err
+	}
+	entry, err := k.get(key)
+	if err != nil {
+		return false, err
+	}
+	defer k.release(entry)
+	return entry.limiter.AllowN(ctx, n)
+}
+
+// RefundN 把at时消耗的n个单位归还给key的限流器，at通过Now获取。key不存在或者限流器没有实现RefundLimiter时
+// 直接忽略，LeakeyBucketLimiter和WarmUpTokenBucketLimiter消耗的数量无法归还
+func (k *KeyedLimiter) RefundN(key string, n int64, at time.Time) {
+	k.mu.Lock()
+	elem, ok := k.entries[key]
+	if !ok {
+		k.mu.Unlock()
+		return
+	}
+	entry := elem.Value.(*keyedEntry)
+	entry.refs++
+	k.mu.Unlock()
+	defer k.release(entry)
+	if limiter, ok := entry.limiter.(RefundLimiter); ok {
+		limiter.RefundN(n, at)
+	}
+}
+
+// Now 当前时间，在AllowN之前获取，用来调用RefundN，factory创建的限流器需要使用同一个时钟
+func (k *KeyedLimiter) Now() time.Time {
+	return k.clock.Now()
+}
+
+// Range 对当前保存的每个key的限流器调用f，可以用来修改已经创建的限流器的参数，
+// 调用f的时候持有锁，f中不能调用KeyedLimiter的方法
+func (k *KeyedLimiter) Range(f func(key string, limiter Limiter)) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	for elem := k.lru.Front(); elem != nil; elem = elem.Next() {
+		entry := elem.Value.(*keyedEntry)
+		f(entry.key, entry.limiter)
+	}
+}
+
+// Len 当前保存的key数量
+func (k *KeyedLimiter) Len() int {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return k.lru.Len()
+}
+
+// get 获取key对应的限流器，不存在时创建，同时淘汰空闲和超过数量的key，
+// 返回的限流器用完以后需要调用release
+func (k *KeyedLimiter) get(key string) (*keyedEntry, error) {
+	now := k.clock.Now().UnixNano()
+	k.mu.Lock()
+	if k.closed {
+		k.mu.Unlock()
+		return nil, restrictor.ErrLimiterClosed
+	}
+	var entry *keyedEntry
+	if elem, ok := k.entries[key]; ok {
+		entry = elem.Value.(*keyedEntry)
+		entry.last = now
+		k.lru.MoveToFront(elem)
+	} else {
+		entry = &keyedEntry{key: key, limiter: k.factory(key), last: now}
+		k.entries[key] = k.lru.PushFront(entry)
+	}
+	entry.refs++
+	evicted := k.evict(now)
+	k.mu.Unlock()
+
+	// Close可能比较耗时，放到锁外面
+	for _, l := range evicted {
+		l.Close()
+	}
+	return entry, nil
+}
+
+// release 请求用完了限流器，限流器已经被淘汰并且没有其他请求在使用时关闭
+func (k *KeyedLimiter) release(entry *keyedEntry) {
+	k.mu.Lock()
+	entry.refs--
+	closing := entry.evicted && entry.refs == 0
+	k.mu.Unlock()
+	if closing {
+		entry.limiter.Close()
+	}
+}
+
+// evict 从最久没有访问的key开始，淘汰空闲超过ttl和超过maxKeys的key，
+// 返回可以立即关闭的限流器，还有请求在使用的限流器由release关闭
+func (k *KeyedLimiter) evict(now int64) []Limiter {
+	var evicted []Limiter
+	for elem := k.lru.Back(); elem != nil; elem = k.lru.Back() {
+		entry := elem.Value.(*keyedEntry)
+		idle := k.ttl > 0 && now-entry.last > int64(k.ttl)
+		over := k.maxKeys > 0 && k.lru.Len() > k.maxKeys
+		if !idle && !over {
+			break
+		}
+		k.lru.Remove(elem)
+		delete(k.entries, entry.key)
+		if l := k.remove(entry); l != nil {
+			evicted = append(evicted, l)
+		}
+	}
+	return evicted
+}
+
+// remove 标记entry已经被淘汰，没有请求在使用时返回需要关闭的限流器，调用方需要持有锁
+func (k *KeyedLimiter) remove(entry *keyedEntry) Limiter {
+	entry.evicted = true
+	if entry.refs > 0 {
+		return nil
+	}
+	return entry.limiter
+}
+
+// Close 关闭所有key的限流器，正在使用的限流器等到请求结束再关闭，
+// 关闭以后的请求返回restrictor.ErrLimiterClosed，可以重复调用
+func (k *KeyedLimiter) Close() {
+	k.mu.Lock()
+	if k.closed {
+		k.mu.Unlock()
+		return
+	}
+	k.closed = true
+	limiters := make([]Limiter, 0, k.lru.Len())
+	for elem := k.lru.Front(); elem != nil; elem = elem.Next() {
+		if l := k.remove(elem.Value.(*keyedEntry)); l != nil {
+			limiters = append(limiters, l)
+		}
+	}
+	k.lru.Init()
+	k.entries = map[string]*list.Element{}
+	k.mu.Unlock()
+
+	for _, l := range limiters {
+		l.Close()
+	}
+}
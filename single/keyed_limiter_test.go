@@ -0,0 +1,282 @@
+package single
+
+import (
+	"context"
+	"github.com/go-playground/assert/v2"
+	"github.com/liquanhui-99/restrictor"
+	"github.com/stretchr/testify/require"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestKeyedLimiter_AllowN(t *testing.T) {
+	testCases := []struct {
+		name    string
+		ttl     time.Duration
+		maxKeys int
+		before  func(*testing.T, *KeyedLimiter, *restrictor.FakeClock)
+		key     string
+		n       int64
+		wantErr error
+		wantRes bool
+		// 执行完以后保存的key数量
+		wantLen int
+		// 执行完以后被关闭的限流器数量
+		wantClosed int64
+	}{
+		// 第一次请求时创建限流器
+		{
+			name:    "create",
+			ttl:     time.Minute,
+			before:  func(t *testing.T, limiter *KeyedLimiter, clock *restrictor.FakeClock) {},
+			key:     "a",
+			n:       10,
+			wantRes: true,
+			wantLen: 1,
+		},
+		// 每个key单独限流
+		{
+			name: "limit per key",
+			ttl:  time.Minute,
+			before: func(t *testing.T, limiter *KeyedLimiter, clock *restrictor.FakeClock) {
+				ok, err := limiter.AllowN(context.Background(), "a", 10)
+				require.NoError(t, err)
+				require.True(t, ok)
+				ok, err = limiter.AllowN(context.Background(), "b", 10)
+				require.NoError(t, err)
+				require.True(t, ok)
+			},
+			key:     "a",
+			n:       1,
+			wantErr: restrictor.ErrLimitExceeded,
+			wantRes: false,
+			wantLen: 2,
+		},
+		// 空闲超过ttl的key被淘汰，重新创建的限流器是新的
+		{
+			name: "ttl",
+			ttl:  time.Minute,
+			before: func(t *testing.T, limiter *KeyedLimiter, clock *restrictor.FakeClock) {
+				ok, err := limiter.AllowN(context.Background(), "a", 10)
+				require.NoError(t, err)
+				require.True(t, ok)
+				clock.Advance(time.Minute + 1)
+			},
+			key:        "b",
+			n:          1,
+			wantRes:    true,
+			wantLen:    1,
+			wantClosed: 1,
+		},
+		// 超过最大数量时淘汰最久没有访问的key
+		{
+			name:    "lru",
+			ttl:     time.Minute,
+			maxKeys: 2,
+			before: func(t *testing.T, limiter *KeyedLimiter, clock *restrictor.FakeClock) {
+				for _, key := range []string{"a", "b", "a"} {
+					ok, err := limiter.Allow(context.Background(), key)
+					require.NoError(t, err)
+					require.True(t, ok)
+				}
+			},
+			key:        "c",
+			n:          1,
+			wantRes:    true,
+			wantLen:    2,
+			wantClosed: 1,
+		},
+		// 关闭以后拒绝请求
+		{
+			name: "closed",
+			ttl:  time.Minute,
+			before: func(t *testing.T, limiter *KeyedLimiter, clock *restrictor.FakeClock) {
+				ok, err := limiter.Allow(context.Background(), "a")
+				require.NoError(t, err)
+				require.True(t, ok)
+				limiter.Close()
+				limiter.Close()
+			},
+			key:        "a",
+			n:          1,
+			wantErr:    restrictor.ErrLimiterClosed,
+			wantRes:    false,
+			wantLen:    0,
+			wantClosed: 1,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			clock := restrictor.NewFakeClock(time.Now())
+			var closed int64
+			limiter := NewKeyedLimiter(func(key string) Limiter {
+				return &closeCounter{
+					Limiter: NewFixedWindowLimiter(time.Hour, 10, WithClock(clock)),
+					closed:  &closed,
+				}
+			}, tc.ttl, tc.maxKeys, WithClock(clock))
+			tc.before(t, limiter, clock)
+			res, err := limiter.AllowN(context.Background(), tc.key, tc.n)
+			require.ErrorIs(t, err, tc.wantErr)
+			assert.Equal(t, tc.wantRes, res)
+			assert.Equal(t, tc.wantLen, limiter.Len())
+			assert.Equal(t, tc.wantClosed, atomic.LoadInt64(&closed))
+		})
+	}
+}
+
+func TestKeyedLimiter_LRUOrder(t *testing.T) {
+	limiter := NewKeyedLimiter(func(key string) Limiter {
+		return NewFixedWindowLimiter(time.Hour, 1)
+	}, 0, 2)
+	defer limiter.Close()
+	ctx := context.Background()
+	_, err := limiter.Allow(ctx, "a")
+	require.NoError(t, err)
+	_, err = limiter.Allow(ctx, "b")
+	require.NoError(t, err)
+	// 访问a以后b变成最久没有访问的key
+	_, err = limiter.Allow(ctx, "a")
+	require.ErrorIs(t, err, restrictor.ErrLimitExceeded)
+	_, err = limiter.Allow(ctx, "c")
+	require.NoError(t, err)
+
+	// a还在，限流器的状态保留
+	_, err = limiter.Allow(ctx, "a")
+	require.ErrorIs(t, err, restrictor.ErrLimitExceeded)
+	// b被淘汰了，重新创建的限流器是新的
+	ok, err := limiter.Allow(ctx, "b")
+	require.NoError(t, err)
+	require.True(t, ok)
+}
+
+// closeCounter 记录限流器被关闭的次数
+type closeCounter struct {
+	Limiter
+	closed *int64
+}
+
+func (c *closeCounter) Close() {
+	atomic.AddInt64(c.closed, 1)
+	c.Limiter.Close()
+}
+
+// closeGuard 记录关闭以后还被使用的次数
+type closeGuard struct {
+	Limiter
+	closed    atomic.Bool
+	afterUsed *int64
+	// block 不为nil时AllowN阻塞直到block关闭
+	block chan struct{}
+}
+
+func (c *closeGuard) AllowN(ctx context.Context, n int64) (bool, error) {
+	if c.block != nil {
+		<-c.block
+	}
+	if c.closed.Load() {
+		atomic.AddInt64(c.afterUsed, 1)
+	}
+	return c.Limiter.AllowN(ctx, n)
+}
+
+func (c *closeGuard) Close() {
+	c.closed.Store(true)
+	c.Limiter.Close()
+}
+
+func TestKeyedLimiter_EvictInUse(t *testing.T) {
+	var afterUsed int64
+	block := make(chan struct{})
+	guards := map[string]*closeGuard{}
+	var mu sync.Mutex
+	limiter := NewKeyedLimiter(func(key string) Limiter {
+		g := &closeGuard{Limiter: NewTokenBucketLimiter(10, time.Hour), afterUsed: &afterUsed}
+		if key == "a" {
+			g.block = block
+		}
+		mu.Lock()
+		guards[key] = g
+		mu.Unlock()
+		return g
+	}, 0, 1)
+	defer limiter.Close()
+	ctx := context.Background()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_, _ = limiter.Allow(ctx, "a")
+	}()
+	require.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return guards["a"] != nil
+	}, time.Second, time.Millisecond)
+
+	// a被淘汰了，但是还有请求在使用，不能关闭
+	_, _ = limiter.Allow(ctx, "b")
+	assert.Equal(t, 1, limiter.Len())
+	mu.Lock()
+	a := guards["a"]
+	mu.Unlock()
+	require.False(t, a.closed.Load())
+
+	// 最后一个请求结束以后关闭
+	close(block)
+	<-done
+	require.True(t, a.closed.Load())
+	assert.Equal(t, int64(0), atomic.LoadInt64(&afterUsed))
+}
+
+func TestKeyedLimiter_EvictRace(t *testing.T) {
+	var afterUsed int64
+	limiter := NewKeyedLimiter(func(key string) Limiter {
+		return &closeGuard{Limiter: NewLazyTokenBucketLimiter(1000, 1000), afterUsed: &afterUsed}
+	}, 0, 2)
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			// 只保存两个key，请求的同时不断淘汰
+			for j := 0; j < 1000; j++ {
+				key := string(rune('a' + (i+j)%5))
+				at := limiter.Now()
+				_, _ = limiter.Allow(ctx, key)
+				limiter.RefundN(key, 1, at)
+			}
+		}(i)
+	}
+	wg.Wait()
+	limiter.Close()
+	assert.Equal(t, int64(0), atomic.LoadInt64(&afterUsed))
+}
+
+func TestKeyedLimiter_Range(t *testing.T) {
+	limiter := NewKeyedLimiter(func(key string) Limiter {
+		return NewFixedWindowLimiter(time.Hour, 1)
+	}, 0, 0)
+	defer limiter.Close()
+	ctx := context.Background()
+	for _, key := range []string{"a", "b"} {
+		_, err := limiter.Allow(ctx, key)
+		require.NoError(t, err)
+	}
+
+	// 修改已经创建的限流器的参数
+	keys := map[string]struct{}{}
+	limiter.Range(func(key string, l Limiter) {
+		keys[key] = struct{}{}
+		l.(*FixedWindowLimiter).SetLimit(2)
+	})
+	assert.Equal(t, map[string]struct{}{"a": {}, "b": {}}, keys)
+	ok, err := limiter.Allow(ctx, "a")
+	require.NoError(t, err)
+	require.True(t, ok)
+}
@@ -0,0 +1,285 @@
+package single
+
+import (
+	"context"
+	"github.com/liquanhui-99/restrictor"
+	"math"
+	"sync/atomic"
+	"time"
+)
+
+// LazyTokenBucketLimiter 惰性补充令牌的令牌桶限流器，不启动goroutine也不使用channel，
+// 每次请求时根据距离上一次请求经过的时间计算补充的令牌，适合为每个用户创建一个限流器的场景
+type LazyTokenBucketLimiter struct {
+	// state 令牌桶当前的状态和参数，通过CAS整体替换
+	state atomic.Pointer[lazyBucketState]
+	// clock 获取时间的时钟
+	clock restrictor.Clock
+}
+
+// lazyBucketState 令牌桶的状态，创建以后不再修改
+type lazyBucketState struct {
+	// rate 每秒补充的令牌数量，可以是小数，例如0.5表示两秒补充一个令牌
+	rate float64
+	// burst 令牌桶的容量，也就是允许的最大突发请求数量
+	burst int64
+	// tokens 桶里的令牌数量，预定未来的令牌时可以是负数
+	tokens float64
+	// last 最近一次计算令牌的时间，单位是纳秒
+	last int64
+}
+
+// NewLazyTokenBucketLimiter 初始化惰性补充的令牌桶，rate是每秒补充的令牌数量，可以是小数；
+// burst是令牌桶的容量，初始化时令牌桶是满的
+func NewLazyTokenBucketLimiter(rate float64, burst int64, opts ...Option) *LazyTokenBucketLimiter {
+	o := newOptions(opts)
+	limiter := &LazyTokenBucketLimiter{
+		clock: o.clock,
+	}
+	limiter.state.Store(&lazyBucketState{
+		rate:   rate,
+		burst:  burst,
+		tokens: float64(burst),
+		last:   o.clock.Now().UnixNano(),
+	})
+	return limiter
+}
+
+// Allow 是否允许继续请求
+func (l *LazyTokenBucketLimiter) Allow(ctx context.Context) (bool, error) {
+	return l.AllowN(ctx, 1)
+}
+
+// AllowN 是否允许消耗n个令牌继续请求，令牌不够时一个都不消耗
+func (l *LazyTokenBucketLimiter) AllowN(ctx context.Context, n int64) (bool, error) {
+	d, err := l.Decide(ctx, n)
+	if err != nil {
+		return false, err
+	}
+	if !d.Allowed {
+		return false, restrictor.NewLimitError(d)
+	}
+	return true, nil
+}
+
+// Decide 判定是否允许消耗n个令牌继续请求，被拒绝时RetryAfter是补充出足够令牌的时间
+func (l *LazyTokenBucketLimiter) Decide(ctx context.Context, n int64) (restrictor.Decision, error) {
+	if err := restrictor.CheckCount(n); err != nil {
+		return restrictor.Decision{}, err
+	}
+	if err := ctx.Err(); err != nil {
+		return restrictor.Decision{}, err
+	}
+	now := l.clock.Now().UnixNano()
+	for {
+		old := l.state.Load()
+		tokens := old.advance(now)
+		if tokens < float64(n) {
+			return old.decision(now, n, tokens, false), nil
+		}
+		tokens -= float64(n)
+		if l.state.CompareAndSwap(old, old.next(tokens, now)) {
+			return old.decision(now, n, tokens, true), nil
+		}
+	}
+}
+
+// decision 根据判定以后桶里的令牌数量生成判定结果
+func (s *lazyBucketState) decision(now int64, n int64, tokens float64, allowed bool) restrictor.Decision {
+	d := restrictor.Decision{
+		Allowed:   allowed,
+		Limit:     s.burst,
+		Remaining: int64(math.Max(math.Floor(tokens), 0)),
+		Limiter:   restrictor.LazyTokenBucket,
+	}
+	// 补充速率为0时永远恢复不了，ResetAt和RetryAfter保持零值
+	if reset := s.refillTime(float64(s.burst) - tokens); reset != InfDuration {
+		d.ResetAt = time.Unix(0, now).Add(reset)
+	}
+	if retry := s.refillTime(float64(n) - tokens); !allowed && n <= s.burst && retry != InfDuration {
+		d.RetryAfter = retry
+	}
+	return d
+}
+
+// refillTime 补充tokens个令牌需要的时间，补充速率为0时返回InfDuration
+func (s *lazyBucketState) refillTime(tokens float64) time.Duration {
+	if tokens <= 0 {
+		return 0
+	}
+	if s.rate <= 0 {
+		return InfDuration
+	}
+	return time.Duration(math.Ceil(tokens / s.rate * float64(time.Second)))
+}
+
+// Wait 阻塞直到拿到一个令牌
+func (l *LazyTokenBucketLimiter) Wait(ctx context.Context) error {
+	return l.WaitN(ctx, 1)
+}
+
+// WaitN 阻塞直到拿到n个令牌，n超过令牌桶的容量时直接返回error，
+// 等待的时长超过ctx的截止时间或者等待过程中ctx结束，预定的令牌会归还给令牌桶
+func (l *LazyTokenBucketLimiter) WaitN(ctx context.Context, n int64) error {
+	if err := restrictor.CheckCount(n); err != nil {
+		return err
+	}
+	if n > l.state.Load().burst {
+		return restrictor.ErrExceedsCapacity
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	r := l.ReserveN(n)
+	if !r.OK() {
+		return restrictor.ErrExceedsCapacity
+	}
+	delay := r.Delay()
+	if delay == 0 {
+		return nil
+	}
+	if deadline, ok := ctx.Deadline(); ok && deadline.Before(r.timeToAct) {
+		r.Cancel()
+		return context.DeadlineExceeded
+	}
+	if err := sleep(ctx, l.clock, delay); err != nil {
+		r.Cancel()
+		return err
+	}
+	return nil
+}
+
+// Reserve 预定一个令牌，等价于ReserveN(1)
+func (l *LazyTokenBucketLimiter) Reserve() *Reservation {
+	return l.ReserveN(1)
+}
+
+// ReserveN 预定n个令牌，令牌不够时预支未来补充的令牌，通过Reservation.Delay获取需要等待的时长，
+// n超过令牌桶的容量或者补充速率为0导致永远等不到令牌时预定失败
+func (l *LazyTokenBucketLimiter) ReserveN(n int64) *Reservation {
+	if restrictor.CheckCount(n) != nil {
+		return &Reservation{ok: false}
+	}
+	now := l.clock.Now().UnixNano()
+	for {
+		old := l.state.Load()
+		if n > old.burst {
+			return &Reservation{ok: false}
+		}
+		tokens := old.advance(now) - float64(n)
+		wait := old.refillTime(-tokens)
+		if wait == InfDuration {
+			return &Reservation{ok: false}
+		}
+		if l.state.CompareAndSwap(old, old.next(tokens, now)) {
+			timeToAct := time.Unix(0, now).Add(wait)
+			return &Reservation{
+				ok:        true,
+				clock:     l.clock,
+				timeToAct: timeToAct,
+				cancel: func(at time.Time) {
+					l.cancelReservation(at, timeToAct, n)
+				},
+			}
+		}
+	}
+}
+
+// cancelReservation 在at时间放弃预定的n个令牌，at不早于timeToAct时预定已经可以使用，调用方可能已经用掉了令牌，
+// 不再归还；否则只归还到timeToAct之前还没有补充出来的部分，最多n个，已经补充出来的令牌用来偿还预支
+func (l *LazyTokenBucketLimiter) cancelReservation(at time.Time, timeToAct time.Time, n int64) {
+	if !at.Before(timeToAct) {
+		return
+	}
+	ts := at.UnixNano()
+	for {
+		old := l.state.Load()
+		restore := old.rate * timeToAct.Sub(at).Seconds()
+		if restore > float64(n) {
+			restore = float64(n)
+		}
+		tokens := old.advance(ts) + restore
+		if tokens > float64(old.burst) {
+			tokens = float64(old.burst)
+		}
+		if l.state.CompareAndSwap(old, old.next(tokens, ts)) {
+			return
+		}
+	}
+}
+
+// putBack 把n个令牌归还给令牌桶，超过容量的部分丢弃
+func (l *LazyTokenBucketLimiter) putBack(n int64) {
+	for {
+		old := l.state.Load()
+		tokens := old.tokens + float64(n)
+		if tokens > float64(old.burst) {
+			tokens = float64(old.burst)
+		}
+		if l.state.CompareAndSwap(old, old.next(tokens, old.last)) {
+			return
+		}
+	}
+}
+
+// RefundN 把n个令牌归还给令牌桶，超过容量的部分丢弃，令牌桶不区分窗口，at不影响归还
+func (l *LazyTokenBucketLimiter) RefundN(n int64, at time.Time) {
+	l.putBack(n)
+}
+
+// SetRate 修改每秒补充的令牌数量，修改之前补充的令牌按照旧的速率计算，可以和Allow并发调用
+func (l *LazyTokenBucketLimiter) SetRate(rate float64) {
+	l.update(func(s *lazyBucketState) {
+		s.rate = rate
+	})
+}
+
+// SetBurst 修改令牌桶的容量，桶里已有的令牌保留，超过新容量的部分丢弃，可以和Allow并发调用
+func (l *LazyTokenBucketLimiter) SetBurst(burst int64) {
+	l.update(func(s *lazyBucketState) {
+		s.burst = burst
+		if s.tokens > float64(burst) {
+			s.tokens = float64(burst)
+		}
+	})
+}
+
+// update 先按照旧的参数补充令牌到当前时间，再通过fn修改参数
+func (l *LazyTokenBucketLimiter) update(fn func(s *lazyBucketState)) {
+	now := l.clock.Now().UnixNano()
+	for {
+		old := l.state.Load()
+		state := old.next(old.advance(now), now)
+		fn(state)
+		if l.state.CompareAndSwap(old, state) {
+			return
+		}
+	}
+}
+
+// advance 计算到now为止桶里的令牌数量
+func (s *lazyBucketState) advance(now int64) float64 {
+	elapsed := now - s.last
+	if elapsed <= 0 {
+		// 其他请求已经用更新的时间计算过了
+		return s.tokens
+	}
+	tokens := s.tokens + float64(elapsed)*s.rate/float64(time.Second)
+	if tokens > float64(s.burst) {
+		tokens = float64(s.burst)
+	}
+	return tokens
+}
+
+// next 参数不变，令牌数量为tokens、时间为now的新状态，时间不能倒退
+func (s *lazyBucketState) next(tokens float64, now int64) *lazyBucketState {
+	last := now
+	if now < s.last {
+		last = s.last
+	}
+	return &lazyBucketState{rate: s.rate, burst: s.burst, tokens: tokens, last: last}
+}
+
+// Close 惰性令牌桶没有需要释放的资源
+func (l *LazyTokenBucketLimiter) Close() {}
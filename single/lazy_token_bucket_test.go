@@ -0,0 +1,301 @@
+package single
+
+import (
+	"context"
+	"github.com/go-playground/assert/v2"
+	"github.com/liquanhui-99/restrictor"
+	"github.com/stretchr/testify/require"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestLazyTokenBucketLimiter_AllowN(t *testing.T) {
+	testCases := []struct {
+		name    string
+		rate    float64
+		burst   int64
+		before  func(*testing.T, *LazyTokenBucketLimiter, *restrictor.FakeClock)
+		n       int64
+		wantErr error
+		wantRes bool
+	}{
+		// 初始化时令牌桶是满的
+		{
+			name:    "burst",
+			rate:    1,
+			burst:   10,
+			before:  func(t *testing.T, limiter *LazyTokenBucketLimiter, clock *restrictor.FakeClock) {},
+			n:       10,
+			wantRes: true,
+		},
+		// 超过令牌桶的容量
+		{
+			name:    "over burst",
+			rate:    1,
+			burst:   10,
+			before:  func(t *testing.T, limiter *LazyTokenBucketLimiter, clock *restrictor.FakeClock) {},
+			n:       11,
+			wantErr: restrictor.ErrLimitExceeded,
+			wantRes: false,
+		},
+		// 小数的补充速率，两秒补充一个令牌
+		{
+			name:  "fractional rate",
+			rate:  0.5,
+			burst: 1,
+			before: func(t *testing.T, limiter *LazyTokenBucketLimiter, clock *restrictor.FakeClock) {
+				// 先把令牌用完
+				require.NoError(t, limiter.WaitN(context.Background(), limiter.state.Load().burst))
+				clock.Advance(2 * time.Second)
+			},
+			n:       1,
+			wantRes: true,
+		},
+		// 小数的补充速率，一秒只补充了半个令牌
+		{
+			name:  "fractional rate not enough",
+			rate:  0.5,
+			burst: 1,
+			before: func(t *testing.T, limiter *LazyTokenBucketLimiter, clock *restrictor.FakeClock) {
+				// 先把令牌用完
+				require.NoError(t, limiter.WaitN(context.Background(), limiter.state.Load().burst))
+				clock.Advance(time.Second)
+			},
+			n:       1,
+			wantErr: restrictor.ErrLimitExceeded,
+			wantRes: false,
+		},
+		// 补充的令牌不超过令牌桶的容量
+		{
+			name:  "cap at burst",
+			rate:  100,
+			burst: 5,
+			before: func(t *testing.T, limiter *LazyTokenBucketLimiter, clock *restrictor.FakeClock) {
+				// 先把令牌用完
+				require.NoError(t, limiter.WaitN(context.Background(), limiter.state.Load().burst))
+				clock.Advance(time.Hour)
+			},
+			n:       6,
+			wantErr: restrictor.ErrLimitExceeded,
+			wantRes: false,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			clock := restrictor.NewFakeClock(time.Now())
+			limiter := NewLazyTokenBucketLimiter(tc.rate, tc.burst, WithClock(clock))
+			defer limiter.Close()
+			tc.before(t, limiter, clock)
+			res, err := limiter.AllowN(context.Background(), tc.n)
+			require.ErrorIs(t, err, tc.wantErr)
+			assert.Equal(t, tc.wantRes, res)
+		})
+	}
+}
+
+func TestLazyTokenBucketLimiter_Decide(t *testing.T) {
+	clock := restrictor.NewFakeClock(time.Now())
+	limiter := NewLazyTokenBucketLimiter(10, 5, WithClock(clock))
+	d, err := limiter.Decide(context.Background(), 5)
+	require.NoError(t, err)
+	assert.Equal(t, true, d.Allowed)
+	assert.Equal(t, int64(5), d.Limit)
+	assert.Equal(t, int64(0), d.Remaining)
+	assert.Equal(t, restrictor.LazyTokenBucket, d.Limiter)
+	assert.Equal(t, clock.Now().Add(500*time.Millisecond).UnixNano(), d.ResetAt.UnixNano())
+
+	// 10个每秒，过了50毫秒补充了半个令牌，再补充1.5个令牌需要150毫秒
+	clock.Advance(50 * time.Millisecond)
+	d, err = limiter.Decide(context.Background(), 2)
+	require.NoError(t, err)
+	assert.Equal(t, false, d.Allowed)
+	assert.Equal(t, 150*time.Millisecond, d.RetryAfter)
+
+	// 补充速率为0，永远恢复不了
+	limiter = NewLazyTokenBucketLimiter(0, 1, WithClock(clock))
+	_, err = limiter.Decide(context.Background(), 1)
+	require.NoError(t, err)
+	d, err = limiter.Decide(context.Background(), 1)
+	require.NoError(t, err)
+	assert.Equal(t, false, d.Allowed)
+	assert.Equal(t, time.Duration(0), d.RetryAfter)
+	require.True(t, d.ResetAt.IsZero())
+}
+
+func TestLazyTokenBucketLimiter_Concurrent(t *testing.T) {
+	limiter := NewLazyTokenBucketLimiter(0, 100, WithClock(restrictor.NewFakeClock(time.Now())))
+	var passed int64
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				if ok, _ := limiter.Allow(context.Background()); ok {
+					atomic.AddInt64(&passed, 1)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int64(100), passed)
+}
+
+func TestLazyTokenBucketLimiter_WaitN(t *testing.T) {
+	testCases := []struct {
+		name     string
+		rate     float64
+		burst    int64
+		n        int64
+		timeout  time.Duration
+		wantErr  error
+		wantWait time.Duration
+	}{
+		// 令牌足够，不需要等待
+		{
+			name:    "no wait",
+			rate:    1,
+			burst:   5,
+			n:       5,
+			timeout: time.Second,
+		},
+		// 超过令牌桶的容量
+		{
+			name:    "over burst",
+			rate:    1,
+			burst:   5,
+			n:       6,
+			timeout: time.Second,
+			wantErr: restrictor.ErrExceedsCapacity,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			limiter := NewLazyTokenBucketLimiter(tc.rate, tc.burst, WithClock(restrictor.NewFakeClock(time.Now())))
+			ctx, cancel := context.WithTimeout(context.Background(), tc.timeout)
+			defer cancel()
+			err := limiter.WaitN(ctx, tc.n)
+			require.ErrorIs(t, err, tc.wantErr)
+		})
+	}
+
+	// 补充速率为0，令牌用完以后永远等不到
+	limiter := NewLazyTokenBucketLimiter(0, 1, WithClock(restrictor.NewFakeClock(time.Now())))
+	require.NoError(t, limiter.Wait(context.Background()))
+	require.ErrorIs(t, limiter.Wait(context.Background()), restrictor.ErrExceedsCapacity)
+
+	// 等待补充的令牌，100个每秒需要等10毫秒
+	clock := restrictor.NewFakeClock(time.Now())
+	limiter = NewLazyTokenBucketLimiter(100, 1, WithClock(clock))
+	require.NoError(t, limiter.Wait(context.Background()))
+	go func() {
+		clock.BlockUntil(1)
+		clock.Advance(10 * time.Millisecond)
+	}()
+	start := clock.Now()
+	require.NoError(t, limiter.Wait(context.Background()))
+	assert.Equal(t, 10*time.Millisecond, clock.Now().Sub(start))
+
+	// 等待的时长超过ctx的截止时间，令牌会归还
+	limiter = NewLazyTokenBucketLimiter(0.001, 1, WithClock(clock))
+	require.NoError(t, limiter.Wait(context.Background()))
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, limiter.Wait(ctx))
+	require.GreaterOrEqual(t, limiter.state.Load().tokens, float64(0))
+}
+
+func TestLazyTokenBucketLimiter_ReserveN(t *testing.T) {
+	clock := restrictor.NewFakeClock(time.Now())
+	limiter := NewLazyTokenBucketLimiter(10, 2, WithClock(clock))
+	r := limiter.ReserveN(2)
+	require.True(t, r.OK())
+	assert.Equal(t, time.Duration(0), r.Delay())
+
+	// 预支未来的令牌，10个每秒需要等100毫秒
+	r = limiter.Reserve()
+	require.True(t, r.OK())
+	assert.Equal(t, 100*time.Millisecond, r.Delay())
+	clock.Advance(40 * time.Millisecond)
+	assert.Equal(t, 60*time.Millisecond, r.Delay())
+	// 只归还还没有补充出来的0.6个令牌，已经补充的0.4个用来偿还预支
+	r.Cancel()
+	r.Cancel()
+	require.InDelta(t, 0, limiter.state.Load().tokens, 1e-9)
+
+	// 已经可以使用的预定不归还
+	clock.Advance(100 * time.Millisecond)
+	r = limiter.Reserve()
+	require.True(t, r.OK())
+	assert.Equal(t, time.Duration(0), r.Delay())
+	r.Cancel()
+	require.InDelta(t, 0, limiter.state.Load().tokens, 1e-9)
+	r = limiter.Reserve()
+	require.True(t, r.OK())
+	clock.Advance(100 * time.Millisecond)
+	r.Cancel()
+	require.InDelta(t, -1, limiter.state.Load().tokens, 1e-9)
+
+	// 超过令牌桶的容量
+	r = limiter.ReserveN(3)
+	require.False(t, r.OK())
+	assert.Equal(t, InfDuration, r.Delay())
+}
+
+func TestLazyTokenBucketLimiter_SetBurst(t *testing.T) {
+	clock := restrictor.NewFakeClock(time.Now())
+	limiter := NewLazyTokenBucketLimiter(1, 2, WithClock(clock))
+	require.NoError(t, allowN(limiter, 2))
+
+	// 调大容量以后桶里的令牌数量保留
+	limiter.SetBurst(4)
+	d, err := limiter.Decide(context.Background(), 1)
+	require.NoError(t, err)
+	assert.Equal(t, false, d.Allowed)
+	assert.Equal(t, int64(4), d.Limit)
+	assert.Equal(t, time.Second, d.RetryAfter)
+	clock.Advance(4 * time.Second)
+	require.NoError(t, allowN(limiter, 4))
+
+	// 修改速率之前补充的令牌按照旧的速率计算
+	clock.Advance(time.Second)
+	limiter.SetRate(10)
+	clock.Advance(100 * time.Millisecond)
+	require.NoError(t, allowN(limiter, 2))
+	require.ErrorIs(t, allowN(limiter, 1), restrictor.ErrLimitExceeded)
+
+	// 调小容量以后超过容量的令牌丢弃
+	clock.Advance(time.Second)
+	limiter.SetBurst(1)
+	require.NoError(t, allowN(limiter, 1))
+	require.ErrorIs(t, allowN(limiter, 1), restrictor.ErrLimitExceeded)
+	require.ErrorIs(t, limiter.WaitN(context.Background(), 2), restrictor.ErrExceedsCapacity)
+}
+
+func TestLazyTokenBucketLimiter_SetRateConcurrent(t *testing.T) {
+	limiter := NewLazyTokenBucketLimiter(0, 100, WithClock(restrictor.NewFakeClock(time.Now())))
+	var passed int64
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				if ok, _ := limiter.Allow(context.Background()); ok {
+					atomic.AddInt64(&passed, 1)
+				}
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			limiter.SetRate(0)
+			limiter.SetBurst(100)
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int64(100), passed)
+}
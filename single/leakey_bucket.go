@@ -2,46 +2,231 @@ package single
 
 import (
 	"context"
+	"github.com/liquanhui-99/restrictor"
+	"math"
 	"sync"
 	"time"
 )
 
-// LeakeyBucketLimiter 漏桶算法实现的限流器
+// LeakeyBucketLimiter 漏桶算法实现的限流器，请求进入桶中按照到达的顺序排队，
+// 每个间隔流出一个单位，桶满了以后新的请求直接拒绝
 type LeakeyBucketLimiter struct {
-	// ticker控制请求的通过频率
-	t *time.Ticker
-	// closeCh 控制关闭
+	mu sync.Mutex
+	// interval 每个单位流出的间隔
+	interval int64
+	// capacity 桶的容量，包括正在流出的单位
+	capacity int64
+	// last 桶中最后一个单位流出的时间，单位是纳秒
+	last int64
+	// close 控制关闭
 	close chan struct{}
 	// once 控制关闭一次
-	once *sync.Once
+	once sync.Once
+	// clock 获取时间的时钟
+	clock restrictor.Clock
 }
 
-// NewLeakeyBucketLimiter 初始化漏桶限流器, interval流量限流的间隔，即多久可以通过一次请求
-func NewLeakeyBucketLimiter(interval time.Duration) *LeakeyBucketLimiter {
-	t := time.NewTicker(interval)
+// NewLeakeyBucketLimiter 初始化漏桶限流器，interval是每个单位流出的间隔，即多久可以通过一次请求，
+// 默认不限制桶的容量，所有请求按照顺序排队，通过WithCapacity限制排队的数量
+func NewLeakeyBucketLimiter(interval time.Duration, opts ...Option) *LeakeyBucketLimiter {
+	o := newOptions(opts)
+	capacity := o.capacity
+	if capacity == 0 {
+		capacity = math.MaxInt64
+	}
 	return &LeakeyBucketLimiter{
-		t:     t,
-		once:  &sync.Once{},
-		close: make(chan struct{}),
+		interval: int64(interval),
+		capacity: capacity,
+		last:     o.clock.Now().UnixNano() - int64(interval),
+		close:    make(chan struct{}),
+		clock:    o.clock,
+	}
+}
+
+// Allow 是否允许通过限流器继续请求，桶没有满时阻塞到轮到这个请求流出，桶满了直接拒绝
+func (l *LeakeyBucketLimiter) Allow(ctx context.Context) (bool, error) {
+	return l.AllowN(ctx, 1)
+}
+
+// AllowN 是否允许n个单位的请求通过限流器，n个单位一起进入桶中，阻塞到最后一个单位流出，
+// 桶里放不下n个单位时直接拒绝，一个单位都不放进去
+func (l *LeakeyBucketLimiter) AllowN(ctx context.Context, n int64) (bool, error) {
+	d, err := l.Decide(ctx, n)
+	if err != nil {
+		return false, err
+	}
+	if !d.Allowed {
+		return false, restrictor.NewLimitError(d)
+	}
+	return true, nil
+}
+
+// Decide 判定桶里是否放得下n个单位，放得下时阻塞到最后一个单位流出以后返回，
+// 被拒绝时RetryAfter是桶里空出足够位置的时间，等待的过程中ctx结束时返回error
+func (l *LeakeyBucketLimiter) Decide(ctx context.Context, n int64) (restrictor.Decision, error) {
+	if err := restrictor.CheckCount(n); err != nil {
+		return restrictor.Decision{}, err
+	}
+	if err := ctx.Err(); err != nil {
+		return restrictor.Decision{}, err
+	}
+	select {
+	case <-l.close:
+		// 关闭以后直接放行
+		capacity := l.Capacity()
+		return restrictor.Decision{Allowed: true, Limit: capacity, Remaining: capacity,
+			ResetAt: l.clock.Now(), Limiter: restrictor.LeakeyBucket}, nil
+	default:
+	}
+
+	now := l.clock.Now().UnixNano()
+	l.mu.Lock()
+	prev, interval, capacity := l.last, l.interval, l.capacity
+	// 排在桶中最后一个单位后面，桶空的时候立刻流出
+	first := prev + interval
+	if first < now {
+		first = now
+	}
+	last := first + (n-1)*interval
+	size := (last-now)/interval + 1
+	if size > capacity {
+		l.mu.Unlock()
+		d := restrictor.Decision{
+			Limit:     capacity,
+			Remaining: capacity - l.size(prev, now, interval),
+			ResetAt:   time.Unix(0, prev),
+			Limiter:   restrictor.LeakeyBucket,
+		}
+		if d.Remaining < 0 {
+			// 调小容量以后桶里的单位可能超过新的容量
+			d.Remaining = 0
+		}
+		if n <= capacity {
+			// 等到桶里只剩下capacity-n个单位
+			d.RetryAfter = time.Duration(prev + (n-capacity)*interval - now + 1)
+			if d.RetryAfter <= 0 {
+				d.RetryAfter = 1
+			}
+		}
+		return d, nil
+	}
+	l.last = last
+	l.mu.Unlock()
+
+	if err := l.wait(ctx, time.Duration(last-now)); err != nil {
+		l.cancel(prev, last)
+		return restrictor.Decision{}, err
+	}
+	return restrictor.Decision{
+		Allowed:   true,
+		Limit:     capacity,
+		Remaining: capacity - size,
+		ResetAt:   time.Unix(0, last),
+		Limiter:   restrictor.LeakeyBucket,
+	}, nil
+}
+
+// Wait 阻塞直到漏桶放行一个请求
+func (l *LeakeyBucketLimiter) Wait(ctx context.Context) error {
+	return l.WaitN(ctx, 1)
+}
+
+// WaitN 阻塞直到漏桶放行n个请求，桶满了时等到桶里空出足够的位置再排队，
+// n超过桶的容量时直接返回error
+func (l *LeakeyBucketLimiter) WaitN(ctx context.Context, n int64) error {
+	if err := restrictor.CheckCount(n); err != nil {
+		return err
+	}
+	for {
+		if n > l.Capacity() {
+			return restrictor.ErrExceedsCapacity
+		}
+		d, err := l.Decide(ctx, n)
+		if err != nil {
+			return err
+		}
+		if d.Allowed {
+			return nil
+		}
+		if err = sleep(ctx, l.clock, d.RetryAfter); err != nil {
+			return err
+		}
 	}
 }
 
-// Allow 是否允许通过限流器继续请求
-func (l LeakeyBucketLimiter) Allow(ctx context.Context) (bool, error) {
+// QueueLen 桶中还没有流出的单位数量
+func (l *LeakeyBucketLimiter) QueueLen() int64 {
+	now := l.clock.Now().UnixNano()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.last <= now {
+		return 0
+	}
+	return (l.last - now + l.interval - 1) / l.interval
+}
+
+// Capacity 桶的容量
+func (l *LeakeyBucketLimiter) Capacity() int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.capacity
+}
+
+// SetBurst 修改桶的容量，至少是1，已经在桶中排队的单位不受影响，可以和Allow并发调用
+func (l *LeakeyBucketLimiter) SetBurst(capacity int64) {
+	if capacity < 1 {
+		capacity = 1
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.capacity = capacity
+}
+
+// SetInterval 修改每个单位流出的间隔，已经在桶中排队的单位按照原来的时间流出，
+// 之后进入桶中的单位按照新的间隔排队，可以和Allow并发调用
+func (l *LeakeyBucketLimiter) SetInterval(interval time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.interval = int64(interval)
+}
+
+// size 最后一个单位在last流出时，now桶中的单位数量，包括正在流出的单位
+func (l *LeakeyBucketLimiter) size(last, now, interval int64) int64 {
+	if last < now {
+		return 0
+	}
+	return (last-now)/interval + 1
+}
+
+// wait 阻塞d的时长，关闭以后直接返回
+func (l *LeakeyBucketLimiter) wait(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+	timer := l.clock.NewTimer(d)
+	defer timer.Stop()
 	select {
 	case <-ctx.Done():
-		return false, ctx.Err()
+		return ctx.Err()
 	case <-l.close:
-		return true, nil
-	case <-l.t.C:
-		return true, nil
+		return nil
+	case <-timer.C():
+		return nil
+	}
+}
+
+// cancel 放弃排队，只有排在最后的请求可以把位置还给桶，中间的位置会空着流出
+func (l *LeakeyBucketLimiter) cancel(prev, last int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.last == last {
+		l.last = prev
 	}
 }
 
-// Close 关闭限流器
-func (l LeakeyBucketLimiter) Close() {
+// Close 关闭限流器，关闭以后排队的和新的请求直接放行，可以重复调用
+func (l *LeakeyBucketLimiter) Close() {
 	l.once.Do(func() {
-		l.t.Stop()
 		close(l.close)
 	})
 }
@@ -4,78 +4,288 @@ import (
 	"context"
 	"github.com/gin-gonic/gin"
 	"github.com/go-playground/assert/v2"
+	"github.com/liquanhui-99/restrictor"
 	"github.com/stretchr/testify/require"
+	"math"
 	"net/http"
 	"testing"
 	"time"
 )
 
-func TestLeakeyBucketLimiter_Allow(t *testing.T) {
+func TestLeakeyBucketLimiter_AllowN(t *testing.T) {
 	testCases := []struct {
 		name     string
-		interval time.Duration
-		after    func(*LeakeyBucketLimiter)
+		capacity int64
+		before   func(*testing.T, *LeakeyBucketLimiter, *restrictor.FakeClock)
+		n        int64
+		// 等待开始以后把时间推进多久
+		advance  time.Duration
 		ctx      func() (context.Context, context.CancelFunc)
 		wantErr  error
 		wantRes  bool
+		wantWait time.Duration
 	}{
-		// 超时
+		// 桶是空的，立刻流出
 		{
-			name:     "Deadline",
-			interval: 5 * time.Millisecond,
-			after: func(limiter *LeakeyBucketLimiter) {
-				limiter.Close()
+			name:     "empty",
+			capacity: 3,
+			before:   func(t *testing.T, limiter *LeakeyBucketLimiter, clock *restrictor.FakeClock) {},
+			n:        1,
+			ctx: func() (context.Context, context.CancelFunc) {
+				return context.WithTimeout(context.Background(), time.Second)
 			},
+			wantRes: true,
+		},
+		// n个单位依次流出，等到最后一个单位
+		{
+			name:     "wait n",
+			capacity: 3,
+			before:   func(t *testing.T, limiter *LeakeyBucketLimiter, clock *restrictor.FakeClock) {},
+			n:        3,
+			advance:  20 * time.Millisecond,
 			ctx: func() (context.Context, context.CancelFunc) {
-				ctx, cancel := context.WithTimeout(context.Background(), 2*time.Millisecond)
-				return ctx, cancel
+				return context.WithTimeout(context.Background(), time.Second)
 			},
-			wantErr: context.DeadlineExceeded,
-			wantRes: false,
+			wantRes:  true,
+			wantWait: 20 * time.Millisecond,
 		},
-		// 成功
+		// 排在前面的请求后面
 		{
-			name:     "success",
-			interval: 2 * time.Millisecond,
-			after: func(limiter *LeakeyBucketLimiter) {
-				limiter.Close()
+			name:     "queue",
+			capacity: 3,
+			before: func(t *testing.T, limiter *LeakeyBucketLimiter, clock *restrictor.FakeClock) {
+				ok, err := limiter.Allow(context.Background())
+				require.NoError(t, err)
+				require.True(t, ok)
 			},
+			n:       2,
+			advance: 20 * time.Millisecond,
 			ctx: func() (context.Context, context.CancelFunc) {
-				ctx, cancel := context.WithTimeout(context.Background(), time.Second)
-				return ctx, cancel
+				return context.WithTimeout(context.Background(), time.Second)
 			},
-			wantErr: nil,
-			wantRes: true,
+			wantRes:  true,
+			wantWait: 20 * time.Millisecond,
+		},
+		// 桶满了直接拒绝
+		{
+			name:     "full",
+			capacity: 3,
+			before: func(t *testing.T, limiter *LeakeyBucketLimiter, clock *restrictor.FakeClock) {
+				ok, err := limiter.Allow(context.Background())
+				require.NoError(t, err)
+				require.True(t, ok)
+			},
+			n: 3,
+			ctx: func() (context.Context, context.CancelFunc) {
+				return context.WithTimeout(context.Background(), time.Second)
+			},
+			wantErr: restrictor.ErrLimitExceeded,
+			wantRes: false,
+		},
+		// 排队的时候超时
+		{
+			name:     "Deadline",
+			capacity: 3,
+			before:   func(t *testing.T, limiter *LeakeyBucketLimiter, clock *restrictor.FakeClock) {},
+			n:        2,
+			ctx: func() (context.Context, context.CancelFunc) {
+				return context.WithTimeout(context.Background(), 10*time.Millisecond)
+			},
+			wantErr: context.DeadlineExceeded,
+			wantRes: false,
 		},
 	}
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			limiter := NewLeakeyBucketLimiter(tc.interval)
-			c, cancel := tc.ctx()
+			clock := restrictor.NewFakeClock(time.Now())
+			limiter := NewLeakeyBucketLimiter(10*time.Millisecond, WithCapacity(tc.capacity), WithClock(clock))
+			defer limiter.Close()
+			tc.before(t, limiter, clock)
+			if tc.advance > 0 {
+				go func() {
+					clock.BlockUntil(1)
+					clock.Advance(tc.advance)
+				}()
+			}
+			ctx, cancel := tc.ctx()
 			defer cancel()
-			res, err := limiter.Allow(c)
-			assert.Equal(t, tc.wantErr, err)
+			start := clock.Now()
+			res, err := limiter.AllowN(ctx, tc.n)
+			require.ErrorIs(t, err, tc.wantErr)
 			assert.Equal(t, tc.wantRes, res)
-			tc.after(limiter)
+			assert.Equal(t, tc.wantWait, clock.Now().Sub(start))
 		})
 	}
 }
 
-func TestLeakeyBucketLimiter_Close(t *testing.T) {
-	limiter := NewLeakeyBucketLimiter(2 * time.Millisecond)
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
-	defer cancel()
-	res, err := limiter.Allow(ctx)
+func TestLeakeyBucketLimiter_Decide(t *testing.T) {
+	clock := restrictor.NewFakeClock(time.Now())
+	limiter := NewLeakeyBucketLimiter(10*time.Millisecond, WithCapacity(2), WithClock(clock))
+	defer limiter.Close()
+	d, err := limiter.Decide(context.Background(), 1)
+	require.NoError(t, err)
+	assert.Equal(t, true, d.Allowed)
+	assert.Equal(t, int64(2), d.Limit)
+	assert.Equal(t, int64(1), d.Remaining)
+	assert.Equal(t, restrictor.LeakeyBucket, d.Limiter)
+
+	// 第二个单位在后台排队
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_, _ = limiter.Decide(context.Background(), 1)
+	}()
+	clock.BlockUntil(1)
+	assert.Equal(t, int64(1), limiter.QueueLen())
+
+	// 桶满了，等到第一个单位流出以后才放得下
+	d, err = limiter.Decide(context.Background(), 2)
+	require.NoError(t, err)
+	assert.Equal(t, false, d.Allowed)
+	assert.Equal(t, int64(0), d.Remaining)
+	assert.Equal(t, 10*time.Millisecond+1, d.RetryAfter)
+
+	// 超过桶的容量，重试也不会通过
+	d, err = limiter.Decide(context.Background(), 3)
 	require.NoError(t, err)
-	require.True(t, res)
+	assert.Equal(t, false, d.Allowed)
+	assert.Equal(t, time.Duration(0), d.RetryAfter)
+
+	clock.Advance(10 * time.Millisecond)
+	<-done
+	assert.Equal(t, int64(0), limiter.QueueLen())
+}
+
+func TestLeakeyBucketLimiter_FIFO(t *testing.T) {
+	clock := restrictor.NewFakeClock(time.Now())
+	limiter := NewLeakeyBucketLimiter(10*time.Millisecond, WithCapacity(5), WithClock(clock))
+	defer limiter.Close()
+	require.NoError(t, limiter.Wait(context.Background()))
+
+	// 三个请求依次排队
+	order := make(chan int, 3)
+	for i := 0; i < 3; i++ {
+		i := i
+		go func() {
+			ok, err := limiter.Allow(context.Background())
+			if err == nil && ok {
+				order <- i
+			}
+		}()
+		clock.BlockUntil(i + 1)
+	}
+	assert.Equal(t, int64(3), limiter.QueueLen())
+
+	// 每个间隔按照排队的顺序流出一个
+	for i := 0; i < 3; i++ {
+		clock.Advance(10 * time.Millisecond)
+		assert.Equal(t, i, <-order)
+	}
+}
+
+func TestLeakeyBucketLimiter_Cancel(t *testing.T) {
+	clock := restrictor.NewFakeClock(time.Now())
+	limiter := NewLeakeyBucketLimiter(10*time.Millisecond, WithCapacity(2), WithClock(clock))
+	defer limiter.Close()
+	require.NoError(t, limiter.Wait(context.Background()))
+
+	// 排在最后的请求放弃排队，位置还给桶
+	ctx, cancel := context.WithCancel(context.Background())
+	errCh := make(chan error)
+	go func() {
+		_, err := limiter.Allow(ctx)
+		errCh <- err
+	}()
+	clock.BlockUntil(1)
+	assert.Equal(t, int64(1), limiter.QueueLen())
+	cancel()
+	require.ErrorIs(t, <-errCh, context.Canceled)
+	assert.Equal(t, int64(0), limiter.QueueLen())
+
+	// 关闭以后排队的请求直接放行
+	resCh := make(chan bool)
+	go func() {
+		ok, _ := limiter.Allow(context.Background())
+		resCh <- ok
+	}()
+	clock.BlockUntil(1)
 	limiter.Close()
 	limiter.Close()
+	assert.Equal(t, true, <-resCh)
+	ok, err := limiter.AllowN(context.Background(), 10)
+	require.NoError(t, err)
+	assert.Equal(t, true, ok)
+}
+
+func TestLeakeyBucketLimiter_WaitN(t *testing.T) {
+	testCases := []struct {
+		name     string
+		capacity int64
+		n        int64
+		timeout  time.Duration
+		// 等待开始以后把时间推进多久
+		advance  time.Duration
+		wantErr  error
+		wantWait time.Duration
+	}{
+		// 桶满了，等到空出位置再排队
+		{
+			name:     "success",
+			capacity: 2,
+			n:        2,
+			timeout:  time.Second,
+			advance:  20 * time.Millisecond,
+			wantWait: 20 * time.Millisecond,
+		},
+		// 超过桶的容量
+		{
+			name:     "over capacity",
+			capacity: 2,
+			n:        3,
+			timeout:  time.Second,
+			wantErr:  restrictor.ErrExceedsCapacity,
+		},
+		// 超时
+		{
+			name:     "Deadline",
+			capacity: 2,
+			n:        2,
+			timeout:  10 * time.Millisecond,
+			wantErr:  context.DeadlineExceeded,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			clock := restrictor.NewFakeClock(time.Now())
+			limiter := NewLeakeyBucketLimiter(10*time.Millisecond, WithCapacity(tc.capacity), WithClock(clock))
+			defer limiter.Close()
+			// 先让桶里有一个单位正在流出
+			require.NoError(t, limiter.Wait(context.Background()))
+			if tc.advance > 0 {
+				go func() {
+					// 等待正在流出的单位流出
+					clock.BlockUntil(1)
+					clock.Advance(1)
+					// 排队的Timer
+					clock.BlockUntil(1)
+					clock.Advance(tc.advance - 1)
+				}()
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), tc.timeout)
+			defer cancel()
+			start := clock.Now()
+			err := limiter.WaitN(ctx, tc.n)
+			require.ErrorIs(t, err, tc.wantErr)
+			assert.Equal(t, tc.wantWait, clock.Now().Sub(start))
+		})
+	}
 }
 
 func ExampleLeakeyBucketLimiter_Allow() {
 	r := gin.Default()
-	var limit = NewLeakeyBucketLimiter(10 * time.Second)
+	var limit = NewLeakeyBucketLimiter(10*time.Second, WithCapacity(100))
 	defer limit.Close()
 	r.Use(func(c *gin.Context) {
 		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
@@ -100,3 +310,61 @@ func ExampleLeakeyBucketLimiter_Allow() {
 	}
 	//output
 }
+
+func TestLeakeyBucketLimiter_SetBurst(t *testing.T) {
+	clock := restrictor.NewFakeClock(time.Now())
+	limiter := NewLeakeyBucketLimiter(100*time.Millisecond, WithCapacity(1), WithClock(clock))
+	require.NoError(t, allowN(limiter, 1))
+	require.ErrorIs(t, allowN(limiter, 1), restrictor.ErrLimitExceeded)
+
+	// 调大容量以后可以继续排队
+	limiter.SetBurst(2)
+	assert.Equal(t, int64(2), limiter.Capacity())
+	errCh := make(chan error)
+	go func() {
+		errCh <- allowN(limiter, 1)
+	}()
+	clock.BlockUntil(1)
+	assert.Equal(t, int64(1), limiter.QueueLen())
+	clock.Advance(100 * time.Millisecond)
+	require.NoError(t, <-errCh)
+
+	// 修改间隔以后新的请求按照新的间隔排队
+	limiter.SetInterval(time.Second)
+	go func() {
+		errCh <- allowN(limiter, 1)
+	}()
+	clock.BlockUntil(1)
+	clock.Advance(999 * time.Millisecond)
+	select {
+	case err := <-errCh:
+		t.Fatalf("unexpected result %v", err)
+	default:
+	}
+	clock.Advance(time.Millisecond)
+	require.NoError(t, <-errCh)
+
+	// 容量至少是1
+	limiter.SetBurst(0)
+	assert.Equal(t, int64(1), limiter.Capacity())
+	require.ErrorIs(t, limiter.WaitN(context.Background(), 2), restrictor.ErrExceedsCapacity)
+}
+
+func TestLeakeyBucketLimiter_Capacity(t *testing.T) {
+	testCases := []struct {
+		name string
+		opts []Option
+		want int64
+	}{
+		{name: "默认不限制容量", want: math.MaxInt64},
+		{name: "设置容量", opts: []Option{WithCapacity(5)}, want: 5},
+		{name: "容量至少是1", opts: []Option{WithCapacity(0)}, want: 1},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			limiter := NewLeakeyBucketLimiter(time.Second, tc.opts...)
+			defer limiter.Close()
+			assert.Equal(t, tc.want, limiter.Capacity())
+		})
+	}
+}
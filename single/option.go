@@ -0,0 +1,42 @@
+package single
+
+import "github.com/liquanhui-99/restrictor"
+
+// Option 单体限流器的配置项，所有单体限流器的构造函数都可以传入
+type Option func(*options)
+
+type options struct {
+	// clock 获取时间和创建定时器的时钟
+	clock restrictor.Clock
+	// capacity 漏桶的容量，0表示不限制
+	capacity int64
+}
+
+// WithClock 替换限流器使用的时钟，默认是restrictor.RealClock，测试时可以传入restrictor.FakeClock
+func WithClock(clock restrictor.Clock) Option {
+	return func(o *options) {
+		o.clock = clock
+	}
+}
+
+// WithCapacity 设置漏桶的容量，最多有多少个单位在桶中排队，桶满了以后新的请求直接拒绝，至少是1，
+// 只对LeakeyBucketLimiter生效，默认不限制容量，所有请求都排队等待
+func WithCapacity(capacity int64) Option {
+	return func(o *options) {
+		o.capacity = capacity
+		if o.capacity < 1 {
+			o.capacity = 1
+		}
+	}
+}
+
+// newOptions 在默认配置的基础上应用opts
+func newOptions(opts []Option) options {
+	o := options{
+		clock: restrictor.RealClock,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
@@ -0,0 +1,69 @@
+package single
+
+import (
+	"github.com/liquanhui-99/restrictor"
+	"math"
+	"sync"
+	"time"
+)
+
+// InfDuration 预定失败时Delay返回的时长，表示永远等不到
+const InfDuration = time.Duration(math.MaxInt64)
+
+// Reservation 限流器预定出去的令牌，调用方可以根据Delay决定是等待还是放弃，
+// 放弃时需要调用Cancel把令牌归还给限流器
+type Reservation struct {
+	// ok 是否预定成功，请求的令牌数量超过限流器的容量时预定失败
+	ok bool
+	// timeToAct 预定的令牌可以使用的时间
+	timeToAct time.Time
+	// cancel 归还令牌的逻辑，由限流器提供
+	cancel func(now time.Time)
+	// once 控制只能归还一次
+	once sync.Once
+	// clock 限流器使用的时钟
+	clock restrictor.Clock
+}
+
+// OK 是否预定成功
+func (r *Reservation) OK() bool {
+	return r.ok
+}
+
+// Delay 还需要等待多久才能使用预定的令牌，预定失败返回InfDuration
+func (r *Reservation) Delay() time.Duration {
+	if !r.ok {
+		return InfDuration
+	}
+	return r.DelayFrom(r.clock.Now())
+}
+
+// DelayFrom 从now开始算还需要等待多久才能使用预定的令牌，预定失败返回InfDuration
+func (r *Reservation) DelayFrom(now time.Time) time.Duration {
+	if !r.ok {
+		return InfDuration
+	}
+	delay := r.timeToAct.Sub(now)
+	if delay < 0 {
+		return 0
+	}
+	return delay
+}
+
+// Cancel 放弃预定，尽量把令牌归还给限流器
+func (r *Reservation) Cancel() {
+	if !r.ok {
+		return
+	}
+	r.CancelAt(r.clock.Now())
+}
+
+// CancelAt 在now这个时间放弃预定，now不早于可以使用预定的时间时调用方可能已经用掉了令牌，不会归还
+func (r *Reservation) CancelAt(now time.Time) {
+	if !r.ok || r.cancel == nil {
+		return
+	}
+	r.once.Do(func() {
+		r.cancel(now)
+	})
+}
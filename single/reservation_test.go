@@ -0,0 +1,123 @@
+package single
+
+import (
+	"github.com/go-playground/assert/v2"
+	"github.com/liquanhui-99/restrictor"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestTokenBucketLimiter_ReserveN(t *testing.T) {
+	testCases := []struct {
+		name     string
+		capacity int64
+		interval time.Duration
+		before   func(*TokenBucketLimiter, *restrictor.FakeClock)
+		n        int64
+		wantOK   bool
+		// 期望的等待时长范围
+		wantMin time.Duration
+		wantMax time.Duration
+	}{
+		// 桶里的令牌足够，不需要等待
+		{
+			name:     "enough",
+			capacity: 5,
+			interval: time.Millisecond,
+			before: func(limiter *TokenBucketLimiter, clock *restrictor.FakeClock) {
+				fillTokens(t, clock, limiter, 5)
+			},
+			n:       5,
+			wantOK:  true,
+			wantMin: 0,
+			wantMax: 0,
+		},
+		// 预定未来的令牌
+		{
+			name:     "future",
+			capacity: 5,
+			interval: time.Hour,
+			before:   func(limiter *TokenBucketLimiter, clock *restrictor.FakeClock) {},
+			n:        3,
+			wantOK:   true,
+			wantMin:  3 * time.Hour,
+			wantMax:  3 * time.Hour,
+		},
+		// 排在前一个预定的后面
+		{
+			name:     "queue",
+			capacity: 5,
+			interval: time.Hour,
+			before: func(limiter *TokenBucketLimiter, clock *restrictor.FakeClock) {
+				require.True(t, limiter.ReserveN(2).OK())
+			},
+			n:       1,
+			wantOK:  true,
+			wantMin: 3 * time.Hour,
+			wantMax: 3 * time.Hour,
+		},
+		// 超过令牌桶的容量
+		{
+			name:     "over capacity",
+			capacity: 5,
+			interval: time.Millisecond,
+			before:   func(limiter *TokenBucketLimiter, clock *restrictor.FakeClock) {},
+			n:        6,
+			wantOK:   false,
+			wantMin:  InfDuration,
+			wantMax:  InfDuration,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			clock := restrictor.NewFakeClock(time.Now())
+			limiter := NewTokenBucketLimiter(tc.capacity, tc.interval, WithClock(clock))
+			defer limiter.Close()
+			tc.before(limiter, clock)
+			r := limiter.ReserveN(tc.n)
+			assert.Equal(t, tc.wantOK, r.OK())
+			delay := r.Delay()
+			require.GreaterOrEqual(t, delay, tc.wantMin)
+			require.LessOrEqual(t, delay, tc.wantMax)
+		})
+	}
+}
+
+func TestReservation_Cancel(t *testing.T) {
+	// 归还还没有发送的令牌，后面的预定不需要再排队
+	clock := restrictor.NewFakeClock(time.Now())
+	limiter := NewTokenBucketLimiter(5, time.Hour, WithClock(clock))
+	r := limiter.ReserveN(2)
+	require.True(t, r.OK())
+	r.Cancel()
+	r.Cancel()
+	assert.Equal(t, int64(0), limiter.debt)
+	assert.Equal(t, time.Hour, limiter.Reserve().Delay())
+	limiter.Close()
+
+	// 在可以使用之前放弃，归还已经拿到的令牌和还没有发送的令牌
+	clock = restrictor.NewFakeClock(time.Now())
+	limiter = NewTokenBucketLimiter(3, time.Hour, WithClock(clock))
+	limiter.tokens() <- struct{}{}
+	r = limiter.ReserveN(2)
+	require.True(t, r.OK())
+	r.Cancel()
+	assert.Equal(t, int64(0), limiter.debt)
+	assert.Equal(t, 1, len(limiter.tokens()))
+	limiter.Close()
+
+	// 已经可以使用的预定不归还
+	clock = restrictor.NewFakeClock(time.Now())
+	limiter = NewTokenBucketLimiter(3, time.Hour, WithClock(clock))
+	defer limiter.Close()
+	for i := 0; i < 3; i++ {
+		limiter.tokens() <- struct{}{}
+	}
+	r = limiter.ReserveN(3)
+	require.True(t, r.OK())
+	assert.Equal(t, time.Duration(0), r.Delay())
+	r.Cancel()
+	assert.Equal(t, 0, len(limiter.tokens()))
+}
@@ -0,0 +1,22 @@
+package single
+
+import (
+	"context"
+	"github.com/liquanhui-99/restrictor"
+	"time"
+)
+
+// sleep 按照clock阻塞d的时长，ctx提前结束时返回ctx的错误
+func sleep(ctx context.Context, clock restrictor.Clock, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := clock.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C():
+		return nil
+	}
+}
@@ -3,7 +3,7 @@ package single
 import (
 	"container/list"
 	"context"
-	"errors"
+	"github.com/liquanhui-99/restrictor"
 	"sync"
 	"time"
 )
@@ -16,28 +16,82 @@ type SlideWindowLimiter struct {
 	queue *list.List
 	// 窗口内允许的最大请求树
 	maxCount int64
-	// 加锁保护queue
+	// 加锁保护queue、interval和maxCount
 	mu sync.Mutex
+	// clock 获取时间的时钟
+	clock restrictor.Clock
 }
 
 // NewSlideWindowLimiter 初始化滑动窗口限流器，interval标识窗口的大小
 // maxCount窗口内的最大请求数量
-func NewSlideWindowLimiter(interval time.Duration, maxCount int64) *SlideWindowLimiter {
+func NewSlideWindowLimiter(interval time.Duration, maxCount int64, opts ...Option) *SlideWindowLimiter {
+	o := newOptions(opts)
 	return &SlideWindowLimiter{
 		interval: int64(interval),
 		queue:    list.New(),
 		maxCount: maxCount,
+		clock:    o.clock,
 	}
 }
 
+// Allow 是否允许通过限流器继续请求
 func (s *SlideWindowLimiter) Allow(ctx context.Context) (bool, error) {
-	now := time.Now().UnixNano()
-	// 快路径，只要队列的长度小于最大的限流数就可以直接通过
+	return s.AllowN(ctx, 1)
+}
+
+// AllowN 是否允许n个单位的请求通过限流器，窗口内剩余的数量不够n时一个都不消耗
+func (s *SlideWindowLimiter) AllowN(ctx context.Context, n int64) (bool, error) {
+	d, err := s.Decide(ctx, n)
+	if err != nil {
+		return false, err
+	}
+	if !d.Allowed {
+		return false, restrictor.NewLimitError(d)
+	}
+	return true, nil
+}
+
+// Decide 判定窗口内是否允许通过n个请求，被拒绝时RetryAfter是让出足够位置的那个请求滑出窗口的时间
+func (s *SlideWindowLimiter) Decide(ctx context.Context, n int64) (restrictor.Decision, error) {
+	if err := restrictor.CheckCount(n); err != nil {
+		return restrictor.Decision{}, err
+	}
+	return s.allowN(s.clock.Now().UnixNano(), n), nil
+}
+
+// Wait 阻塞直到窗口内允许通过一个请求
+func (s *SlideWindowLimiter) Wait(ctx context.Context) error {
+	return s.WaitN(ctx, 1)
+}
+
+// WaitN 阻塞直到窗口内允许通过n个请求，等待的时长是让出足够位置的那个请求滑出窗口的时间，
+// n超过窗口内允许的最大请求数量时直接返回error
+func (s *SlideWindowLimiter) WaitN(ctx context.Context, n int64) error {
+	if err := restrictor.CheckCount(n); err != nil {
+		return err
+	}
+	for {
+		d := s.allowN(s.clock.Now().UnixNano(), n)
+		if d.Allowed {
+			return nil
+		}
+		if n > d.Limit {
+			return restrictor.ErrExceedsCapacity
+		}
+		if err := sleep(ctx, s.clock, d.RetryAfter); err != nil {
+			return err
+		}
+	}
+}
+
+// allowN 尝试在now时刻通过n个请求，不通过时RetryAfter是还需要等待的时长
+func (s *SlideWindowLimiter) allowN(now int64, n int64) restrictor.Decision {
 	s.mu.Lock()
-	if int64(s.queue.Len()) < s.maxCount {
-		_ = s.queue.PushBack(now)
-		s.mu.Unlock()
-		return true, nil
+	defer s.mu.Unlock()
+	// 快路径，只要队列的长度加上n不超过最大的限流数就可以直接通过
+	if int64(s.queue.Len())+n <= s.maxCount {
+		s.pushN(now, n)
+		return s.decision(now, true, 0)
 	}
 
 	// 慢路径，队列满了，必须先清理出超过窗口时间的请求，再取判断是否超过
@@ -51,15 +105,81 @@ func (s *SlideWindowLimiter) Allow(ctx context.Context) (bool, error) {
 		first = s.queue.Front()
 	}
 
-	if int64(s.queue.Len()) >= s.maxCount {
-		s.mu.Unlock()
-		return false, errors.New("达到了性能瓶颈")
+	overflow := int64(s.queue.Len()) + n - s.maxCount
+	if overflow <= 0 {
+		s.pushN(now, n)
+		return s.decision(now, true, 0)
+	}
+	if n > s.maxCount {
+		return s.decision(now, false, 0)
 	}
 
-	_ = s.queue.PushBack(now)
-	s.mu.Unlock()
+	// 需要等到队头的第overflow个请求滑出窗口才能放下n个请求
+	e := s.queue.Front()
+	for i := int64(1); i < overflow; i++ {
+		e = e.Next()
+	}
+	return s.decision(now, false, time.Duration(e.Value.(int64)-boundary+1))
+}
 
-	return true, nil
+// decision 根据队列当前的状态生成判定结果，调用方需要持有锁
+func (s *SlideWindowLimiter) decision(now int64, allowed bool, retryAfter time.Duration) restrictor.Decision {
+	d := restrictor.Decision{
+		Allowed:    allowed,
+		Limit:      s.maxCount,
+		Remaining:  s.maxCount - int64(s.queue.Len()),
+		RetryAfter: retryAfter,
+		Limiter:    restrictor.SlideWindow,
+	}
+	if d.Remaining < 0 {
+		d.Remaining = 0
+	}
+	// 队尾的请求滑出窗口以后数量完全恢复
+	d.ResetAt = time.Unix(0, now)
+	if last := s.queue.Back(); last != nil {
+		d.ResetAt = time.Unix(0, last.Value.(int64)+s.interval+1)
+	}
+	return d
+}
+
+// pushN 记录n个时间戳为now的请求
+func (s *SlideWindowLimiter) pushN(now int64, n int64) {
+	for i := int64(0); i < n; i++ {
+		_ = s.queue.PushBack(now)
+	}
+}
+
+// RefundN 从窗口中删除at以后最近记录的n个请求，at时记录的请求可能已经滑出窗口时直接忽略
+func (s *SlideWindowLimiter) RefundN(n int64, at time.Time) {
+	ts := at.UnixNano()
+	now := s.clock.Now().UnixNano()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if ts < now-s.interval {
+		return
+	}
+	for i := int64(0); i < n && s.queue.Len() > 0; i++ {
+		back := s.queue.Back()
+		if back.Value.(int64) < ts {
+			return
+		}
+		_ = s.queue.Remove(back)
+	}
+}
+
+// SetLimit 修改窗口内允许通过的最大请求数量，窗口内已经记录的请求保留，可以和Allow并发调用
+func (s *SlideWindowLimiter) SetLimit(maxCount int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.maxCount = maxCount
+}
+
+// SetInterval 修改窗口的大小，窗口内已经记录的请求保留，按照新的窗口大小判断是否滑出窗口，
+// 可以和Allow并发调用
+func (s *SlideWindowLimiter) SetInterval(interval time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.interval = int64(interval)
 }
 
 func (s *SlideWindowLimiter) Close() {}
@@ -0,0 +1,172 @@
+package single
+
+import (
+	"context"
+	"github.com/liquanhui-99/restrictor"
+	"math"
+	"sync"
+	"time"
+)
+
+// SlideWindowCounterLimiter 滑动窗口计数器限流器，只保存上一个窗口和当前窗口的请求数量，
+// 按照上一个窗口和滑动窗口重叠的比例估算滑动窗口内的请求数量，占用O(1)的内存
+type SlideWindowCounterLimiter struct {
+	mu sync.Mutex
+	// interval 窗口的大小
+	interval int64
+	// maxCount 滑动窗口内允许通过的最大请求数量
+	maxCount int64
+	// start 当前窗口的起始时间，按照interval对齐
+	start int64
+	// prev 上一个窗口通过的请求数量
+	prev int64
+	// curr 当前窗口通过的请求数量
+	curr int64
+	// clock 获取时间的时钟
+	clock restrictor.Clock
+}
+
+// NewSlideWindowCounterLimiter 初始化滑动窗口计数器限流器，interval是窗口的大小，
+// maxCount是滑动窗口内允许通过的最大请求数量
+func NewSlideWindowCounterLimiter(interval time.Duration, maxCount int64, opts ...Option) *SlideWindowCounterLimiter {
+	o := newOptions(opts)
+	return &SlideWindowCounterLimiter{
+		interval: int64(interval),
+		maxCount: maxCount,
+		clock:    o.clock,
+	}
+}
+
+// Allow 是否允许通过限流器继续请求
+func (s *SlideWindowCounterLimiter) Allow(ctx context.Context) (bool, error) {
+	return s.AllowN(ctx, 1)
+}
+
+// AllowN 是否允许n个单位的请求通过限流器，滑动窗口内剩余的数量不够n时一个都不消耗
+func (s *SlideWindowCounterLimiter) AllowN(ctx context.Context, n int64) (bool, error) {
+	d, err := s.Decide(ctx, n)
+	if err != nil {
+		return false, err
+	}
+	if !d.Allowed {
+		return false, restrictor.NewLimitError(d)
+	}
+	return true, nil
+}
+
+// Decide 判定滑动窗口内是否允许通过n个请求，被拒绝时RetryAfter是估算的请求数量降到允许n个请求的时间
+func (s *SlideWindowCounterLimiter) Decide(ctx context.Context, n int64) (restrictor.Decision, error) {
+	if err := restrictor.CheckCount(n); err != nil {
+		return restrictor.Decision{}, err
+	}
+	if err := ctx.Err(); err != nil {
+		return restrictor.Decision{}, err
+	}
+	now := s.clock.Now().UnixNano()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rotate(now)
+	estimate := s.estimate(now)
+	allowed := estimate+float64(n) <= float64(s.maxCount)
+	if allowed {
+		s.curr += n
+		estimate += float64(n)
+	}
+
+	d := restrictor.Decision{
+		Allowed:   allowed,
+		Limit:     s.maxCount,
+		Remaining: int64(math.Max(math.Floor(float64(s.maxCount)-estimate), 0)),
+		ResetAt:   time.Unix(0, s.resetAt(now)),
+		Limiter:   restrictor.SlideWindowCounter,
+	}
+	if !allowed && n <= s.maxCount {
+		d.RetryAfter = s.retryAfter(now, n)
+	}
+	return d, nil
+}
+
+// rotate 根据now切换到对应的窗口，now所在的窗口紧跟着当前窗口时，当前窗口变成上一个窗口
+func (s *SlideWindowCounterLimiter) rotate(now int64) {
+	start := now - now%s.interval
+	switch {
+	case start <= s.start:
+		return
+	case start == s.start+s.interval:
+		s.prev, s.curr = s.curr, 0
+	default:
+		// 中间间隔了完整的窗口，之前的请求都不在滑动窗口内了
+		s.prev, s.curr = 0, 0
+	}
+	s.start = start
+}
+
+// estimate 估算以now为终点的滑动窗口内的请求数量
+func (s *SlideWindowCounterLimiter) estimate(now int64) float64 {
+	overlap := float64(s.interval-(now-s.start)) / float64(s.interval)
+	return float64(s.prev)*overlap + float64(s.curr)
+}
+
+// retryAfter 估算的请求数量降到允许n个请求需要等待的时间
+func (s *SlideWindowCounterLimiter) retryAfter(now int64, n int64) time.Duration {
+	elapsed := now - s.start
+	free := float64(s.maxCount - s.curr - n)
+	if free >= 0 {
+		// 当前窗口内上一个窗口的请求滑出去就够了
+		need := float64(s.interval) - free*float64(s.interval)/float64(s.prev)
+		return time.Duration(math.Ceil(need)) - time.Duration(elapsed)
+	}
+	// 需要等到下一个窗口，当前窗口的请求滑出去一部分
+	need := float64(s.interval) * (1 - float64(s.maxCount-n)/float64(s.curr))
+	return time.Duration(s.interval-elapsed) + time.Duration(math.Ceil(need))
+}
+
+// resetAt 滑动窗口内的请求全部滑出去的时间
+func (s *SlideWindowCounterLimiter) resetAt(now int64) int64 {
+	switch {
+	case s.curr > 0:
+		return s.start + 2*s.interval
+	case s.prev > 0:
+		return s.start + s.interval
+	default:
+		return now
+	}
+}
+
+// RefundN 把at时消耗的n个单位归还给当前窗口，当前窗口的请求数量不会小于0，
+// at不在当前窗口内时直接忽略
+func (s *SlideWindowCounterLimiter) RefundN(n int64, at time.Time) {
+	now := s.clock.Now().UnixNano()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rotate(now)
+	if ts := at.UnixNano(); ts-ts%s.interval != s.start {
+		return
+	}
+	if n > s.curr {
+		n = s.curr
+	}
+	s.curr -= n
+}
+
+// SetLimit 修改滑动窗口内允许通过的最大请求数量，已经记录的请求数量保留，可以和Allow并发调用
+func (s *SlideWindowCounterLimiter) SetLimit(maxCount int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.maxCount = maxCount
+}
+
+// SetInterval 修改窗口的大小，可以和Allow并发调用。当前窗口按照新的大小重新对齐，
+// 上一个窗口和当前窗口的请求数量保留
+func (s *SlideWindowCounterLimiter) SetInterval(interval time.Duration) {
+	now := s.clock.Now().UnixNano()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rotate(now)
+	s.interval = int64(interval)
+	s.start = now - now%s.interval
+}
+
+// Close 滑动窗口计数器没有需要释放的资源
+func (s *SlideWindowCounterLimiter) Close() {}
@@ -0,0 +1,142 @@
+package single
+
+import (
+	"context"
+	"github.com/go-playground/assert/v2"
+	"github.com/liquanhui-99/restrictor"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestSlideWindowCounterLimiter_AllowN(t *testing.T) {
+	testCases := []struct {
+		name    string
+		before  func(*testing.T, *SlideWindowCounterLimiter, *restrictor.FakeClock)
+		n       int64
+		wantErr error
+		wantRes bool
+	}{
+		// 窗口内还有余量
+		{
+			name:    "success",
+			before:  func(t *testing.T, limiter *SlideWindowCounterLimiter, clock *restrictor.FakeClock) {},
+			n:       10,
+			wantRes: true,
+		},
+		// 超过窗口内的最大数量
+		{
+			name:    "over max count",
+			before:  func(t *testing.T, limiter *SlideWindowCounterLimiter, clock *restrictor.FakeClock) {},
+			n:       11,
+			wantErr: restrictor.ErrLimitExceeded,
+			wantRes: false,
+		},
+		// 上一个窗口的请求还有一半在滑动窗口内
+		{
+			name: "overlap",
+			before: func(t *testing.T, limiter *SlideWindowCounterLimiter, clock *restrictor.FakeClock) {
+				require.NoError(t, allowN(limiter, 10))
+				clock.Advance(1500 * time.Millisecond)
+			},
+			n:       6,
+			wantErr: restrictor.ErrLimitExceeded,
+			wantRes: false,
+		},
+		// 上一个窗口的请求滑出去一半以后腾出来的余量
+		{
+			name: "overlap success",
+			before: func(t *testing.T, limiter *SlideWindowCounterLimiter, clock *restrictor.FakeClock) {
+				require.NoError(t, allowN(limiter, 10))
+				clock.Advance(1500 * time.Millisecond)
+			},
+			n:       5,
+			wantRes: true,
+		},
+		// 中间间隔了完整的窗口
+		{
+			name: "expired",
+			before: func(t *testing.T, limiter *SlideWindowCounterLimiter, clock *restrictor.FakeClock) {
+				require.NoError(t, allowN(limiter, 10))
+				clock.Advance(2 * time.Second)
+			},
+			n:       10,
+			wantRes: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			clock := restrictor.NewFakeClock(time.Unix(1000, 0))
+			limiter := NewSlideWindowCounterLimiter(time.Second, 10, WithClock(clock))
+			defer limiter.Close()
+			tc.before(t, limiter, clock)
+			res, err := limiter.AllowN(context.Background(), tc.n)
+			require.ErrorIs(t, err, tc.wantErr)
+			assert.Equal(t, tc.wantRes, res)
+		})
+	}
+}
+
+func TestSlideWindowCounterLimiter_Decide(t *testing.T) {
+	clock := restrictor.NewFakeClock(time.Unix(1000, 0))
+	limiter := NewSlideWindowCounterLimiter(time.Second, 10, WithClock(clock))
+	d, err := limiter.Decide(context.Background(), 8)
+	require.NoError(t, err)
+	assert.Equal(t, true, d.Allowed)
+	assert.Equal(t, int64(10), d.Limit)
+	assert.Equal(t, int64(2), d.Remaining)
+	assert.Equal(t, restrictor.SlideWindowCounter, d.Limiter)
+	assert.Equal(t, clock.Now().Add(2*time.Second).UnixNano(), d.ResetAt.UnixNano())
+
+	// 上一个窗口的8个请求有一半在滑动窗口内
+	clock.Advance(1500 * time.Millisecond)
+	d, err = limiter.Decide(context.Background(), 6)
+	require.NoError(t, err)
+	assert.Equal(t, true, d.Allowed)
+	assert.Equal(t, int64(0), d.Remaining)
+
+	// 上一个窗口的请求再滑出去2个就够了，需要等250毫秒
+	d, err = limiter.Decide(context.Background(), 2)
+	require.NoError(t, err)
+	assert.Equal(t, false, d.Allowed)
+	assert.Equal(t, 250*time.Millisecond, d.RetryAfter)
+	assert.Equal(t, clock.Now().Add(1500*time.Millisecond).UnixNano(), d.ResetAt.UnixNano())
+
+	// 需要等到下一个窗口，当前窗口的6个请求滑出去1个
+	d, err = limiter.Decide(context.Background(), 5)
+	require.NoError(t, err)
+	assert.Equal(t, false, d.Allowed)
+	assert.Equal(t, 500*time.Millisecond+time.Second/6+1, d.RetryAfter)
+
+	// 超过窗口内的最大数量，重试也不会通过
+	d, err = limiter.Decide(context.Background(), 11)
+	require.NoError(t, err)
+	assert.Equal(t, false, d.Allowed)
+	assert.Equal(t, time.Duration(0), d.RetryAfter)
+}
+
+// allowN 在before中消耗n个单位
+func allowN(limiter Limiter, n int64) error {
+	_, err := limiter.AllowN(context.Background(), n)
+	return err
+}
+
+func TestSlideWindowCounterLimiter_SetLimit(t *testing.T) {
+	clock := restrictor.NewFakeClock(time.Unix(0, 0))
+	limiter := NewSlideWindowCounterLimiter(time.Minute, 2, WithClock(clock))
+	require.NoError(t, allowN(limiter, 2))
+	require.ErrorIs(t, allowN(limiter, 1), restrictor.ErrLimitExceeded)
+
+	// 调大以后当前窗口的请求数量保留
+	limiter.SetLimit(3)
+	require.NoError(t, allowN(limiter, 1))
+	require.ErrorIs(t, allowN(limiter, 1), restrictor.ErrLimitExceeded)
+
+	// 调小窗口以后重新对齐，之前的请求数量保留在当前窗口
+	limiter.SetInterval(time.Second)
+	require.ErrorIs(t, allowN(limiter, 1), restrictor.ErrLimitExceeded)
+	// 两个窗口以后之前的请求都滑出去了
+	clock.Advance(2 * time.Second)
+	require.NoError(t, allowN(limiter, 3))
+}
@@ -2,9 +2,9 @@ package single
 
 import (
 	"context"
-	"errors"
 	"github.com/gin-gonic/gin"
 	"github.com/go-playground/assert/v2"
+	"github.com/liquanhui-99/restrictor"
 	"github.com/stretchr/testify/require"
 	"net/http"
 	"testing"
@@ -16,7 +16,7 @@ func TestSideWindow_Allow(t *testing.T) {
 		name     string
 		interval time.Duration
 		maxCount int64
-		before   func(*testing.T, *SlideWindowLimiter)
+		before   func(*testing.T, *SlideWindowLimiter, *restrictor.FakeClock)
 		wantErr  error
 		wantRes  bool
 	}{
@@ -25,7 +25,7 @@ func TestSideWindow_Allow(t *testing.T) {
 			name:     "fast path",
 			interval: time.Second,
 			maxCount: 10,
-			before:   func(t *testing.T, limiter *SlideWindowLimiter) {},
+			before:   func(t *testing.T, limiter *SlideWindowLimiter, clock *restrictor.FakeClock) {},
 			wantErr:  nil,
 			wantRes:  true,
 		},
@@ -35,7 +35,7 @@ func TestSideWindow_Allow(t *testing.T) {
 			name:     "delete front",
 			interval: time.Second,
 			maxCount: 10,
-			before: func(t *testing.T, limiter *SlideWindowLimiter) {
+			before: func(t *testing.T, limiter *SlideWindowLimiter, clock *restrictor.FakeClock) {
 				ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(time.Second))
 				defer cancel()
 				for i := 0; i < 9; i++ {
@@ -52,11 +52,11 @@ func TestSideWindow_Allow(t *testing.T) {
 			name:     "slow front",
 			interval: 100 * time.Millisecond,
 			maxCount: 10,
-			before: func(t *testing.T, limiter *SlideWindowLimiter) {
+			before: func(t *testing.T, limiter *SlideWindowLimiter, clock *restrictor.FakeClock) {
 				ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(time.Second))
 				defer cancel()
 				for i := 0; i < 10; i++ {
-					time.Sleep(100 * time.Millisecond)
+					clock.Advance(100 * time.Millisecond)
 					res, err := limiter.Allow(ctx)
 					require.NoError(t, err)
 					require.True(t, res)
@@ -70,7 +70,7 @@ func TestSideWindow_Allow(t *testing.T) {
 			name:     "slow front",
 			interval: 100 * time.Millisecond,
 			maxCount: 10,
-			before: func(t *testing.T, limiter *SlideWindowLimiter) {
+			before: func(t *testing.T, limiter *SlideWindowLimiter, clock *restrictor.FakeClock) {
 				ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(time.Second))
 				defer cancel()
 				for i := 0; i < 10; i++ {
@@ -79,24 +79,183 @@ func TestSideWindow_Allow(t *testing.T) {
 					require.True(t, res)
 				}
 			},
-			wantErr: errors.New("达到了性能瓶颈"),
+			wantErr: restrictor.ErrLimitExceeded,
 			wantRes: false,
 		},
 	}
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			limiter := NewSlideWindowLimiter(tc.interval, tc.maxCount)
+			clock := restrictor.NewFakeClock(time.Now())
+			limiter := NewSlideWindowLimiter(tc.interval, tc.maxCount, WithClock(clock))
 			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
 			defer cancel()
-			tc.before(t, limiter)
+			tc.before(t, limiter, clock)
 			res, err := limiter.Allow(ctx)
-			assert.Equal(t, err, tc.wantErr)
+			require.ErrorIs(t, err, tc.wantErr)
 			assert.Equal(t, res, tc.wantRes)
 		})
 	}
 }
 
+func TestSlideWindowLimiter_AllowN(t *testing.T) {
+	testCases := []struct {
+		name     string
+		maxCount int64
+		before   func(*testing.T, *SlideWindowLimiter, *restrictor.FakeClock)
+		n        int64
+		wantErr  error
+		wantRes  bool
+		// 执行完以后窗口内的请求数量
+		wantLen int
+	}{
+		// 全部消耗
+		{
+			name:     "success",
+			maxCount: 10,
+			before:   func(t *testing.T, limiter *SlideWindowLimiter, clock *restrictor.FakeClock) {},
+			n:        10,
+			wantRes:  true,
+			wantLen:  10,
+		},
+		// 剩余数量不够，一个都不消耗
+		{
+			name:     "not enough",
+			maxCount: 10,
+			before: func(t *testing.T, limiter *SlideWindowLimiter, clock *restrictor.FakeClock) {
+				res, err := limiter.AllowN(context.Background(), 6)
+				require.NoError(t, err)
+				require.True(t, res)
+			},
+			n:       5,
+			wantErr: restrictor.ErrLimitExceeded,
+			wantRes: false,
+			wantLen: 6,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			clock := restrictor.NewFakeClock(time.Now())
+			limiter := NewSlideWindowLimiter(time.Minute, tc.maxCount, WithClock(clock))
+			tc.before(t, limiter, clock)
+			res, err := limiter.AllowN(context.Background(), tc.n)
+			require.ErrorIs(t, err, tc.wantErr)
+			assert.Equal(t, tc.wantRes, res)
+			assert.Equal(t, tc.wantLen, limiter.queue.Len())
+		})
+	}
+}
+
+func TestSlideWindowLimiter_Decide(t *testing.T) {
+	clock := restrictor.NewFakeClock(time.Now())
+	limiter := NewSlideWindowLimiter(time.Minute, 10, WithClock(clock))
+	d, err := limiter.Decide(context.Background(), 6)
+	require.NoError(t, err)
+	assert.Equal(t, true, d.Allowed)
+	assert.Equal(t, int64(10), d.Limit)
+	assert.Equal(t, int64(4), d.Remaining)
+	assert.Equal(t, time.Duration(0), d.RetryAfter)
+	assert.Equal(t, restrictor.SlideWindow, d.Limiter)
+
+	// 剩余的数量不够，等到最早的请求滑出窗口
+	start := clock.Now()
+	clock.Advance(10 * time.Second)
+	require.NoError(t, limiter.WaitN(context.Background(), 2))
+	d, err = limiter.Decide(context.Background(), 5)
+	require.NoError(t, err)
+	assert.Equal(t, false, d.Allowed)
+	assert.Equal(t, int64(2), d.Remaining)
+	assert.Equal(t, 50*time.Second+1, d.RetryAfter)
+	assert.Equal(t, start.Add(70*time.Second+1).UnixNano(), d.ResetAt.UnixNano())
+
+	// 超过窗口的最大数量，重试也不会通过
+	d, err = limiter.Decide(context.Background(), 11)
+	require.NoError(t, err)
+	assert.Equal(t, false, d.Allowed)
+	assert.Equal(t, time.Duration(0), d.RetryAfter)
+}
+
+func TestSlideWindowLimiter_WaitN(t *testing.T) {
+	testCases := []struct {
+		name     string
+		interval time.Duration
+		maxCount int64
+		before   func(*testing.T, *SlideWindowLimiter, *restrictor.FakeClock)
+		n        int64
+		timeout  time.Duration
+		// 等待开始以后把时间推进多久
+		advance  time.Duration
+		wantErr  error
+		wantWait time.Duration
+	}{
+		// 窗口内还有余量，直接通过
+		{
+			name:     "no wait",
+			interval: time.Minute,
+			maxCount: 10,
+			before:   func(t *testing.T, limiter *SlideWindowLimiter, clock *restrictor.FakeClock) {},
+			n:        10,
+			timeout:  time.Second,
+		},
+		// 等待最早的请求滑出窗口
+		{
+			name:     "slide",
+			interval: 50 * time.Millisecond,
+			maxCount: 10,
+			before: func(t *testing.T, limiter *SlideWindowLimiter, clock *restrictor.FakeClock) {
+				require.NoError(t, limiter.WaitN(context.Background(), 10))
+			},
+			n:        3,
+			timeout:  time.Second,
+			advance:  50*time.Millisecond + 1,
+			wantWait: 50*time.Millisecond + 1,
+		},
+		// 请求滑出窗口之前超时
+		{
+			name:     "Deadline",
+			interval: time.Minute,
+			maxCount: 10,
+			before: func(t *testing.T, limiter *SlideWindowLimiter, clock *restrictor.FakeClock) {
+				require.NoError(t, limiter.WaitN(context.Background(), 10))
+			},
+			n:       1,
+			timeout: 10 * time.Millisecond,
+			wantErr: context.DeadlineExceeded,
+		},
+		// 超过窗口内的最大请求数量
+		{
+			name:     "over max count",
+			interval: time.Minute,
+			maxCount: 10,
+			before:   func(t *testing.T, limiter *SlideWindowLimiter, clock *restrictor.FakeClock) {},
+			n:        11,
+			timeout:  time.Second,
+			wantErr:  restrictor.ErrExceedsCapacity,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			clock := restrictor.NewFakeClock(time.Now())
+			limiter := NewSlideWindowLimiter(tc.interval, tc.maxCount, WithClock(clock))
+			tc.before(t, limiter, clock)
+			ctx, cancel := context.WithTimeout(context.Background(), tc.timeout)
+			defer cancel()
+			if tc.advance > 0 {
+				go func() {
+					clock.BlockUntil(1)
+					clock.Advance(tc.advance)
+				}()
+			}
+			start := clock.Now()
+			err := limiter.WaitN(ctx, tc.n)
+			require.ErrorIs(t, err, tc.wantErr)
+			assert.Equal(t, tc.wantWait, clock.Now().Sub(start))
+		})
+	}
+}
+
 func ExampleSlideWindowLimiter_Allow() {
 	r := gin.Default()
 	var limit = NewSlideWindowLimiter(10*time.Second, 10)
@@ -123,3 +282,28 @@ func ExampleSlideWindowLimiter_Allow() {
 	}
 	//output
 }
+
+func TestSlideWindowLimiter_SetLimit(t *testing.T) {
+	clock := restrictor.NewFakeClock(time.Now())
+	limiter := NewSlideWindowLimiter(time.Minute, 2, WithClock(clock))
+	require.NoError(t, allowN(limiter, 2))
+	require.ErrorIs(t, allowN(limiter, 1), restrictor.ErrLimitExceeded)
+
+	// 调大以后窗口内已经记录的请求保留
+	limiter.SetLimit(3)
+	require.NoError(t, allowN(limiter, 1))
+	require.ErrorIs(t, allowN(limiter, 1), restrictor.ErrLimitExceeded)
+
+	// 调小以后超过新的上限直接返回error
+	limiter.SetLimit(1)
+	require.ErrorIs(t, limiter.WaitN(context.Background(), 2), restrictor.ErrExceedsCapacity)
+	d, err := limiter.Decide(context.Background(), 1)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), d.Remaining)
+
+	// 调小窗口以后之前的请求按照新的大小滑出窗口
+	limiter.SetInterval(time.Second)
+	clock.Advance(2 * time.Second)
+	require.NoError(t, allowN(limiter, 1))
+	require.ErrorIs(t, allowN(limiter, 1), restrictor.ErrLimitExceeded)
+}
@@ -2,71 +2,330 @@ package single
 
 import (
 	"context"
-	"errors"
+	"github.com/liquanhui-99/restrictor"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 // TokenBucketLimiter 令牌桶算法实现的限流器
 type TokenBucketLimiter struct {
-	// 令牌桶队列
-	ch chan struct{}
+	// 令牌桶队列，保存的是chan struct{}，SetBurst时整体替换
+	ch atomic.Value
 	// 关闭令牌功能
 	close chan struct{}
 	// once控制只能关闭关闭一次
 	once *sync.Once
+	// interval 发送令牌的间隔
+	interval time.Duration
+	// mu 保护预定相关的状态、interval和令牌桶的替换，发送令牌、预定令牌和SetBurst加写锁，
+	// Decide和RefundN存取令牌加读锁，避免SetBurst替换令牌桶的时候令牌被放回旧的令牌桶
+	mu sync.RWMutex
+	// last 最近一次发送令牌的时间
+	last time.Time
+	// debt 已经预定出去但是还没有发送的令牌数量，发送的令牌优先偿还给预定
+	debt int64
+	// clock 获取时间和创建定时器的时钟
+	clock restrictor.Clock
+	// ticker 控制发送令牌的频率
+	ticker restrictor.Ticker
 }
 
 // NewTokenBucketLimiter 初始化令牌桶，capacity是缓存令牌的channel容量，控制可以通过的最大请求，
 // 容量设置需要谨慎，如果开的过大，服务器可能会被瞬间的流量击垮；interval是发送令牌的间隔，多久发送一次令牌
-func NewTokenBucketLimiter(capacity int64, interval time.Duration) *TokenBucketLimiter {
-	ch := make(chan struct{}, capacity)
-	closeCh := make(chan struct{})
-	go func() {
-		ticker := time.NewTicker(interval)
-		defer ticker.Stop()
-		for {
-			select {
-			case <-closeCh:
-				return
-			case <-ticker.C:
+func NewTokenBucketLimiter(capacity int64, interval time.Duration, opts ...Option) *TokenBucketLimiter {
+	o := newOptions(opts)
+	limiter := &TokenBucketLimiter{
+		close:    make(chan struct{}),
+		once:     &sync.Once{},
+		interval: interval,
+		last:     o.clock.Now(),
+		clock:    o.clock,
+		ticker:   o.clock.NewTicker(interval),
+	}
+	limiter.ch.Store(make(chan struct{}, capacity))
+	go limiter.refill()
+
+	return limiter
+}
+
+// refill 按照interval的间隔发送令牌
+func (t *TokenBucketLimiter) refill() {
+	defer t.ticker.Stop()
+	for {
+		select {
+		case <-t.close:
+			return
+		case now := <-t.ticker.C():
+			t.mu.Lock()
+			t.last = now
+			if t.debt > 0 {
+				// 优先偿还预定出去的令牌
+				t.debt--
+			} else {
 				// 发送令牌
 				select {
-				case ch <- struct{}{}:
+				case t.tokens() <- struct{}{}:
 				default:
 				}
 			}
+			t.mu.Unlock()
 		}
-	}()
+	}
+}
 
-	limiter := &TokenBucketLimiter{
-		ch:    ch,
-		close: closeCh,
-		once:  &sync.Once{},
+// Allow 是否运行继续请求
+func (t *TokenBucketLimiter) Allow(ctx context.Context) (bool, error) {
+	return t.AllowN(ctx, 1)
+}
+
+// AllowN 是否允许消耗n个令牌继续请求，令牌不够时归还已经拿到的令牌
+func (t *TokenBucketLimiter) AllowN(ctx context.Context, n int64) (bool, error) {
+	d, err := t.Decide(ctx, n)
+	if err != nil {
+		return false, err
+	}
+	if !d.Allowed {
+		return false, restrictor.NewLimitError(d)
 	}
+	return true, nil
+}
 
-	return limiter
+// Decide 判定是否允许消耗n个令牌继续请求，返回桶里剩余的令牌数量，
+// 被拒绝时RetryAfter是发送出足够令牌的时间
+func (t *TokenBucketLimiter) Decide(ctx context.Context, n int64) (restrictor.Decision, error) {
+	if err := restrictor.CheckCount(n); err != nil {
+		return restrictor.Decision{}, err
+	}
+	capacity := int64(cap(t.tokens()))
+	now := t.clock.Now()
+	select {
+	case <-t.close:
+		// 关闭限流器
+		return restrictor.Decision{
+			Allowed:   true,
+			Limit:     capacity,
+			Remaining: capacity,
+			ResetAt:   now,
+			Limiter:   restrictor.TokenBucket,
+		}, nil
+	case <-ctx.Done():
+		return restrictor.Decision{}, ctx.Err()
+	default:
+	}
+
+	t.mu.RLock()
+	capacity = int64(cap(t.tokens()))
+	taken := t.takeN(n)
+	if taken < n {
+		t.putBack(taken)
+	}
+	remaining := int64(len(t.tokens()))
+	last, debt, interval := t.last, t.debt, t.interval
+	t.mu.RUnlock()
+
+	d := restrictor.Decision{
+		Allowed:   taken == n,
+		Limit:     capacity,
+		Remaining: remaining,
+		// 先偿还预定出去的令牌，再把桶装满
+		ResetAt: after(now, last, interval, capacity-remaining+debt),
+		Limiter: restrictor.TokenBucket,
+	}
+	if !d.Allowed && n <= capacity {
+		d.RetryAfter = after(now, last, interval, n-remaining+debt).Sub(now)
+	}
+	return d, nil
 }
 
-// Allow 是否运行继续请求
-func (t TokenBucketLimiter) Allow(ctx context.Context) (bool, error) {
+// after 从last开始按照interval再发送count个令牌的时间，不早于now
+func after(now time.Time, last time.Time, interval time.Duration, count int64) time.Time {
+	if count <= 0 {
+		return now
+	}
+	at := last.Add(time.Duration(count) * interval)
+	if at.Before(now) {
+		return now
+	}
+	return at
+}
+
+// Wait 阻塞直到拿到一个令牌
+func (t *TokenBucketLimiter) Wait(ctx context.Context) error {
+	return t.WaitN(ctx, 1)
+}
+
+// WaitN 阻塞直到拿到n个令牌，n超过令牌桶的容量时直接返回error，
+// 等待的时长超过ctx的截止时间或者等待过程中ctx结束，预定的令牌会尽量归还给令牌桶
+func (t *TokenBucketLimiter) WaitN(ctx context.Context, n int64) error {
+	if err := restrictor.CheckCount(n); err != nil {
+		return err
+	}
+	if n > int64(cap(t.tokens())) {
+		return restrictor.ErrExceedsCapacity
+	}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+	}
+
+	r := t.ReserveN(n)
+	delay := r.Delay()
+	if delay == 0 {
+		return nil
+	}
+	if deadline, ok := ctx.Deadline(); ok && deadline.Before(r.timeToAct) {
+		r.Cancel()
+		return context.DeadlineExceeded
+	}
+
+	timer := t.clock.NewTimer(delay)
+	defer timer.Stop()
 	select {
 	case <-t.close:
 		// 关闭限流器
-		return true, nil
+		return nil
 	case <-ctx.Done():
-		return false, ctx.Err()
-	case <-t.ch:
-		return true, nil
+		r.Cancel()
+		return ctx.Err()
+	case <-timer.C():
+		return nil
+	}
+}
+
+// Reserve 预定一个令牌，等价于ReserveN(1)
+func (t *TokenBucketLimiter) Reserve() *Reservation {
+	return t.ReserveN(1)
+}
+
+// ReserveN 预定n个令牌，桶里的令牌不够时预定未来发送的令牌，通过Reservation.Delay
+// 获取需要等待的时长，n超过令牌桶的容量时预定失败
+func (t *TokenBucketLimiter) ReserveN(n int64) *Reservation {
+	if restrictor.CheckCount(n) != nil {
+		return &Reservation{ok: false}
+	}
+	now := t.clock.Now()
+	select {
+	case <-t.close:
+		// 关闭限流器，直接放行
+		return &Reservation{ok: true, clock: t.clock, timeToAct: now}
 	default:
-		return false, errors.New("达到了性能瓶颈")
 	}
+	if n > int64(cap(t.tokens())) {
+		return &Reservation{ok: false}
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	taken := t.takeN(n)
+	owed := n - taken
+	timeToAct := now
+	if owed > 0 {
+		// 需要等到第debt个令牌发送出来，这个预定的令牌才全部偿还
+		t.debt += owed
+		timeToAct = t.last.Add(time.Duration(t.debt) * t.interval)
+	}
+	return &Reservation{
+		ok:        true,
+		clock:     t.clock,
+		timeToAct: timeToAct,
+		cancel: func(at time.Time) {
+			t.cancelReservation(at, timeToAct, taken, owed)
+		},
+	}
+}
+
+// cancelReservation 在at时间归还预定，已经拿到的taken个令牌放回令牌桶，
+// owed个还没有发送的令牌中尚未偿还的部分从debt中扣除；at不早于timeToAct时预定已经可以使用，
+// 调用方可能已经用掉了这些令牌，不再归还
+func (t *TokenBucketLimiter) cancelReservation(at time.Time, timeToAct time.Time, taken int64, owed int64) {
+	if !at.Before(timeToAct) {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if owed > 0 {
+		// 这个预定在timeToAct之前还有多少次发送没有发生
+		remain := int64((timeToAct.Sub(at) + t.interval - 1) / t.interval)
+		if remain > owed {
+			remain = owed
+		}
+		if remain > t.debt {
+			remain = t.debt
+		}
+		t.debt -= remain
+	}
+	t.putBack(taken)
+}
+
+// takeN 不阻塞地从令牌桶中拿最多n个令牌，返回拿到的数量
+func (t *TokenBucketLimiter) takeN(n int64) int64 {
+	ch := t.tokens()
+	for i := int64(0); i < n; i++ {
+		select {
+		case <-ch:
+		default:
+			return i
+		}
+	}
+	return n
+}
+
+// putBack 把n个令牌放回令牌桶，桶满了就丢弃
+func (t *TokenBucketLimiter) putBack(n int64) {
+	ch := t.tokens()
+	for i := int64(0); i < n; i++ {
+		select {
+		case ch <- struct{}{}:
+		default:
+			return
+		}
+	}
+}
+
+// RefundN 把n个令牌放回令牌桶，桶满了就丢弃，令牌桶不区分窗口，at不影响归还
+func (t *TokenBucketLimiter) RefundN(n int64, at time.Time) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	t.putBack(n)
+}
+
+// SetBurst 修改令牌桶的容量，桶里已有的令牌保留，超过新容量的部分丢弃，可以和Allow并发调用
+func (t *TokenBucketLimiter) SetBurst(capacity int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	old := t.tokens()
+	ch := make(chan struct{}, capacity)
+	for int64(len(ch)) < capacity {
+		select {
+		case <-old:
+			ch <- struct{}{}
+			continue
+		default:
+		}
+		break
+	}
+	t.ch.Store(ch)
+}
+
+// SetInterval 修改发送令牌的间隔，桶里已有的令牌和预定的令牌保留，可以和Allow并发调用
+func (t *TokenBucketLimiter) SetInterval(interval time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.interval = interval
+	t.ticker.Reset(interval)
+}
+
+// tokens 当前的令牌桶
+func (t *TokenBucketLimiter) tokens() chan struct{} {
+	return t.ch.Load().(chan struct{})
 }
 
 // Close 关闭限流器
-func (t TokenBucketLimiter) Close() {
+func (t *TokenBucketLimiter) Close() {
 	t.once.Do(func() {
+		// 不关闭令牌桶的channel，避免放回令牌时向已关闭的channel发送数据
 		close(t.close)
-		close(t.ch)
 	})
 }
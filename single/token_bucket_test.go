@@ -2,11 +2,12 @@ package single
 
 import (
 	"context"
-	"errors"
 	"github.com/gin-gonic/gin"
 	"github.com/go-playground/assert/v2"
+	"github.com/liquanhui-99/restrictor"
 	"github.com/stretchr/testify/require"
 	"net/http"
+	"sync"
 	"testing"
 	"time"
 )
@@ -18,7 +19,7 @@ func TestTokenBucketLimiter_Allow(t *testing.T) {
 		interval time.Duration
 		wantErr  error
 		wantRes  bool
-		before   func()
+		before   func(*testing.T, *TokenBucketLimiter, *restrictor.FakeClock)
 		after    func(*TokenBucketLimiter)
 		ctx      func() (context.Context, context.CancelFunc)
 	}{
@@ -29,7 +30,7 @@ func TestTokenBucketLimiter_Allow(t *testing.T) {
 			interval: time.Second,
 			wantErr:  context.DeadlineExceeded,
 			wantRes:  false,
-			before:   func() {},
+			before:   func(t *testing.T, limiter *TokenBucketLimiter, clock *restrictor.FakeClock) {},
 			after: func(limiter *TokenBucketLimiter) {
 				limiter.Close()
 			},
@@ -45,11 +46,13 @@ func TestTokenBucketLimiter_Allow(t *testing.T) {
 			interval: 10 * time.Millisecond,
 			wantErr:  nil,
 			wantRes:  true,
+			before: func(t *testing.T, limiter *TokenBucketLimiter, clock *restrictor.FakeClock) {
+				fillTokens(t, clock, limiter, 1)
+			},
 			after: func(limiter *TokenBucketLimiter) {
 				limiter.Close()
 			},
 			ctx: func() (context.Context, context.CancelFunc) {
-				time.Sleep(time.Second)
 				ctx, cancel := context.WithTimeout(context.Background(), time.Second)
 				return ctx, cancel
 			},
@@ -59,8 +62,9 @@ func TestTokenBucketLimiter_Allow(t *testing.T) {
 			name:     "max count",
 			capacity: 0,
 			interval: 1 * time.Second,
-			wantErr:  errors.New("达到了性能瓶颈"),
+			wantErr:  restrictor.ErrLimitExceeded,
 			wantRes:  false,
+			before:   func(t *testing.T, limiter *TokenBucketLimiter, clock *restrictor.FakeClock) {},
 			after: func(limiter *TokenBucketLimiter) {
 				limiter.Close()
 			},
@@ -73,11 +77,13 @@ func TestTokenBucketLimiter_Allow(t *testing.T) {
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			limiter := NewTokenBucketLimiter(tc.capacity, tc.interval)
+			clock := restrictor.NewFakeClock(time.Now())
+			limiter := NewTokenBucketLimiter(tc.capacity, tc.interval, WithClock(clock))
+			tc.before(t, limiter, clock)
 			c, cancel := tc.ctx()
 			defer cancel()
 			ok, err := limiter.Allow(c)
-			assert.Equal(t, tc.wantErr, err)
+			require.ErrorIs(t, err, tc.wantErr)
 			assert.Equal(t, tc.wantRes, ok)
 			tc.after(limiter)
 		})
@@ -85,8 +91,9 @@ func TestTokenBucketLimiter_Allow(t *testing.T) {
 }
 
 func TestTokenBucketLimiter_Close(t *testing.T) {
-	limiter := NewTokenBucketLimiter(10, 1*time.Millisecond)
-	time.Sleep(10 * time.Millisecond)
+	clock := restrictor.NewFakeClock(time.Now())
+	limiter := NewTokenBucketLimiter(10, 1*time.Millisecond, WithClock(clock))
+	fillTokens(t, clock, limiter, 1)
 	ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(time.Second))
 	defer cancel()
 	res, err := limiter.Allow(ctx)
@@ -97,10 +104,131 @@ func TestTokenBucketLimiter_Close(t *testing.T) {
 }
 
 func TestTokenBucketLimiter_channelBlock(t *testing.T) {
-	limiter := NewTokenBucketLimiter(5, 1*time.Millisecond)
-	time.Sleep(10 * time.Millisecond)
+	clock := restrictor.NewFakeClock(time.Now())
+	limiter := NewTokenBucketLimiter(5, 1*time.Millisecond, WithClock(clock))
+	fillTokens(t, clock, limiter, 5)
+	// 令牌桶满了以后继续发送令牌不会阻塞
+	clock.Advance(time.Millisecond)
+	clock.Advance(time.Millisecond)
+	limiter.Close()
 	limiter.Close()
+}
+
+func TestTokenBucketLimiter_AllowN(t *testing.T) {
+	clock := restrictor.NewFakeClock(time.Now())
+	limiter := NewTokenBucketLimiter(5, time.Millisecond, WithClock(clock))
+	defer limiter.Close()
+	// 等待令牌桶装满
+	fillTokens(t, clock, limiter, 5)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	// 令牌不够的时候一个令牌都不消耗
+	ok, err := limiter.AllowN(ctx, 6)
+	require.ErrorIs(t, err, restrictor.ErrLimitExceeded)
+	assert.Equal(t, false, ok)
+	assert.Equal(t, 5, len(limiter.tokens()))
+
+	ok, err = limiter.AllowN(ctx, 5)
+	require.NoError(t, err)
+	assert.Equal(t, true, ok)
+}
+
+func TestTokenBucketLimiter_Decide(t *testing.T) {
+	clock := restrictor.NewFakeClock(time.Now())
+	limiter := NewTokenBucketLimiter(5, time.Hour, WithClock(clock))
+	defer limiter.Close()
+	// 桶里还没有令牌，需要等第一次发送令牌
+	clock.Advance(10 * time.Minute)
+	d, err := limiter.Decide(context.Background(), 1)
+	require.NoError(t, err)
+	assert.Equal(t, false, d.Allowed)
+	assert.Equal(t, int64(5), d.Limit)
+	assert.Equal(t, int64(0), d.Remaining)
+	assert.Equal(t, restrictor.TokenBucket, d.Limiter)
+	assert.Equal(t, 50*time.Minute, d.RetryAfter)
+	assert.Equal(t, clock.Now().Add(4*time.Hour+50*time.Minute), d.ResetAt)
+
+	// 关闭以后直接放行
 	limiter.Close()
+	d, err = limiter.Decide(context.Background(), 1)
+	require.NoError(t, err)
+	assert.Equal(t, true, d.Allowed)
+}
+
+func TestTokenBucketLimiter_WaitN(t *testing.T) {
+	testCases := []struct {
+		name     string
+		capacity int64
+		interval time.Duration
+		n        int64
+		timeout  time.Duration
+		// 等待开始以后把时间推进多久
+		advance  time.Duration
+		wantErr  error
+		wantWait time.Duration
+	}{
+		// 等到足够的令牌
+		{
+			name:     "success",
+			capacity: 10,
+			interval: time.Millisecond,
+			n:        3,
+			timeout:  time.Second,
+			advance:  3 * time.Millisecond,
+			wantWait: 3 * time.Millisecond,
+		},
+		// 超过令牌桶的容量
+		{
+			name:     "over capacity",
+			capacity: 2,
+			interval: time.Millisecond,
+			n:        3,
+			timeout:  time.Second,
+			wantErr:  restrictor.ErrExceedsCapacity,
+		},
+		// context超时
+		{
+			name:     "Deadline",
+			capacity: 5,
+			interval: time.Second,
+			n:        1,
+			timeout:  10 * time.Millisecond,
+			wantErr:  context.DeadlineExceeded,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			clock := restrictor.NewFakeClock(time.Now())
+			limiter := NewTokenBucketLimiter(tc.capacity, tc.interval, WithClock(clock))
+			defer limiter.Close()
+			ctx, cancel := context.WithTimeout(context.Background(), tc.timeout)
+			defer cancel()
+			if tc.advance > 0 {
+				go func() {
+					// 发送令牌的Ticker和等待的Timer
+					clock.BlockUntil(2)
+					clock.Advance(tc.advance)
+				}()
+			}
+			start := clock.Now()
+			err := limiter.WaitN(ctx, tc.n)
+			require.ErrorIs(t, err, tc.wantErr)
+			assert.Equal(t, tc.wantWait, clock.Now().Sub(start))
+		})
+	}
+}
+
+// fillTokens 按照发送令牌的间隔推进clock，直到令牌桶里至少有count个令牌
+func fillTokens(t *testing.T, clock *restrictor.FakeClock, limiter *TokenBucketLimiter, count int) {
+	require.Eventually(t, func() bool {
+		if len(limiter.tokens()) >= count {
+			return true
+		}
+		clock.Advance(limiter.interval)
+		return false
+	}, time.Second, time.Millisecond)
 }
 
 func ExampleTokenBucketLimiter_Allow() {
@@ -130,3 +258,70 @@ func ExampleTokenBucketLimiter_Allow() {
 	}
 	//output
 }
+
+func TestTokenBucketLimiter_SetBurst(t *testing.T) {
+	clock := restrictor.NewFakeClock(time.Now())
+	limiter := NewTokenBucketLimiter(1, time.Minute, WithClock(clock))
+	defer limiter.Close()
+	tick := func(d time.Duration, want int) {
+		clock.BlockUntil(1)
+		clock.Advance(d)
+		require.Eventually(t, func() bool {
+			return len(limiter.tokens()) == want
+		}, time.Second, time.Millisecond)
+	}
+	tick(time.Minute, 1)
+
+	// 调大容量以后桶里的令牌保留
+	limiter.SetBurst(3)
+	assert.Equal(t, 3, cap(limiter.tokens()))
+	assert.Equal(t, 1, len(limiter.tokens()))
+	tick(time.Minute, 2)
+	tick(time.Minute, 3)
+
+	// 调小容量以后超过容量的令牌丢弃
+	limiter.SetBurst(2)
+	assert.Equal(t, 2, len(limiter.tokens()))
+	require.NoError(t, allowN(limiter, 2))
+	require.ErrorIs(t, limiter.WaitN(context.Background(), 3), restrictor.ErrExceedsCapacity)
+
+	// 修改间隔以后按照新的间隔发送令牌
+	limiter.SetInterval(time.Second)
+	tick(time.Second, 1)
+	d, err := limiter.Decide(context.Background(), 2)
+	require.NoError(t, err)
+	assert.Equal(t, false, d.Allowed)
+	assert.Equal(t, time.Second, d.RetryAfter)
+}
+
+func TestTokenBucketLimiter_SetBurstConcurrent(t *testing.T) {
+	clock := restrictor.NewFakeClock(time.Now())
+	limiter := NewTokenBucketLimiter(10, time.Hour, WithClock(clock))
+	defer limiter.Close()
+	for i := 0; i < 10; i++ {
+		limiter.tokens() <- struct{}{}
+	}
+	ctx := context.Background()
+
+	// 拿到的令牌马上归还，同时不断调大容量，令牌的数量不会变化
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 500; j++ {
+				d, err := limiter.Decide(ctx, 2)
+				require.NoError(t, err)
+				if d.Allowed {
+					limiter.RefundN(2, time.Time{})
+				}
+			}
+		}()
+	}
+	for burst := int64(11); burst <= 200; burst++ {
+		limiter.SetBurst(burst)
+	}
+	wg.Wait()
+	assert.Equal(t, 10, len(limiter.tokens()))
+	assert.Equal(t, 200, cap(limiter.tokens()))
+}
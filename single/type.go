@@ -2,12 +2,43 @@ package single
 
 import (
 	"context"
+	"github.com/liquanhui-99/restrictor"
+	"time"
 )
 
 // Limiter 单机使用的限流器接口
 type Limiter interface {
 	// Allow 是否允许通过限流器继续请求，返回true则通过，返回false和error为不通过
 	Allow(ctx context.Context) (bool, error)
+	// AllowN 是否允许通过限流器继续请求，请求消耗n个单位，n个单位要么全部消耗，要么一个都不消耗，
+	// n小于等于0时返回restrictor.ErrInvalidCount
+	AllowN(ctx context.Context, n int64) (bool, error)
 	// Close 关闭限流器
 	Close()
 }
+
+// WaitLimiter 支持阻塞等待的限流器接口
+type WaitLimiter interface {
+	Limiter
+	// Wait 阻塞直到限流器允许通过一个请求，或者ctx结束
+	Wait(ctx context.Context) error
+	// WaitN 阻塞直到限流器允许通过n个请求，或者ctx结束，
+	// n超过限流器的最大容量时直接返回error
+	WaitN(ctx context.Context, n int64) error
+}
+
+// RefundLimiter 可以归还已经通过的请求消耗的数量的限流器接口，组合限流器在后面的层级拒绝时用来回滚
+type RefundLimiter interface {
+	Limiter
+	// RefundN 归还at时消耗的n个单位，最多恢复到这些单位被消耗之前的状态，at需要在调用AllowN之前获取，
+	// at所在的窗口已经结束等无法归还的情况直接忽略，不会把额度归还给之后的窗口
+	RefundN(n int64, at time.Time)
+}
+
+// DecisionLimiter 可以返回详细判定结果的限流器接口
+type DecisionLimiter interface {
+	Limiter
+	// Decide 判定是否允许n个单位的请求通过，请求被拒绝时不返回error，
+	// 只有ctx结束等无法判定的情况才返回error
+	Decide(ctx context.Context, n int64) (restrictor.Decision, error)
+}
@@ -0,0 +1,77 @@
+package single
+
+import (
+	"context"
+	"github.com/liquanhui-99/restrictor"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestLimiter_InvalidCount(t *testing.T) {
+	clock := restrictor.NewFakeClock(time.Now())
+	testCases := []struct {
+		name    string
+		limiter DecisionLimiter
+	}{
+		{name: "固定窗口", limiter: NewFixedWindowLimiter(time.Minute, 10, WithClock(clock))},
+		{name: "滑动窗口", limiter: NewSlideWindowLimiter(time.Minute, 10, WithClock(clock))},
+		{name: "滑动窗口计数器", limiter: NewSlideWindowCounterLimiter(time.Minute, 10, WithClock(clock))},
+		{name: "令牌桶", limiter: NewTokenBucketLimiter(10, time.Hour, WithClock(clock))},
+		{name: "惰性令牌桶", limiter: NewLazyTokenBucketLimiter(1, 10, WithClock(clock))},
+		{name: "GCRA", limiter: NewGCRALimiter(time.Minute, 10, 10, WithClock(clock))},
+		{name: "漏桶", limiter: NewLeakeyBucketLimiter(time.Second, WithCapacity(10), WithClock(clock))},
+		{name: "预热令牌桶", limiter: NewWarmUpTokenBucketLimiter(1, time.Second, WithClock(clock))},
+	}
+	ctx := context.Background()
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			defer tc.limiter.Close()
+			for _, n := range []int64{0, -1, -100} {
+				res, err := tc.limiter.AllowN(ctx, n)
+				require.ErrorIs(t, err, restrictor.ErrInvalidCount)
+				require.False(t, res)
+				_, err = tc.limiter.Decide(ctx, n)
+				require.ErrorIs(t, err, restrictor.ErrInvalidCount)
+				if w, ok := tc.limiter.(WaitLimiter); ok {
+					require.ErrorIs(t, w.WaitN(ctx, n), restrictor.ErrInvalidCount)
+				}
+				if r, ok := tc.limiter.(interface{ ReserveN(int64) *Reservation }); ok {
+					require.False(t, r.ReserveN(n).OK())
+				}
+			}
+			// 负数的n没有增加限流器的额度
+			d, err := tc.limiter.Decide(ctx, 1)
+			require.NoError(t, err)
+			require.LessOrEqual(t, d.Remaining, d.Limit)
+		})
+	}
+}
+
+func TestKeyedLimiter_InvalidCount(t *testing.T) {
+	clock := restrictor.NewFakeClock(time.Now())
+	k := NewKeyedLimiter(func(string) Limiter {
+		return NewFixedWindowLimiter(time.Minute, 2, WithClock(clock))
+	}, time.Minute, 10, WithClock(clock))
+	defer k.Close()
+	c := NewCompositeLimiter(k)
+	ctx := context.Background()
+	res, err := k.Allow(ctx, "key")
+	require.NoError(t, err)
+	require.True(t, res)
+	for _, n := range []int64{0, -100} {
+		res, err = k.AllowN(ctx, "key", n)
+		require.ErrorIs(t, err, restrictor.ErrInvalidCount)
+		require.False(t, res)
+		res, err = c.AllowN(ctx, []string{"key"}, n)
+		require.ErrorIs(t, err, restrictor.ErrInvalidCount)
+		require.False(t, res)
+	}
+	// 额度没有变化
+	res, err = k.Allow(ctx, "key")
+	require.NoError(t, err)
+	require.True(t, res)
+	res, err = k.Allow(ctx, "key")
+	require.ErrorIs(t, err, restrictor.ErrLimitExceeded)
+	require.False(t, res)
+}
@@ -0,0 +1,199 @@
+package single
+
+import (
+	"context"
+	"github.com/liquanhui-99/restrictor"
+	"math"
+	"sync"
+	"time"
+)
+
+// coldFactor 冷启动时发放令牌的间隔是稳定间隔的倍数
+const coldFactor = 3
+
+// WarmUpTokenBucketLimiter 带预热的令牌桶限流器，参考Guava的SmoothWarmingUp，
+// 空闲一段时间以后桶里积攒的令牌越多发放得越慢，在warmup时间内线性加速到稳定的速率，
+// 适合缓存刚启动、还不能承受全部流量的场景
+type WarmUpTokenBucketLimiter struct {
+	mu sync.Mutex
+	// warmup 从冷启动加速到稳定速率的时间
+	warmup time.Duration
+	// stable 稳定时发放令牌的间隔，单位是纳秒
+	stable float64
+	// threshold 桶里的令牌超过threshold时进入预热阶段
+	threshold float64
+	// maxPermits 桶里最多积攒的令牌数量
+	maxPermits float64
+	// slope 预热阶段每多一个令牌，发放间隔增加的时长，单位是纳秒
+	slope float64
+	// coolDown 空闲时积攒一个令牌的间隔，单位是纳秒
+	coolDown float64
+	// stored 桶里积攒的令牌数量
+	stored float64
+	// next 下一个请求可以通过的时间，单位是纳秒
+	next int64
+	// clock 获取时间的时钟
+	clock restrictor.Clock
+}
+
+// NewWarmUpTokenBucketLimiter 初始化带预热的令牌桶，rate是稳定时每秒发放的令牌数量，必须大于0，
+// warmup是从冷启动加速到稳定速率的时间，初始化时处于冷启动的状态
+func NewWarmUpTokenBucketLimiter(rate float64, warmup time.Duration, opts ...Option) *WarmUpTokenBucketLimiter {
+	o := newOptions(opts)
+	l := &WarmUpTokenBucketLimiter{
+		warmup: warmup,
+		next:   o.clock.Now().UnixNano(),
+		clock:  o.clock,
+	}
+	l.configure(rate)
+	l.stored = l.maxPermits
+	return l
+}
+
+// configure 根据rate和warmup计算预热的参数
+func (l *WarmUpTokenBucketLimiter) configure(rate float64) {
+	l.stable = float64(time.Second) / rate
+	l.threshold = 0.5 * float64(l.warmup) / l.stable
+	l.maxPermits = l.threshold + 2*float64(l.warmup)/(l.stable+l.stable*coldFactor)
+	l.slope, l.coolDown = 0, 0
+	if l.maxPermits > l.threshold {
+		l.slope = (l.stable*coldFactor - l.stable) / (l.maxPermits - l.threshold)
+	}
+	if l.maxPermits > 0 {
+		l.coolDown = float64(l.warmup) / l.maxPermits
+	}
+}
+
+// SetRate 修改稳定时每秒发放的令牌数量，必须大于0，可以和Allow并发调用。
+// 桶里积攒的令牌按照新旧容量的比例换算，保持原来的冷热程度
+func (l *WarmUpTokenBucketLimiter) SetRate(rate float64) {
+	now := l.clock.Now().UnixNano()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.resync(now)
+	old := l.maxPermits
+	l.configure(rate)
+	if old > 0 {
+		l.stored = l.stored * l.maxPermits / old
+	} else {
+		l.stored = 0
+	}
+}
+
+// Allow 是否允许继续请求
+func (l *WarmUpTokenBucketLimiter) Allow(ctx context.Context) (bool, error) {
+	return l.AllowN(ctx, 1)
+}
+
+// AllowN 是否允许消耗n个令牌继续请求，n个令牌的发放时间由下一个请求等待
+func (l *WarmUpTokenBucketLimiter) AllowN(ctx context.Context, n int64) (bool, error) {
+	d, err := l.Decide(ctx, n)
+	if err != nil {
+		return false, err
+	}
+	if !d.Allowed {
+		return false, restrictor.NewLimitError(d)
+	}
+	return true, nil
+}
+
+// Decide 判定是否允许消耗n个令牌继续请求，只要上一个请求的令牌已经发放完就允许通过，
+// 这次请求需要的发放时间由下一个请求等待，所以判定结果的Limit固定是1，被拒绝时RetryAfter是上一个请求的令牌发放完的时间
+func (l *WarmUpTokenBucketLimiter) Decide(ctx context.Context, n int64) (restrictor.Decision, error) {
+	if err := restrictor.CheckCount(n); err != nil {
+		return restrictor.Decision{}, err
+	}
+	if err := ctx.Err(); err != nil {
+		return restrictor.Decision{}, err
+	}
+	now := l.clock.Now().UnixNano()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.resync(now)
+	d := restrictor.Decision{
+		Limit:   1,
+		Limiter: restrictor.WarmUpTokenBucket,
+	}
+	if l.next > now {
+		d.ResetAt = time.Unix(0, l.next)
+		d.RetryAfter = time.Duration(l.next - now)
+		return d, nil
+	}
+	l.reserve(n)
+	d.Allowed = true
+	d.ResetAt = time.Unix(0, l.next)
+	if l.next <= now {
+		d.Remaining = 1
+	}
+	return d, nil
+}
+
+// Wait 阻塞直到拿到一个令牌
+func (l *WarmUpTokenBucketLimiter) Wait(ctx context.Context) error {
+	return l.WaitN(ctx, 1)
+}
+
+// WaitN 阻塞直到拿到n个令牌，需要等待的时长超过ctx的截止时间时直接返回context.DeadlineExceeded，
+// 不会占用令牌；等待过程中ctx结束时已经占用的令牌不会归还
+func (l *WarmUpTokenBucketLimiter) WaitN(ctx context.Context, n int64) error {
+	if err := restrictor.CheckCount(n); err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	now := l.clock.Now().UnixNano()
+	l.mu.Lock()
+	l.resync(now)
+	wait := time.Duration(l.next - now)
+	if wait < 0 {
+		wait = 0
+	}
+	if deadline, ok := ctx.Deadline(); ok && deadline.Before(time.Unix(0, now).Add(wait)) {
+		l.mu.Unlock()
+		return context.DeadlineExceeded
+	}
+	l.reserve(n)
+	l.mu.Unlock()
+	return sleep(ctx, l.clock, wait)
+}
+
+// resync 根据空闲的时间积攒令牌
+func (l *WarmUpTokenBucketLimiter) resync(now int64) {
+	if now <= l.next {
+		return
+	}
+	if l.coolDown > 0 {
+		l.stored = math.Min(l.maxPermits, l.stored+float64(now-l.next)/l.coolDown)
+	}
+	l.next = now
+}
+
+// reserve 占用n个令牌，优先使用积攒的令牌，推迟下一个请求可以通过的时间
+func (l *WarmUpTokenBucketLimiter) reserve(n int64) {
+	spend := math.Min(float64(n), l.stored)
+	fresh := float64(n) - spend
+	wait := l.storedWaitTime(l.stored, spend) + fresh*l.stable
+	l.stored -= spend
+	l.next += int64(wait)
+}
+
+// storedWaitTime 从积攒的stored个令牌中取出take个需要的发放时间，
+// 超过threshold的部分发放间隔线性增加，按照梯形的面积计算，其余的部分按照稳定间隔计算
+func (l *WarmUpTokenBucketLimiter) storedWaitTime(stored, take float64) float64 {
+	var wait float64
+	if above := stored - l.threshold; above > 0 {
+		inAbove := math.Min(above, take)
+		wait = inAbove * (l.permitsToTime(above) + l.permitsToTime(above-inAbove)) / 2
+		take -= inAbove
+	}
+	return wait + l.stable*take
+}
+
+// permitsToTime 桶里超过threshold的令牌数量是permits时的发放间隔
+func (l *WarmUpTokenBucketLimiter) permitsToTime(permits float64) float64 {
+	return l.stable + permits*l.slope
+}
+
+// Close 预热令牌桶没有需要释放的资源
+func (l *WarmUpTokenBucketLimiter) Close() {}
@@ -0,0 +1,177 @@
+package single
+
+import (
+	"context"
+	"github.com/go-playground/assert/v2"
+	"github.com/liquanhui-99/restrictor"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestWarmUpTokenBucketLimiter_Decide(t *testing.T) {
+	// 每秒10个，稳定间隔100毫秒，冷启动间隔300毫秒，最多积攒10个令牌，超过5个进入预热阶段
+	clock := restrictor.NewFakeClock(time.Now())
+	limiter := NewWarmUpTokenBucketLimiter(10, time.Second, WithClock(clock))
+	defer limiter.Close()
+
+	// 冷启动的第一个请求直接通过，下一个请求需要等待280毫秒
+	d, err := limiter.Decide(context.Background(), 1)
+	require.NoError(t, err)
+	assert.Equal(t, true, d.Allowed)
+	assert.Equal(t, int64(1), d.Limit)
+	assert.Equal(t, int64(0), d.Remaining)
+	assert.Equal(t, restrictor.WarmUpTokenBucket, d.Limiter)
+	assert.Equal(t, clock.Now().Add(280*time.Millisecond).UnixNano(), d.ResetAt.UnixNano())
+
+	d, err = limiter.Decide(context.Background(), 1)
+	require.NoError(t, err)
+	assert.Equal(t, false, d.Allowed)
+	assert.Equal(t, 280*time.Millisecond, d.RetryAfter)
+
+	// 发放间隔逐渐缩短：240、200、160、120毫秒
+	clock.Advance(280 * time.Millisecond)
+	for _, wait := range []time.Duration{240, 200, 160, 120} {
+		d, err = limiter.Decide(context.Background(), 1)
+		require.NoError(t, err)
+		require.True(t, d.Allowed)
+		assert.Equal(t, clock.Now().Add(wait*time.Millisecond).UnixNano(), d.ResetAt.UnixNano())
+		clock.Advance(wait * time.Millisecond)
+	}
+
+	// 预热完成以后按照稳定间隔发放
+	for i := 0; i < 6; i++ {
+		d, err = limiter.Decide(context.Background(), 1)
+		require.NoError(t, err)
+		require.True(t, d.Allowed)
+		assert.Equal(t, clock.Now().Add(100*time.Millisecond).UnixNano(), d.ResetAt.UnixNano())
+		clock.Advance(100 * time.Millisecond)
+	}
+
+	// 空闲以后重新积攒令牌，又回到冷启动的状态
+	clock.Advance(time.Hour)
+	d, err = limiter.Decide(context.Background(), 1)
+	require.NoError(t, err)
+	require.True(t, d.Allowed)
+	assert.Equal(t, clock.Now().Add(280*time.Millisecond).UnixNano(), d.ResetAt.UnixNano())
+}
+
+func TestWarmUpTokenBucketLimiter_AllowN(t *testing.T) {
+	testCases := []struct {
+		name    string
+		before  func(*testing.T, *WarmUpTokenBucketLimiter, *restrictor.FakeClock)
+		n       int64
+		wantErr error
+		wantRes bool
+	}{
+		// 上一个请求的令牌已经发放完
+		{
+			name:    "success",
+			before:  func(t *testing.T, limiter *WarmUpTokenBucketLimiter, clock *restrictor.FakeClock) {},
+			n:       20,
+			wantRes: true,
+		},
+		// 上一个请求的令牌还没有发放完
+		{
+			name: "too early",
+			before: func(t *testing.T, limiter *WarmUpTokenBucketLimiter, clock *restrictor.FakeClock) {
+				ok, err := limiter.AllowN(context.Background(), 2)
+				require.NoError(t, err)
+				require.True(t, ok)
+				clock.Advance(519 * time.Millisecond)
+			},
+			n:       1,
+			wantErr: restrictor.ErrLimitExceeded,
+			wantRes: false,
+		},
+		// 上一个请求的两个令牌需要280+240毫秒
+		{
+			name: "next",
+			before: func(t *testing.T, limiter *WarmUpTokenBucketLimiter, clock *restrictor.FakeClock) {
+				ok, err := limiter.AllowN(context.Background(), 2)
+				require.NoError(t, err)
+				require.True(t, ok)
+				clock.Advance(520 * time.Millisecond)
+			},
+			n:       1,
+			wantRes: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			clock := restrictor.NewFakeClock(time.Now())
+			limiter := NewWarmUpTokenBucketLimiter(10, time.Second, WithClock(clock))
+			tc.before(t, limiter, clock)
+			res, err := limiter.AllowN(context.Background(), tc.n)
+			require.ErrorIs(t, err, tc.wantErr)
+			assert.Equal(t, tc.wantRes, res)
+		})
+	}
+}
+
+func TestWarmUpTokenBucketLimiter_WaitN(t *testing.T) {
+	clock := restrictor.NewFakeClock(time.Now())
+	limiter := NewWarmUpTokenBucketLimiter(10, time.Second, WithClock(clock))
+	require.NoError(t, limiter.Wait(context.Background()))
+
+	// 等待上一个请求的令牌发放完
+	go func() {
+		clock.BlockUntil(1)
+		clock.Advance(280 * time.Millisecond)
+	}()
+	start := clock.Now()
+	require.NoError(t, limiter.Wait(context.Background()))
+	assert.Equal(t, 280*time.Millisecond, clock.Now().Sub(start))
+
+	// 需要等待的时长超过ctx的截止时间
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	require.ErrorIs(t, limiter.Wait(ctx), context.DeadlineExceeded)
+}
+
+func TestWarmUpTokenBucketLimiter_SetRate(t *testing.T) {
+	testCases := []struct {
+		name   string
+		before func(*WarmUpTokenBucketLimiter, *restrictor.FakeClock)
+		rate   float64
+		// wantRetry 修改速率以后通过一个请求，下一个请求需要等待的时长
+		wantRetry time.Duration
+	}{
+		{
+			// 冷启动的状态保留，每秒20个，稳定间隔50毫秒，冷启动间隔150毫秒，最多积攒20个令牌
+			name:      "cold",
+			before:    func(*WarmUpTokenBucketLimiter, *restrictor.FakeClock) {},
+			rate:      20,
+			wantRetry: 145 * time.Millisecond,
+		},
+		{
+			// 预热完成以后直接按照新的稳定间隔发放
+			name: "warm",
+			before: func(l *WarmUpTokenBucketLimiter, clock *restrictor.FakeClock) {
+				// 一直有请求在排队，积攒的令牌全部消耗完
+				for i := 0; i < 20; i++ {
+					_, _ = l.Allow(context.Background())
+					d, _ := l.Decide(context.Background(), 1)
+					clock.Advance(d.RetryAfter)
+				}
+			},
+			rate:      20,
+			wantRetry: 50 * time.Millisecond,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			clock := restrictor.NewFakeClock(time.Now())
+			limiter := NewWarmUpTokenBucketLimiter(10, time.Second, WithClock(clock))
+			tc.before(limiter, clock)
+			limiter.SetRate(tc.rate)
+			require.NoError(t, allowN(limiter, 1))
+			d, err := limiter.Decide(context.Background(), 1)
+			require.NoError(t, err)
+			assert.Equal(t, false, d.Allowed)
+			assert.Equal(t, tc.wantRetry, d.RetryAfter)
+		})
+	}
+}